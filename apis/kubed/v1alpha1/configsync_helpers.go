@@ -0,0 +1,39 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"kubeops.dev/config-syncer/crds"
+
+	"kmodules.xyz/client-go/apiextensions"
+)
+
+func (_ ConfigSync) CustomResourceDefinition() *apiextensions.CustomResourceDefinition {
+	return crds.MustCustomResourceDefinition(SchemeGroupVersion.WithResource(ResourceConfigSyncs))
+}
+
+func (_ RemoteCluster) CustomResourceDefinition() *apiextensions.CustomResourceDefinition {
+	return crds.MustCustomResourceDefinition(SchemeGroupVersion.WithResource(ResourceRemoteClusters))
+}
+
+// KubeconfigKey returns the key of the kubeconfig file in the referenced Secret
+func (r KubeconfigSecretReference) KubeconfigKey() string {
+	if r.Key == "" {
+		return DefaultKubeconfigKey
+	}
+	return r.Key
+}
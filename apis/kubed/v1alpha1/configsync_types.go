@@ -0,0 +1,161 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	ResourceKindConfigSync = "ConfigSync"
+	ResourceConfigSync     = "configsync"
+	ResourceConfigSyncs    = "configsyncs"
+)
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// ConfigSync declares how a ConfigMap or Secret in the same namespace is synced into
+// other namespaces and clusters. It replaces the sync annotations of its source.
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:path=configsyncs,singular=configsync,shortName=csync,categories={kubed,appscode}
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Kind",type="string",JSONPath=".spec.source.kind"
+// +kubebuilder:printcolumn:name="Source",type="string",JSONPath=".spec.source.name"
+// +kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+type ConfigSync struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ConfigSyncSpec   `json:"spec,omitempty"`
+	Status ConfigSyncStatus `json:"status,omitempty"`
+}
+
+// ConfigSyncSpec is the spec for a ConfigSync
+type ConfigSyncSpec struct {
+	// Source refers to the ConfigMap or Secret to be synced. It must live in the namespace of the ConfigSync.
+	Source SourceReference `json:"source"`
+
+	// NamespaceSelector selects the namespaces of the source cluster copies are created in.
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+
+	// Namespaces lists namespaces of the source cluster copies are created in, in addition to the selected ones.
+	// +optional
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// Contexts lists the kubeconfig contexts of other clusters copies are created in.
+	// +optional
+	Contexts []string `json:"contexts,omitempty"`
+
+	// ClusterSelector selects the clusters running a config-syncer agent that pull the source, by the
+	// labels the agents are started with. It is ignored by the operator.
+	// +optional
+	ClusterSelector *metav1.LabelSelector `json:"clusterSelector,omitempty"`
+
+	// ContextNamespaceSelector selects the namespaces copies are created in, in the clusters of Contexts.
+	// If not set, copies are created in the namespace of the context, or else in the namespace of the source.
+	// +optional
+	ContextNamespaceSelector *metav1.LabelSelector `json:"contextNamespaceSelector,omitempty"`
+
+	// IncludeKeys lists the glob patterns of data keys to be copied. All keys are copied if empty.
+	// +optional
+	IncludeKeys []string `json:"includeKeys,omitempty"`
+
+	// ExcludeKeys lists the glob patterns of data keys never to be copied.
+	// +optional
+	ExcludeKeys []string `json:"excludeKeys,omitempty"`
+
+	// CreateNamespace creates missing target namespaces in the clusters of Contexts.
+	// +optional
+	CreateNamespace *NamespaceCreation `json:"createNamespace,omitempty"`
+}
+
+// +kubebuilder:validation:Enum=ConfigMap;Secret
+type SourceKind string
+
+const (
+	SourceKindConfigMap SourceKind = "ConfigMap"
+	SourceKindSecret    SourceKind = "Secret"
+)
+
+type SourceReference struct {
+	Kind SourceKind `json:"kind"`
+	Name string     `json:"name"`
+}
+
+// NamespaceCreation configures how missing target namespaces of other clusters are created
+type NamespaceCreation struct {
+	// Labels of the created namespaces.
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Prune deletes created namespaces once they hold no more copies.
+	// +optional
+	Prune bool `json:"prune,omitempty"`
+}
+
+// +kubebuilder:validation:Enum=Pending;Current;Failed;Superseded
+type ConfigSyncPhase string
+
+const (
+	// ConfigSyncPhasePending means the source has not been synced yet
+	ConfigSyncPhasePending ConfigSyncPhase = "Pending"
+	// ConfigSyncPhaseCurrent means all copies are up to date
+	ConfigSyncPhaseCurrent ConfigSyncPhase = "Current"
+	// ConfigSyncPhaseFailed means the last sync failed, see reason
+	ConfigSyncPhaseFailed ConfigSyncPhase = "Failed"
+	// ConfigSyncPhaseSuperseded means an older ConfigSync refers to the same source and takes precedence
+	ConfigSyncPhaseSuperseded ConfigSyncPhase = "Superseded"
+)
+
+type ConfigSyncStatus struct {
+	// ObservedGeneration is the most recent generation observed for this resource.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// +optional
+	Phase ConfigSyncPhase `json:"phase,omitempty"`
+
+	// Reason explains the phase, if not Current.
+	// +optional
+	Reason string `json:"reason,omitempty"`
+
+	// Namespaces lists the namespaces of the source cluster holding copies.
+	// +optional
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// Contexts lists the contexts holding copies.
+	// +optional
+	Contexts []string `json:"contexts,omitempty"`
+
+	// LastSyncTime is the time the source was last synced successfully.
+	// +optional
+	LastSyncTime *metav1.Time `json:"lastSyncTime,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// ConfigSyncList is a list of ConfigSyncs
+// +kubebuilder:object:root=true
+type ConfigSyncList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []ConfigSync `json:"items,omitempty"`
+}
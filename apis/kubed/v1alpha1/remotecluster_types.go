@@ -0,0 +1,113 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	ResourceKindRemoteCluster = "RemoteCluster"
+	ResourceRemoteCluster     = "remotecluster"
+	ResourceRemoteClusters    = "remoteclusters"
+
+	// DefaultKubeconfigKey is the key of the kubeconfig file in the Secret of a RemoteCluster
+	DefaultKubeconfigKey = "kubeconfig"
+)
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// RemoteCluster registers a cluster copies can be synced into. RemoteClusters are read from
+// the operator namespace and their name is used as context name, e.g. in the
+// kubed.appscode.com/sync-contexts annotation.
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:path=remoteclusters,singular=remotecluster,shortName=rcluster,categories={kubed,appscode}
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Reachable",type="boolean",JSONPath=".status.reachable"
+// +kubebuilder:printcolumn:name="Version",type="string",JSONPath=".status.serverVersion"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+type RemoteCluster struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   RemoteClusterSpec   `json:"spec,omitempty"`
+	Status RemoteClusterStatus `json:"status,omitempty"`
+}
+
+// RemoteClusterSpec is the spec for a RemoteCluster
+type RemoteClusterSpec struct {
+	// KubeconfigSecretRef refers to a Secret in the namespace of the RemoteCluster holding
+	// a kubeconfig file for the cluster.
+	KubeconfigSecretRef KubeconfigSecretReference `json:"kubeconfigSecretRef"`
+
+	// Context of the kubeconfig file to use. The current context is used if empty.
+	// +optional
+	Context string `json:"context,omitempty"`
+
+	// Namespace copies are created in. The namespace of the context is used if empty,
+	// and the namespace of the source if that is empty too.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// CreateNamespace creates missing target namespaces in the cluster, unless the source
+	// configures it.
+	// +optional
+	CreateNamespace *NamespaceCreation `json:"createNamespace,omitempty"`
+}
+
+type KubeconfigSecretReference struct {
+	Name string `json:"name"`
+
+	// Key of the kubeconfig file in the Secret. Defaults to kubeconfig.
+	// +optional
+	Key string `json:"key,omitempty"`
+}
+
+type RemoteClusterStatus struct {
+	// ObservedGeneration is the most recent generation observed for this resource.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Reachable is true if the cluster answered the last probe.
+	// +optional
+	Reachable bool `json:"reachable"`
+
+	// ServerVersion is the version of the cluster as of the last probe.
+	// +optional
+	ServerVersion string `json:"serverVersion,omitempty"`
+
+	// ClusterID is the UID of the kube-system namespace of the cluster, which identifies it
+	// no matter which address it is reached at.
+	// +optional
+	ClusterID string `json:"clusterID,omitempty"`
+
+	// LastError is the error of the last probe, or why the kubeconfig file can not be used.
+	// +optional
+	LastError string `json:"lastError,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// RemoteClusterList is a list of RemoteClusters
+// +kubebuilder:object:root=true
+type RemoteClusterList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []RemoteCluster `json:"items,omitempty"`
+}
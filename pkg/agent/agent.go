@@ -0,0 +1,111 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agent
+
+import (
+	kubedinformers "kubeops.dev/config-syncer/client/informers/externalversions"
+	"kubeops.dev/config-syncer/pkg/syncer"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// Agent runs in a target cluster. It watches the sources of the hub cluster and writes their
+// copies into its own cluster.
+type Agent struct {
+	Config
+
+	configSyncer *syncer.ConfigSyncer
+
+	// sources and ConfigSyncs of the hub cluster
+	hubInformerFactory      informers.SharedInformerFactory
+	hubKubedInformerFactory kubedinformers.SharedInformerFactory
+	// namespaces of the cluster of the agent
+	kubeInformerFactory informers.SharedInformerFactory
+}
+
+func (a *Agent) setupInformers(watchConfigSyncs bool) error {
+	cmInformer := a.hubInformerFactory.Core().V1().ConfigMaps().Informer()
+	if err := cmInformer.AddIndexers(syncer.SourceIndexers()); err != nil {
+		return err
+	}
+	cmInformer.AddEventHandler(a.configSyncer.ConfigMapHandler(cmInformer.GetIndexer()))
+
+	secretInformer := a.hubInformerFactory.Core().V1().Secrets().Informer()
+	if err := secretInformer.AddIndexers(syncer.SourceIndexers()); err != nil {
+		return err
+	}
+	secretInformer.AddEventHandler(a.configSyncer.SecretHandler(secretInformer.GetIndexer()))
+
+	if watchConfigSyncs {
+		csInformer := a.hubKubedInformerFactory.Kubed().V1alpha1().ConfigSyncs().Informer()
+		if err := csInformer.AddIndexers(cache.Indexers{syncer.ConfigSyncSourceIndex: syncer.ConfigSyncSourceIndexFunc}); err != nil {
+			return err
+		}
+		csInformer.AddEventHandler(a.configSyncer.ConfigSyncHandler(csInformer.GetIndexer()))
+	}
+
+	nsInformer := a.kubeInformerFactory.Core().V1().Namespaces()
+	nsInformer.Informer().AddEventHandler(a.configSyncer.AgentNamespaceHandler(nsInformer.Informer().HasSynced))
+	return nil
+}
+
+func (a *Agent) Run(stopCh <-chan struct{}) {
+	a.hubInformerFactory.Start(stopCh)
+	a.hubKubedInformerFactory.Start(stopCh)
+	a.kubeInformerFactory.Start(stopCh)
+
+	for _, v := range a.hubInformerFactory.WaitForCacheSync(stopCh) {
+		if !v {
+			runtime.HandleError(errors.Errorf("timed out waiting for caches to sync"))
+			return
+		}
+	}
+	for _, v := range a.hubKubedInformerFactory.WaitForCacheSync(stopCh) {
+		if !v {
+			runtime.HandleError(errors.Errorf("timed out waiting for caches to sync"))
+			return
+		}
+	}
+	for _, v := range a.kubeInformerFactory.WaitForCacheSync(stopCh) {
+		if !v {
+			runtime.HandleError(errors.Errorf("timed out waiting for caches to sync"))
+			return
+		}
+	}
+
+	a.configSyncer.Run(stopCh)
+
+	if a.GCPeriod > 0 {
+		go wait.Until(a.collectGarbage, a.GCPeriod, stopCh)
+	} else {
+		go a.collectGarbage()
+	}
+
+	<-stopCh
+	klog.Infoln("Stopping config-syncer agent")
+}
+
+func (a *Agent) collectGarbage() {
+	if err := a.configSyncer.CollectGarbage(); err != nil {
+		klog.Errorln(err)
+	}
+}
@@ -0,0 +1,112 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agent
+
+import (
+	"context"
+	"time"
+
+	kubed_cs "kubeops.dev/config-syncer/client/clientset/versioned"
+	kubedinformers "kubeops.dev/config-syncer/client/informers/externalversions"
+	"kubeops.dev/config-syncer/pkg/eventer"
+	"kubeops.dev/config-syncer/pkg/syncer"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+type Config struct {
+	// name and labels of the cluster of the agent
+	ClusterName   string
+	ClusterLabels map[string]string
+	// namespace copies are created in, if empty the namespace of the source is used
+	Namespace string
+
+	// name of the hub cluster in the origin labels of copies, empty by default like the --cluster-name of the hub
+	HubClusterName string
+	// namespace of the sources in the hub cluster, all namespaces if empty
+	HubNamespace string
+
+	ResyncPeriod   time.Duration
+	GCPeriod       time.Duration
+	MaxNumRequeues int
+	NumThreads     int
+	ConflictPolicy syncer.ConflictPolicy
+
+	MaxParallelWrites           int
+	MaxParallelWritesPerCluster int
+}
+
+type AgentConfig struct {
+	Config
+
+	// clients of the cluster of the agent
+	KubeClient    kubernetes.Interface
+	DynamicClient dynamic.Interface
+
+	// read-only clients of the hub cluster
+	HubKubeClient    kubernetes.Interface
+	HubDynamicClient dynamic.Interface
+	HubKubedClient   kubed_cs.Interface
+}
+
+func (c *AgentConfig) New() (*Agent, error) {
+	a := &Agent{Config: c.Config}
+
+	// events are recorded in the cluster of the agent, the hub is only read
+	recorder := eventer.NewEventRecorder(c.KubeClient, "config-syncer-agent")
+	a.configSyncer = syncer.New(c.HubKubeClient, c.HubDynamicClient, c.HubKubedClient, recorder, syncer.Options{
+		MaxNumRequeues: c.MaxNumRequeues,
+		NumThreads:     c.NumThreads,
+		ConflictPolicy: c.ConflictPolicy,
+
+		MaxParallelWrites:           c.MaxParallelWrites,
+		MaxParallelWritesPerCluster: c.MaxParallelWritesPerCluster,
+		SourceNamespace:             c.HubNamespace,
+	})
+	err := a.configSyncer.ConfigureAgent(c.HubClusterName, syncer.AgentOptions{
+		ClusterName:   c.ClusterName,
+		ClusterLabels: c.ClusterLabels,
+		Namespace:     c.Namespace,
+		Client:        c.KubeClient,
+		DynamicClient: c.DynamicClient,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// ConfigSyncs are optional, the CRD may not be registered in the hub or not readable by the agent
+	_, err = c.HubKubedClient.KubedV1alpha1().ConfigSyncs(c.HubNamespace).List(context.TODO(), metav1.ListOptions{Limit: 1})
+	watchConfigSyncs := err == nil
+	if !watchConfigSyncs {
+		klog.Warningf("ignoring ConfigSyncs of the hub cluster: %v", err)
+	}
+
+	// ---------------------------
+	a.hubInformerFactory = informers.NewSharedInformerFactoryWithOptions(c.HubKubeClient, c.ResyncPeriod, informers.WithNamespace(c.HubNamespace))
+	a.hubKubedInformerFactory = kubedinformers.NewSharedInformerFactoryWithOptions(c.HubKubedClient, c.ResyncPeriod, kubedinformers.WithNamespace(c.HubNamespace))
+	a.kubeInformerFactory = informers.NewSharedInformerFactory(c.KubeClient, c.ResyncPeriod)
+	// ---------------------------
+	if err := a.setupInformers(watchConfigSyncs); err != nil {
+		return nil, err
+	}
+	// ---------------------------
+	return a, nil
+}
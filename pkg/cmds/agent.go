@@ -0,0 +1,175 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"time"
+
+	kubed_cs "kubeops.dev/config-syncer/client/clientset/versioned"
+	"kubeops.dev/config-syncer/pkg/agent"
+	"kubeops.dev/config-syncer/pkg/syncer"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog/v2"
+)
+
+type agentOptions struct {
+	kubeconfig     string
+	hubKubeconfig  string
+	hubContext     string
+	clusterName    string
+	clusterLabels  map[string]string
+	namespace      string
+	hubClusterName string
+	hubNamespace   string
+	resyncPeriod   time.Duration
+	gcPeriod       time.Duration
+	maxNumRequeues int
+	numThreads     int
+	conflictPolicy string
+
+	maxParallelWrites           int
+	maxParallelWritesPerCluster int
+}
+
+func newAgentOptions() *agentOptions {
+	return &agentOptions{
+		resyncPeriod:   10 * time.Minute,
+		gcPeriod:       time.Hour,
+		maxNumRequeues: 5,
+		numThreads:     2,
+		conflictPolicy: string(syncer.ConflictPolicyOverwrite),
+
+		maxParallelWrites:           syncer.DefaultMaxParallelWrites,
+		maxParallelWritesPerCluster: syncer.DefaultMaxParallelWritesPerCluster,
+	}
+}
+
+func (o *agentOptions) addFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.kubeconfig, "kubeconfig", o.kubeconfig, "Path to the kubeconfig file of the cluster of the agent, the in-cluster config is used if empty")
+	fs.StringVar(&o.hubKubeconfig, "hub-kubeconfig", o.hubKubeconfig, "Path to the kubeconfig file with read-only credentials for the hub cluster")
+	fs.StringVar(&o.hubContext, "hub-context", o.hubContext, "Context of the hub cluster in the hub kubeconfig file, defaults to its current context")
+	fs.StringVar(&o.clusterName, "cluster-name", o.clusterName, "Name of the cluster of the agent, as listed in the kubed.appscode.com/sync-contexts annotation of sources")
+	fs.StringToStringVar(&o.clusterLabels, "cluster-labels", o.clusterLabels, "Labels of the cluster of the agent, matched by the kubed.appscode.com/sync-cluster-selector annotation of sources, eg. env=prod,region=eu")
+	fs.StringVarP(&o.namespace, "namespace", "n", o.namespace, "Namespace copies are created in, defaults to the namespace of the source")
+	fs.StringVar(&o.hubClusterName, "hub-cluster-name", o.hubClusterName, "Name of the hub cluster, as passed to an operator running there")
+	fs.StringVar(&o.hubNamespace, "hub-namespace", o.hubNamespace, "Namespace of the sources in the hub cluster, all namespaces if empty")
+	fs.DurationVar(&o.resyncPeriod, "resync-period", o.resyncPeriod, "If non-zero, will re-list this often")
+	fs.DurationVar(&o.gcPeriod, "gc-period", o.gcPeriod, "How often orphaned copies are garbage collected. If zero, orphaned copies are only collected at startup.")
+	fs.IntVar(&o.maxNumRequeues, "max-num-requeues", o.maxNumRequeues, "Maximum number of times a failed sync is retried with exponential backoff before it is dropped")
+	fs.IntVar(&o.numThreads, "num-threads", o.numThreads, "Number of workers processing each sync queue")
+	fs.IntVar(&o.maxParallelWrites, "max-parallel-writes", o.maxParallelWrites, "Maximum number of copies written or deleted in parallel")
+	fs.IntVar(&o.maxParallelWritesPerCluster, "max-parallel-writes-per-cluster", o.maxParallelWritesPerCluster, "Maximum number of copies written or deleted in parallel in each cluster")
+	fs.StringVar(&o.conflictPolicy, "conflict-policy", o.conflictPolicy, "How to handle objects in target namespaces that are not managed by config-syncer: skip, overwrite or adopt")
+}
+
+func (o *agentOptions) config() (*agent.AgentConfig, error) {
+	if o.clusterName == "" {
+		return nil, errors.New("--cluster-name is required")
+	}
+	if o.hubKubeconfig == "" {
+		return nil, errors.New("--hub-kubeconfig is required")
+	}
+	policy, err := syncer.ParseConflictPolicy(o.conflictPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg *rest.Config
+	if o.kubeconfig == "" {
+		cfg, err = rest.InClusterConfig()
+	} else {
+		cfg, err = clientcmd.BuildConfigFromFlags("", o.kubeconfig)
+	}
+	if err != nil {
+		return nil, err
+	}
+	rules := &clientcmd.ClientConfigLoadingRules{ExplicitPath: o.hubKubeconfig}
+	hubCfg, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{CurrentContext: o.hubContext}).ClientConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load hub kubeconfig file")
+	}
+
+	c := &agent.AgentConfig{
+		Config: agent.Config{
+			ClusterName:    o.clusterName,
+			ClusterLabels:  o.clusterLabels,
+			Namespace:      o.namespace,
+			HubClusterName: o.hubClusterName,
+			HubNamespace:   o.hubNamespace,
+			ResyncPeriod:   o.resyncPeriod,
+			GCPeriod:       o.gcPeriod,
+			MaxNumRequeues: o.maxNumRequeues,
+			NumThreads:     o.numThreads,
+			ConflictPolicy: policy,
+
+			MaxParallelWrites:           o.maxParallelWrites,
+			MaxParallelWritesPerCluster: o.maxParallelWritesPerCluster,
+		},
+	}
+	if c.KubeClient, err = kubernetes.NewForConfig(cfg); err != nil {
+		return nil, err
+	}
+	if c.DynamicClient, err = dynamic.NewForConfig(cfg); err != nil {
+		return nil, err
+	}
+	if c.HubKubeClient, err = kubernetes.NewForConfig(hubCfg); err != nil {
+		return nil, err
+	}
+	if c.HubDynamicClient, err = dynamic.NewForConfig(hubCfg); err != nil {
+		return nil, err
+	}
+	if c.HubKubedClient, err = kubed_cs.NewForConfig(hubCfg); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func NewCmdAgent(stopCh <-chan struct{}) *cobra.Command {
+	o := newAgentOptions()
+
+	cmd := &cobra.Command{
+		Use:   "agent",
+		Short: "Pull sources from a hub cluster into this cluster",
+		Long: `Run in a target cluster and watch the ConfigMaps and Secrets of a hub cluster through read-only credentials.
+Sources listing the cluster name in their kubed.appscode.com/sync-contexts annotation, or whose
+kubed.appscode.com/sync-cluster-selector annotation matches the cluster labels, are copied into this cluster.`,
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			klog.Infoln("Starting config-syncer agent...")
+
+			c, err := o.config()
+			if err != nil {
+				return err
+			}
+			a, err := c.New()
+			if err != nil {
+				return err
+			}
+			a.Run(stopCh)
+			return nil
+		},
+	}
+	o.addFlags(cmd.Flags())
+	return cmd
+}
@@ -0,0 +1,167 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+
+	kubed_cs "kubeops.dev/config-syncer/client/clientset/versioned"
+	"kubeops.dev/config-syncer/pkg/syncer"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/record"
+	"kmodules.xyz/client-go/meta"
+	"sigs.k8s.io/yaml"
+)
+
+// clusterOptions configure access to the source cluster, to the contexts of the kubeconfig file and
+// to RemoteClusters for commands that inspect syncs from outside the operator. They must match the flags of the operator.
+type clusterOptions struct {
+	kubeconfig     string
+	context        string
+	namespace      string
+	allNamespaces  bool
+	clusterName    string
+	kubeConfigFile string
+	operatorNs     string
+	conflictPolicy string
+	syncResources  []string
+	output         string
+}
+
+func newClusterOptions() *clusterOptions {
+	return &clusterOptions{
+		operatorNs:     defaultOperatorNamespace(),
+		conflictPolicy: string(syncer.ConflictPolicyOverwrite),
+		output:         "table",
+	}
+}
+
+func (o *clusterOptions) addFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.kubeconfig, "kubeconfig", o.kubeconfig, "Path to the kubeconfig file of the source cluster")
+	fs.StringVar(&o.context, "context", o.context, "Context of the source cluster in the kubeconfig file")
+	fs.StringVarP(&o.namespace, "namespace", "n", o.namespace, "Namespace of the sources, defaults to the namespace of the context")
+	fs.BoolVarP(&o.allNamespaces, "all-namespaces", "A", o.allNamespaces, "Consider sources in all namespaces")
+	fs.StringVar(&o.clusterName, "cluster-name", o.clusterName, "Name of the source cluster, as passed to the operator")
+	fs.StringVar(&o.kubeConfigFile, "kubeconfig-file", o.kubeConfigFile, "kubeconfig file with the contexts of other clusters, as passed to the operator")
+	fs.StringVar(&o.operatorNs, "operator-namespace", o.operatorNs, "Namespace of the RemoteClusters, as passed to the operator. Defaults to the namespace of the pod like for the operator, or outside a pod to kube-system, the namespace the operator is installed in. If empty, RemoteClusters are ignored.")
+	fs.StringVar(&o.conflictPolicy, "conflict-policy", o.conflictPolicy, "Conflict policy of the operator: skip, overwrite or adopt")
+	fs.StringArrayVar(&o.syncResources, "sync-resource", o.syncResources, "Additional namespaced resource synced by the operator, as passed to it. Can be repeated.")
+	fs.StringVarP(&o.output, "output", "o", o.output, "Output format: table, json or yaml")
+}
+
+// defaultOperatorNamespace matches the default of the operator, the namespace of its pod, when run
+// in a pod and falls back to the documented install namespace otherwise.
+func defaultOperatorNamespace() string {
+	if os.Getenv("POD_NAMESPACE") != "" || meta.PossiblyInCluster() {
+		return meta.PodNamespace()
+	}
+	return metav1.NamespaceSystem
+}
+
+// newSyncer returns a syncer for the source cluster with the contexts and RemoteClusters configured and
+// ConfigSyncs loaded, along with the namespace of the sources.
+func (o *clusterOptions) newSyncer() (*syncer.ConfigSyncer, string, error) {
+	switch o.output {
+	case "table", "json", "yaml":
+	default:
+		return nil, "", errors.Errorf("unknown output format %q, must be one of table, json or yaml", o.output)
+	}
+	policy, err := syncer.ParseConflictPolicy(o.conflictPolicy)
+	if err != nil {
+		return nil, "", err
+	}
+	var resources []syncer.ResourceRule
+	for _, v := range o.syncResources {
+		rule, err := syncer.ParseResourceRule(v)
+		if err != nil {
+			return nil, "", err
+		}
+		resources = append(resources, rule)
+	}
+
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = o.kubeconfig
+	cc := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{CurrentContext: o.context})
+	cfg, err := cc.ClientConfig()
+	if err != nil {
+		return nil, "", err
+	}
+	namespace := o.namespace
+	if o.allNamespaces {
+		namespace = metav1.NamespaceAll
+	} else if namespace == "" {
+		if namespace, _, err = cc.Namespace(); err != nil {
+			return nil, "", err
+		}
+	}
+
+	kc, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, "", err
+	}
+	dc, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		return nil, "", err
+	}
+	kubedClient, err := kubed_cs.NewForConfig(cfg)
+	if err != nil {
+		return nil, "", err
+	}
+
+	s := syncer.New(kc, dc, kubedClient, &record.FakeRecorder{}, syncer.Options{ConflictPolicy: policy, Resources: resources})
+	if err := s.Configure(o.clusterName, o.kubeConfigFile); err != nil {
+		return nil, "", err
+	}
+	if o.operatorNs != "" {
+		if err := s.LoadRemoteClusters(o.operatorNs); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := s.LoadConfigSyncs(namespace); err != nil {
+		return nil, "", err
+	}
+	return s, namespace, nil
+}
+
+// print writes v as JSON or YAML, or calls table for the table format
+func (o *clusterOptions) print(out io.Writer, v interface{}, table func(io.Writer) error) error {
+	switch o.output {
+	case "json":
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = out.Write(append(data, '\n'))
+		return err
+	case "yaml":
+		data, err := yaml.Marshal(v)
+		if err != nil {
+			return err
+		}
+		_, err = out.Write(data)
+		return err
+	}
+	return table(out)
+}
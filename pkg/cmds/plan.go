@@ -0,0 +1,194 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"kubeops.dev/config-syncer/pkg/syncer"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func NewCmdPlan(out io.Writer) *cobra.Command {
+	o := newClusterOptions()
+
+	cmd := &cobra.Command{
+		Use:   "plan [configmap/NAME | secret/NAME | RESOURCE/NAME]",
+		Short: "Show the copies a sync would create, update or delete",
+		Long: `Show the copies a sync would create, update or delete, without writing anything.
+
+Sync annotations and ConfigSyncs of the source are evaluated against the live source cluster and
+the contexts of the kubeconfig file. Without arguments, every synced ConfigMap, Secret and resource
+passed with --sync-resource of the namespace is planned. Updates list the added, changed and removed
+data keys or fields, never their values. Contexts, namespaces and sources that can not be planned
+are listed with the Error action, the others are still planned.`,
+		Example: `  # preview the sync of a secret
+  config-syncer plan secret/registry-auth -n demo --kubeconfig-file=/srv/kubed/kubeconfig
+
+  # preview the sync of a network policy
+  config-syncer plan networkpolicies/deny-all -n demo --sync-resource=networkpolicies.v1.networking.k8s.io=spec
+
+  # preview the sync of all sources as YAML
+  config-syncer plan -A -o yaml`,
+		Args:              cobra.MaximumNArgs(1),
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, namespace, err := o.newSyncer()
+			if err != nil {
+				return err
+			}
+			changes, err := plan(s, namespace, args)
+			if err != nil {
+				return err
+			}
+			return o.print(out, changes, func(w io.Writer) error {
+				return printPlan(w, changes)
+			})
+		},
+	}
+	o.addFlags(cmd.Flags())
+
+	return cmd
+}
+
+func plan(s *syncer.ConfigSyncer, namespace string, args []string) ([]syncer.PlannedChange, error) {
+	if len(args) == 0 {
+		var changes []syncer.PlannedChange
+		for _, planAll := range []func(string) ([]syncer.PlannedChange, error){s.PlanConfigMaps, s.PlanSecrets, s.PlanResources} {
+			c, err := planAll(namespace)
+			if err != nil {
+				return nil, err
+			}
+			changes = append(changes, c...)
+		}
+		return changes, nil
+	}
+
+	if namespace == metav1.NamespaceAll {
+		return nil, errors.New("a namespace is required to plan a single source")
+	}
+	kind, name, err := parseSource(args[0])
+	if err != nil {
+		return nil, err
+	}
+	kc := s.KubeClient()
+	switch kind {
+	case "configmap":
+		src, err := kc.CoreV1().ConfigMaps(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return s.PlanConfigMap(src)
+	case "secret":
+		src, err := kc.CoreV1().Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return s.PlanSecret(src)
+	}
+	rule, err := resourceRuleFor(s.ResourceRules(), kind)
+	if err != nil {
+		return nil, err
+	}
+	src, err := s.DynamicClient().Resource(rule.GVR).Namespace(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return s.PlanResource(rule, src)
+}
+
+// parseSource parses a source argument in the form kind/name. The kind of ConfigMaps and Secrets is
+// normalized, other kinds are returned as resource[.group] in lower case.
+func parseSource(arg string) (string, string, error) {
+	kind, name, ok := strings.Cut(arg, "/")
+	if !ok || kind == "" || name == "" {
+		return "", "", errors.Errorf("invalid source %q, must be configmap/NAME, secret/NAME or RESOURCE/NAME", arg)
+	}
+	switch kind = strings.ToLower(kind); kind {
+	case "configmap", "configmaps", "cm":
+		return "configmap", name, nil
+	case "secret", "secrets":
+		return "secret", name, nil
+	}
+	return kind, name, nil
+}
+
+// resourceRuleFor returns the rule of a resource given as resource or resource.group
+func resourceRuleFor(rules []syncer.ResourceRule, resource string) (syncer.ResourceRule, error) {
+	for _, rule := range rules {
+		if resource == rule.GVR.Resource || resource == rule.GVR.GroupResource().String() {
+			return rule, nil
+		}
+	}
+	return syncer.ResourceRule{}, errors.Errorf("unknown resource %q, must be configmap, secret or passed with --sync-resource", resource)
+}
+
+func printPlan(out io.Writer, changes []syncer.PlannedChange) error {
+	if len(changes) == 0 {
+		_, err := fmt.Fprintln(out, "No changes. All copies are up to date.")
+		return err
+	}
+
+	counts := map[syncer.PlanAction]int{}
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	_, _ = fmt.Fprintln(w, "ACTION\tKIND\tSOURCE\tCONTEXT\tNAMESPACE\tNAME\tKEYS")
+	for _, c := range changes {
+		counts[c.Action]++
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", c.Action, c.Kind, c.Source, orDash(c.Context), orDash(c.Namespace), orDash(c.Name), planKeys(c))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(out, "\nPlan: %d to create, %d to update, %d to delete, %d skipped, %d failed.\n",
+		counts[syncer.PlanActionCreate], counts[syncer.PlanActionUpdate], counts[syncer.PlanActionDelete], counts[syncer.PlanActionSkip], counts[syncer.PlanActionError])
+	return err
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// planKeys formats the key diff of a change as +added ~changed -removed
+func planKeys(c syncer.PlannedChange) string {
+	var parts []string
+	for _, k := range c.AddedKeys {
+		parts = append(parts, "+"+k)
+	}
+	for _, k := range c.ChangedKeys {
+		parts = append(parts, "~"+k)
+	}
+	for _, k := range c.RemovedKeys {
+		parts = append(parts, "-"+k)
+	}
+	if c.Reason != "" {
+		parts = append(parts, "("+c.Reason+")")
+	}
+	if len(parts) == 0 {
+		return "-"
+	}
+	return strings.Join(parts, " ")
+}
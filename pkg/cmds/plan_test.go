@@ -0,0 +1,115 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"bytes"
+	"testing"
+
+	"kubeops.dev/config-syncer/pkg/syncer"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestParseSource(t *testing.T) {
+	tests := []struct {
+		arg      string
+		wantKind string
+		wantName string
+		wantErr  bool
+	}{
+		{arg: "configmap/omni", wantKind: "configmap", wantName: "omni"},
+		{arg: "ConfigMaps/omni", wantKind: "configmap", wantName: "omni"},
+		{arg: "cm/omni", wantKind: "configmap", wantName: "omni"},
+		{arg: "secret/creds", wantKind: "secret", wantName: "creds"},
+		{arg: "secrets/creds", wantKind: "secret", wantName: "creds"},
+		{arg: "NetworkPolicies.networking.k8s.io/deny-all", wantKind: "networkpolicies.networking.k8s.io", wantName: "deny-all"},
+		{arg: "omni", wantErr: true},
+		{arg: "configmap/", wantErr: true},
+		{arg: "/omni", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			kind, name, err := parseSource(tt.arg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSource() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if kind != tt.wantKind || name != tt.wantName {
+				t.Errorf("parseSource() = %q, %q, want %q, %q", kind, name, tt.wantKind, tt.wantName)
+			}
+		})
+	}
+}
+
+func TestResourceRuleFor(t *testing.T) {
+	rules := []syncer.ResourceRule{
+		{GVR: schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1", Resource: "networkpolicies"}},
+		{GVR: schema.GroupVersionResource{Version: "v1", Resource: "limitranges"}},
+	}
+	for _, resource := range []string{"networkpolicies", "networkpolicies.networking.k8s.io"} {
+		if rule, err := resourceRuleFor(rules, resource); err != nil || rule.GVR != rules[0].GVR {
+			t.Errorf("resourceRuleFor(%q) = %v, %v, want %v", resource, rule.GVR, err, rules[0].GVR)
+		}
+	}
+	if _, err := resourceRuleFor(rules, "deployments"); err == nil {
+		t.Error("resourceRuleFor(deployments) succeeded, want error for a resource that is not synced")
+	}
+}
+
+func TestPrintPlan(t *testing.T) {
+	tests := []struct {
+		name    string
+		changes []syncer.PlannedChange
+		want    string
+	}{
+		{
+			name: "no changes",
+			want: "No changes. All copies are up to date.\n",
+		},
+		{
+			name: "changes",
+			changes: []syncer.PlannedChange{
+				{Action: syncer.PlanActionCreate, Kind: "ConfigMap", Source: "demo/omni", Namespace: "a", Name: "omni", AddedKeys: []string{"k"}},
+				{Action: syncer.PlanActionUpdate, Kind: "ConfigMap", Source: "demo/omni", Context: "east", Namespace: "demo", Name: "omni",
+					ChangedKeys: []string{"k"}, RemovedKeys: []string{"old"}},
+				{Action: syncer.PlanActionDelete, Kind: "ConfigMap", Source: "demo/omni", Namespace: "b", Name: "omni"},
+				{Action: syncer.PlanActionSkip, Kind: "Secret", Source: "demo/creds", Namespace: "a", Name: "creds", Reason: "not managed"},
+				{Action: syncer.PlanActionError, Kind: "Secret", Source: "demo/creds", Context: "west", Reason: "unreachable"},
+			},
+			want: `ACTION   KIND        SOURCE       CONTEXT   NAMESPACE   NAME    KEYS
+Create   ConfigMap   demo/omni    -         a           omni    +k
+Update   ConfigMap   demo/omni    east      demo        omni    ~k -old
+Delete   ConfigMap   demo/omni    -         b           omni    -
+Skip     Secret      demo/creds   -         a           creds   (not managed)
+Error    Secret      demo/creds   west      -           -       (unreachable)
+
+Plan: 1 to create, 1 to update, 1 to delete, 1 skipped, 1 failed.
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := printPlan(&out, tt.changes); err != nil {
+				t.Fatal(err)
+			}
+			if got := out.String(); got != tt.want {
+				t.Errorf("printPlan() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
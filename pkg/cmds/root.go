@@ -35,6 +35,9 @@ func NewCmdConfigSyncer(version string) *cobra.Command {
 
 	stopCh := genericapiserver.SetupSignalHandler()
 	cmd.AddCommand(NewCmdRun(os.Stdout, os.Stderr, stopCh))
+	cmd.AddCommand(NewCmdAgent(stopCh))
+	cmd.AddCommand(NewCmdPlan(os.Stdout))
+	cmd.AddCommand(NewCmdStatus(os.Stdout))
 	cmd.AddCommand(v.NewCmdVersion())
 
 	return cmd
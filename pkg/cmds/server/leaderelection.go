@@ -0,0 +1,111 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/client-go/tools/record"
+	"kmodules.xyz/client-go/meta"
+)
+
+type LeaderElectionOptions struct {
+	LeaderElect       bool
+	LeaseDuration     time.Duration
+	RenewDeadline     time.Duration
+	RetryPeriod       time.Duration
+	ResourceName      string
+	ResourceNamespace string
+}
+
+func NewLeaderElectionOptions() *LeaderElectionOptions {
+	return &LeaderElectionOptions{
+		LeaderElect:       false,
+		LeaseDuration:     15 * time.Second,
+		RenewDeadline:     10 * time.Second,
+		RetryPeriod:       2 * time.Second,
+		ResourceName:      "config-syncer",
+		ResourceNamespace: "",
+	}
+}
+
+func (s *LeaderElectionOptions) AddFlags(fs *pflag.FlagSet) {
+	fs.BoolVar(&s.LeaderElect, "leader-elect", s.LeaderElect, "Elect a leader using a Lease before syncing, so that multiple replicas can run for high availability. Only the leader syncs, all replicas serve health checks and metrics.")
+	fs.DurationVar(&s.LeaseDuration, "leader-elect-lease-duration", s.LeaseDuration, "Duration that non-leader replicas wait after observing a leadership renewal before attempting to acquire leadership")
+	fs.DurationVar(&s.RenewDeadline, "leader-elect-renew-deadline", s.RenewDeadline, "Duration that the leader retries refreshing leadership before giving it up. Must be less than the lease duration.")
+	fs.DurationVar(&s.RetryPeriod, "leader-elect-retry-period", s.RetryPeriod, "Duration replicas wait between attempts to acquire or renew leadership")
+	fs.StringVar(&s.ResourceName, "leader-elect-resource-name", s.ResourceName, "Name of the Lease used for leader election")
+	fs.StringVar(&s.ResourceNamespace, "leader-elect-resource-namespace", s.ResourceNamespace, "Namespace of the Lease used for leader election. Defaults to the namespace of the operator pod.")
+}
+
+func (s *LeaderElectionOptions) Validate() []error {
+	if !s.LeaderElect {
+		return nil
+	}
+	var errs []error
+	if s.LeaseDuration <= s.RenewDeadline {
+		errs = append(errs, errors.New("--leader-elect-lease-duration must be greater than --leader-elect-renew-deadline"))
+	}
+	if s.RetryPeriod <= 0 {
+		errs = append(errs, errors.New("--leader-elect-retry-period must be greater than zero"))
+	}
+	if s.ResourceName == "" {
+		errs = append(errs, errors.New("--leader-elect-resource-name must not be empty"))
+	}
+	return errs
+}
+
+// LeaderElectionConfig returns the leader election config without callbacks, or nil if leader election is disabled
+func (s *LeaderElectionOptions) LeaderElectionConfig(clientConfig *rest.Config, recorder record.EventRecorder) (*leaderelection.LeaderElectionConfig, error) {
+	if !s.LeaderElect {
+		return nil, nil
+	}
+
+	namespace := s.ResourceNamespace
+	if namespace == "" {
+		namespace = meta.PodNamespace()
+	}
+	lock, err := resourcelock.NewFromKubeconfig(
+		resourcelock.LeasesResourceLock,
+		namespace,
+		s.ResourceName,
+		resourcelock.ResourceLockConfig{
+			// unique per process, so that a restarted replica does not take over the lease of its predecessor
+			Identity:      meta.PodName() + "_" + string(uuid.NewUUID()),
+			EventRecorder: recorder,
+		},
+		clientConfig,
+		s.RenewDeadline,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create leader election lock")
+	}
+	return &leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		LeaseDuration:   s.LeaseDuration,
+		RenewDeadline:   s.RenewDeadline,
+		RetryPeriod:     s.RetryPeriod,
+		ReleaseOnCancel: true,
+		Name:            s.ResourceName,
+	}, nil
+}
@@ -0,0 +1,74 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestLeaderElectionOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(o *LeaderElectionOptions)
+		wantErr bool
+	}{
+		{name: "defaults", mutate: func(o *LeaderElectionOptions) {}},
+		{name: "disabled", mutate: func(o *LeaderElectionOptions) { o.LeaderElect, o.ResourceName = false, "" }},
+		{name: "lease shorter than renew deadline", mutate: func(o *LeaderElectionOptions) { o.LeaseDuration = o.RenewDeadline }, wantErr: true},
+		{name: "no retry period", mutate: func(o *LeaderElectionOptions) { o.RetryPeriod = 0 }, wantErr: true},
+		{name: "no lease name", mutate: func(o *LeaderElectionOptions) { o.ResourceName = "" }, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := NewLeaderElectionOptions()
+			o.LeaderElect = true
+			tt.mutate(o)
+			if errs := o.Validate(); (len(errs) > 0) != tt.wantErr {
+				t.Errorf("Validate() = %v, wantErr %v", errs, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLeaderElectionConfig(t *testing.T) {
+	o := NewLeaderElectionOptions()
+	if lec, err := o.LeaderElectionConfig(&rest.Config{Host: "https://127.0.0.1"}, record.NewFakeRecorder(10)); err != nil || lec != nil {
+		t.Fatalf("LeaderElectionConfig() = %v, %v, want nil without leader election", lec, err)
+	}
+
+	o.LeaderElect = true
+	o.ResourceNamespace = "kube-system"
+	o.LeaseDuration = time.Minute
+	lec, err := o.LeaderElectionConfig(&rest.Config{Host: "https://127.0.0.1"}, record.NewFakeRecorder(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := lec.Lock.(*resourcelock.LeaseLock); !ok {
+		t.Errorf("lock is %T, want a Lease", lec.Lock)
+	}
+	if got := lec.Lock.Describe(); got != "kube-system/config-syncer" {
+		t.Errorf("lock is %s, want kube-system/config-syncer", got)
+	}
+	if lec.LeaseDuration != time.Minute || lec.RenewDeadline != o.RenewDeadline || lec.RetryPeriod != o.RetryPeriod || !lec.ReleaseOnCancel {
+		t.Errorf("got config %+v, want the durations of the options and the lease released on cancel", lec)
+	}
+}
@@ -19,20 +19,36 @@ package server
 import (
 	"time"
 
+	kubed_cs "kubeops.dev/config-syncer/client/clientset/versioned"
 	"kubeops.dev/config-syncer/pkg/operator"
+	"kubeops.dev/config-syncer/pkg/syncer"
 
 	"github.com/spf13/pflag"
+	crd_cs "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"kmodules.xyz/client-go/meta"
 )
 
 type OperatorOptions struct {
 	ClusterName           string
 	ConfigSourceNamespace string
 	KubeConfigFile        string
+	OperatorNamespace     string
 
-	QPS          float32
-	Burst        int
-	ResyncPeriod time.Duration
+	QPS            float32
+	Burst          int
+	ResyncPeriod   time.Duration
+	GCPeriod       time.Duration
+	MaxNumRequeues int
+	NumThreads     int
+	ConflictPolicy string
+	SyncResources  []string
+
+	ContextNamespaceResyncPeriod time.Duration
+
+	MaxParallelWrites           int
+	MaxParallelWritesPerCluster int
 }
 
 func NewOperatorOptions() *OperatorOptions {
@@ -40,23 +56,42 @@ func NewOperatorOptions() *OperatorOptions {
 		ClusterName:           "",
 		ConfigSourceNamespace: "",
 		KubeConfigFile:        "",
+		OperatorNamespace:     meta.PodNamespace(),
 		// ref: https://github.com/kubernetes/ingress-nginx/blob/e4d53786e771cc6bdd55f180674b79f5b692e552/pkg/ingress/controller/launch.go#L252-L259
 		// High enough QPS to fit all expected use cases. QPS=0 is not set here, because client code is overriding it.
 		QPS: 1e6,
 		// High enough Burst to fit all expected use cases. Burst=0 is not set here, because client code is overriding it.
-		Burst:        1e6,
-		ResyncPeriod: 10 * time.Minute,
+		Burst:          1e6,
+		ResyncPeriod:   10 * time.Minute,
+		GCPeriod:       time.Hour,
+		MaxNumRequeues: 5,
+		NumThreads:     2,
+		ConflictPolicy: string(syncer.ConflictPolicyOverwrite),
+
+		ContextNamespaceResyncPeriod: 10 * time.Minute,
+
+		MaxParallelWrites:           syncer.DefaultMaxParallelWrites,
+		MaxParallelWritesPerCluster: syncer.DefaultMaxParallelWritesPerCluster,
 	}
 }
 
 func (s *OperatorOptions) AddFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&s.ClusterName, "cluster-name", s.ClusterName, "Name of cluster")
 	fs.StringVar(&s.ConfigSourceNamespace, "config-source-namespace", s.ConfigSourceNamespace, "Config source namespace")
-	fs.StringVar(&s.KubeConfigFile, "kubeconfig-file", s.KubeConfigFile, "kubeconfig file")
+	fs.StringVar(&s.OperatorNamespace, "operator-namespace", s.OperatorNamespace, "Namespace RemoteClusters and the Secrets holding their kubeconfig files are read from")
+	fs.StringVar(&s.KubeConfigFile, "kubeconfig-file", s.KubeConfigFile, "kubeconfig file with contexts of other clusters, reloaded when it changes")
 
 	fs.Float32Var(&s.QPS, "qps", s.QPS, "The maximum QPS to the master from this client")
 	fs.IntVar(&s.Burst, "burst", s.Burst, "The maximum burst for throttle")
 	fs.DurationVar(&s.ResyncPeriod, "resync-period", s.ResyncPeriod, "If non-zero, will re-list this often. Otherwise, re-list will be delayed aslong as possible (until the upstream source closes the watch or times out.")
+	fs.DurationVar(&s.ContextNamespaceResyncPeriod, "context-namespace-resync-period", s.ContextNamespaceResyncPeriod, "How often sources selecting namespaces of other clusters are synced again, as namespaces of other clusters are not watched. If zero, they are only synced when they change.")
+	fs.DurationVar(&s.GCPeriod, "gc-period", s.GCPeriod, "How often orphaned copies are garbage collected. If zero, orphaned copies are only collected at startup.")
+	fs.IntVar(&s.MaxNumRequeues, "max-num-requeues", s.MaxNumRequeues, "Maximum number of times a failed sync is retried with exponential backoff before it is dropped")
+	fs.IntVar(&s.NumThreads, "num-threads", s.NumThreads, "Number of workers processing each sync queue")
+	fs.IntVar(&s.MaxParallelWrites, "max-parallel-writes", s.MaxParallelWrites, "Maximum number of copies written or deleted in parallel, across all sources and clusters")
+	fs.IntVar(&s.MaxParallelWritesPerCluster, "max-parallel-writes-per-cluster", s.MaxParallelWritesPerCluster, "Maximum number of copies written or deleted in parallel in each cluster, so that a slow cluster does not take every slot")
+	fs.StringArrayVar(&s.SyncResources, "sync-resource", s.SyncResources, "Additional namespaced resource to sync, in the form resource.version[.group][=field,...], eg. networkpolicies.v1.networking.k8s.io=spec. Fields are dot separated paths of the copied fields. If omitted, every field but metadata and status is copied. Can be repeated.")
+	fs.StringVar(&s.ConflictPolicy, "conflict-policy", s.ConflictPolicy, "How to handle objects in target namespaces that are not managed by config-syncer: skip, overwrite or adopt. Can be overridden per source using the kubed.appscode.com/sync-conflict-policy annotation.")
 }
 
 func (s *OperatorOptions) ApplyTo(cfg *operator.OperatorConfig) error {
@@ -65,15 +100,42 @@ func (s *OperatorOptions) ApplyTo(cfg *operator.OperatorConfig) error {
 	cfg.ClientConfig.QPS = s.QPS
 	cfg.ClientConfig.Burst = s.Burst
 	cfg.ResyncPeriod = s.ResyncPeriod
+	cfg.ContextNamespaceResyncPeriod = s.ContextNamespaceResyncPeriod
+	cfg.GCPeriod = s.GCPeriod
+	cfg.MaxNumRequeues = s.MaxNumRequeues
+	cfg.NumThreads = s.NumThreads
+	cfg.MaxParallelWrites = s.MaxParallelWrites
+	cfg.MaxParallelWritesPerCluster = s.MaxParallelWritesPerCluster
+	if cfg.ConflictPolicy, err = syncer.ParseConflictPolicy(s.ConflictPolicy); err != nil {
+		return err
+	}
+	cfg.Resources = nil
+	for _, v := range s.SyncResources {
+		rule, err := syncer.ParseResourceRule(v)
+		if err != nil {
+			return err
+		}
+		cfg.Resources = append(cfg.Resources, rule)
+	}
 	cfg.Test = false
 
 	if cfg.KubeClient, err = kubernetes.NewForConfig(cfg.ClientConfig); err != nil {
 		return err
 	}
+	if cfg.DynamicClient, err = dynamic.NewForConfig(cfg.ClientConfig); err != nil {
+		return err
+	}
+	if cfg.KubedClient, err = kubed_cs.NewForConfig(cfg.ClientConfig); err != nil {
+		return err
+	}
+	if cfg.CRDClient, err = crd_cs.NewForConfig(cfg.ClientConfig); err != nil {
+		return err
+	}
 
 	cfg.ClusterName = s.ClusterName
 	cfg.ConfigSourceNamespace = s.ConfigSourceNamespace
 	cfg.KubeConfigFile = s.KubeConfigFile
+	cfg.OperatorNamespace = s.OperatorNamespace
 
 	return nil
 }
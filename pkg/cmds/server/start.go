@@ -21,11 +21,13 @@ import (
 	"io"
 	"net"
 
+	"kubeops.dev/config-syncer/pkg/eventer"
 	"kubeops.dev/config-syncer/pkg/operator"
 	"kubeops.dev/config-syncer/pkg/server"
 
 	"github.com/pkg/errors"
 	"github.com/spf13/pflag"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apiserver/pkg/features"
 	genericapiserver "k8s.io/apiserver/pkg/server"
 	genericoptions "k8s.io/apiserver/pkg/server/options"
@@ -36,8 +38,9 @@ import (
 const defaultEtcdPathPrefix = "/registry/kubed.appscode.com"
 
 type ConfigSyncerOptions struct {
-	RecommendedOptions *genericoptions.RecommendedOptions
-	OperatorOptions    *OperatorOptions
+	RecommendedOptions    *genericoptions.RecommendedOptions
+	OperatorOptions       *OperatorOptions
+	LeaderElectionOptions *LeaderElectionOptions
 
 	StdOut io.Writer
 	StdErr io.Writer
@@ -51,9 +54,10 @@ func NewConfigSyncerOptions(out, errOut io.Writer) *ConfigSyncerOptions {
 			defaultEtcdPathPrefix,
 			server.Codecs.LegacyCodec(),
 		),
-		OperatorOptions: NewOperatorOptions(),
-		StdOut:          out,
-		StdErr:          errOut,
+		OperatorOptions:       NewOperatorOptions(),
+		LeaderElectionOptions: NewLeaderElectionOptions(),
+		StdOut:                out,
+		StdErr:                errOut,
 	}
 	o.RecommendedOptions.Etcd = nil
 	o.RecommendedOptions.Admission = nil
@@ -64,10 +68,11 @@ func NewConfigSyncerOptions(out, errOut io.Writer) *ConfigSyncerOptions {
 func (o *ConfigSyncerOptions) AddFlags(fs *pflag.FlagSet) {
 	o.RecommendedOptions.AddFlags(fs)
 	o.OperatorOptions.AddFlags(fs)
+	o.LeaderElectionOptions.AddFlags(fs)
 }
 
 func (o ConfigSyncerOptions) Validate(args []string) error {
-	return nil
+	return utilerrors.NewAggregate(o.LeaderElectionOptions.Validate())
 }
 
 func (o *ConfigSyncerOptions) Complete() error {
@@ -91,9 +96,16 @@ func (o ConfigSyncerOptions) Config() (*server.ConfigSyncerConfig, error) {
 		return nil, err
 	}
 
+	recorder := eventer.NewEventRecorder(operatorConfig.KubeClient, "config-syncer")
+	leaderElection, err := o.LeaderElectionOptions.LeaderElectionConfig(serverConfig.ClientConfig, recorder)
+	if err != nil {
+		return nil, err
+	}
+
 	config := &server.ConfigSyncerConfig{
 		GenericConfig:  serverConfig,
 		OperatorConfig: operatorConfig,
+		LeaderElection: leaderElection,
 	}
 	return config, nil
 }
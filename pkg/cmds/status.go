@@ -0,0 +1,181 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"kubeops.dev/config-syncer/pkg/syncer"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func NewCmdStatus(out io.Writer) *cobra.Command {
+	o := newClusterOptions()
+
+	cmd := &cobra.Command{
+		Use:   "status (configmap/NAME | secret/NAME)",
+		Short: "Show the copies of a source and whether they are up to date",
+		Long: `Show every copy of a source in the source cluster and in the contexts of the kubeconfig file.
+
+Copies are found by their origin labels. For each copy, the source resourceVersion recorded in its
+origin annotation and its data are compared with the current source. Copies that are selected but
+do not exist are listed as Missing, copies that are no longer selected as Orphaned.`,
+		Example: `  # show the copies of a secret
+  config-syncer status secret/registry-auth -n demo --kubeconfig-file=/srv/kubed/kubeconfig
+
+  # show the copies of a configmap as JSON
+  config-syncer status configmap/omni -n demo -o json`,
+		Args:              cobra.ExactArgs(1),
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, namespace, err := o.newSyncer()
+			if err != nil {
+				return err
+			}
+			status, err := sourceStatus(s, namespace, args[0])
+			if err != nil {
+				return err
+			}
+			return o.print(out, status, func(w io.Writer) error {
+				return printStatus(w, status)
+			})
+		},
+	}
+	o.addFlags(cmd.Flags())
+
+	return cmd
+}
+
+func sourceStatus(s *syncer.ConfigSyncer, namespace string, arg string) (*syncer.SourceStatus, error) {
+	if namespace == metav1.NamespaceAll {
+		return nil, errors.New("a namespace is required to show the status of a source")
+	}
+	kind, name, err := parseSource(arg)
+	if err != nil {
+		return nil, err
+	}
+	kc := s.KubeClient()
+	switch kind {
+	case "configmap":
+		src, err := kc.CoreV1().ConfigMaps(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return s.ConfigMapStatus(src)
+	default:
+		src, err := kc.CoreV1().Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return s.SecretStatus(src)
+	}
+}
+
+func printStatus(out io.Writer, status *syncer.SourceStatus) error {
+	_, _ = fmt.Fprintf(out, "%s %s/%s, resourceVersion %s\n", status.Kind, status.Namespace, status.Name, status.ResourceVersion)
+	if st := status.SyncStatus; st != nil {
+		_, _ = fmt.Fprintf(out, "Last synced resourceVersion %s", st.ObservedResourceVersion)
+		if st.LastSyncTime != nil {
+			_, _ = fmt.Fprintf(out, " at %s", st.LastSyncTime.UTC().Format(time.RFC3339))
+		}
+		_, _ = fmt.Fprintf(out, " into %d namespace(s) and %d context(s)\n", len(st.Namespaces), len(st.Contexts))
+		if st.Error != "" || len(st.Errors) > 0 {
+			_, _ = fmt.Fprintln(out, "Last sync failed, see the sync status annotation of the source")
+		}
+	}
+	_, _ = fmt.Fprintln(out)
+
+	if len(status.Copies) == 0 {
+		_, _ = fmt.Fprintln(out, "No copies found.")
+	} else {
+		w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+		_, _ = fmt.Fprintln(w, "CONTEXT\tNAMESPACE\tNAME\tSTATE\tSOURCE-VERSION\tVERSION-MATCH\tDATA-MATCH\tKEYS")
+		for _, c := range status.Copies {
+			ctx := c.Context
+			if ctx == "" {
+				ctx = "-"
+			}
+			rv := c.SourceResourceVersion
+			if rv == "" {
+				rv = "-"
+			}
+			keys := "-"
+			if len(c.ChangedKeys) > 0 {
+				keys = strings.Join(c.ChangedKeys, ",")
+			}
+			compared := c.State != syncer.CopyStateMissing && c.State != syncer.CopyStateConflict && c.Error == ""
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", ctx, c.Namespace, c.Name, c.State, rv,
+				yesNo(c.State != syncer.CopyStateMissing && c.State != syncer.CopyStateConflict, c.ResourceVersionMatches),
+				yesNo(compared, c.DataMatches), keys)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	var copyErrors []string
+	for _, c := range status.Copies {
+		if c.Error == "" {
+			continue
+		}
+		target := "namespace " + c.Namespace
+		if c.Context != "" {
+			target += " of context " + c.Context
+		}
+		copyErrors = append(copyErrors, target+": "+c.Error)
+	}
+	if len(status.Errors) > 0 || len(copyErrors) > 0 {
+		_, _ = fmt.Fprintln(out, "\nErrors:")
+		contexts := make([]string, 0, len(status.Errors))
+		for ctx := range status.Errors {
+			contexts = append(contexts, ctx)
+		}
+		sort.Strings(contexts)
+		for _, ctx := range contexts {
+			name := ctx
+			if name == "" {
+				name = "source cluster"
+			}
+			_, _ = fmt.Fprintf(out, "  %s: %s\n", name, status.Errors[ctx])
+		}
+		for _, e := range copyErrors {
+			_, _ = fmt.Fprintf(out, "  %s\n", e)
+		}
+	}
+	return nil
+}
+
+// yesNo formats b, or "-" when it does not apply
+func yesNo(applies, b bool) string {
+	switch {
+	case !applies:
+		return "-"
+	case b:
+		return "yes"
+	default:
+		return "no"
+	}
+}
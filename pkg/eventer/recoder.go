@@ -29,7 +29,22 @@ import (
 
 const (
 	// Syncer Events
-	EventReasonOriginConflict = "OriginConflict"
+	EventReasonOriginConflict       = "OriginConflict"
+	EventReasonOrphanDeleted        = "OrphanDeleted"
+	EventReasonTemplateRenderFailed = "TemplateRenderFailed"
+	EventReasonCopyConflict         = "CopyConflict"
+	EventReasonCopyAdopted          = "CopyAdopted"
+	EventReasonCopyCreated          = "CopyCreated"
+	EventReasonCopyUpdated          = "CopyUpdated"
+	EventReasonCopyDeleted          = "CopyDeleted"
+	EventReasonSyncSucceeded        = "SyncSucceeded"
+	EventReasonSyncFailed           = "SyncFailed"
+	EventReasonInvalidSelector      = "InvalidSelector"
+	EventReasonInvalidKeyPattern    = "InvalidKeyPattern"
+	EventReasonUnknownContext       = "UnknownContext"
+	EventReasonContextRefused       = "ContextRefused"
+	EventReasonNamespaceCreated     = "NamespaceCreated"
+	EventReasonNamespacePruned      = "NamespacePruned"
 )
 
 func NewEventRecorder(client kubernetes.Interface, component string) record.EventRecorder {
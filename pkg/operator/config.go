@@ -19,12 +19,20 @@ package operator
 import (
 	"time"
 
+	api "kubeops.dev/config-syncer/apis/kubed/v1alpha1"
+	kubed_cs "kubeops.dev/config-syncer/client/clientset/versioned"
+	kubedinformers "kubeops.dev/config-syncer/client/informers/externalversions"
 	"kubeops.dev/config-syncer/pkg/eventer"
 	"kubeops.dev/config-syncer/pkg/syncer"
 
+	"github.com/pkg/errors"
+	crd_cs "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"kmodules.xyz/client-go/apiextensions"
 	"kmodules.xyz/client-go/discovery"
 )
 
@@ -32,16 +40,31 @@ type Config struct {
 	ClusterName           string
 	ConfigSourceNamespace string
 	KubeConfigFile        string
+	OperatorNamespace     string
 
-	ResyncPeriod time.Duration
-	Test         bool
+	ResyncPeriod   time.Duration
+	GCPeriod       time.Duration
+	MaxNumRequeues int
+	NumThreads     int
+	ConflictPolicy syncer.ConflictPolicy
+	Resources      []syncer.ResourceRule
+	Test           bool
+
+	// how often sources selecting namespaces of other clusters are synced again
+	ContextNamespaceResyncPeriod time.Duration
+
+	MaxParallelWrites           int
+	MaxParallelWritesPerCluster int
 }
 
 type OperatorConfig struct {
 	Config
 
-	ClientConfig *rest.Config
-	KubeClient   kubernetes.Interface
+	ClientConfig  *rest.Config
+	KubeClient    kubernetes.Interface
+	DynamicClient dynamic.Interface
+	KubedClient   kubed_cs.Interface
+	CRDClient     crd_cs.Interface
 }
 
 func NewOperatorConfig(clientConfig *rest.Config) *OperatorConfig {
@@ -55,14 +78,39 @@ func (c *OperatorConfig) New() (*Operator, error) {
 		return nil, err
 	}
 
+	if err := validateResources(c.KubeClient, c.Resources); err != nil {
+		return nil, err
+	}
+
+	crds := []*apiextensions.CustomResourceDefinition{
+		api.ConfigSync{}.CustomResourceDefinition(),
+		api.RemoteCluster{}.CustomResourceDefinition(),
+	}
+	if err := apiextensions.RegisterCRDs(c.CRDClient, crds); err != nil {
+		return nil, err
+	}
+
 	op := &Operator{
-		Config:       c.Config,
-		ClientConfig: c.ClientConfig,
-		KubeClient:   c.KubeClient,
+		Config:        c.Config,
+		ClientConfig:  c.ClientConfig,
+		KubeClient:    c.KubeClient,
+		DynamicClient: c.DynamicClient,
+		KubedClient:   c.KubedClient,
 	}
 
 	op.recorder = eventer.NewEventRecorder(op.KubeClient, "config-syncer")
-	op.configSyncer = syncer.New(op.KubeClient, op.recorder)
+	op.configSyncer = syncer.New(op.KubeClient, op.DynamicClient, op.KubedClient, op.recorder, syncer.Options{
+		MaxNumRequeues: c.MaxNumRequeues,
+		NumThreads:     c.NumThreads,
+		ConflictPolicy: c.ConflictPolicy,
+		Resources:      c.Resources,
+
+		ContextNamespaceResyncPeriod: c.ContextNamespaceResyncPeriod,
+
+		MaxParallelWrites:           c.MaxParallelWrites,
+		MaxParallelWritesPerCluster: c.MaxParallelWritesPerCluster,
+		SourceNamespace:             c.ConfigSourceNamespace,
+	})
 
 	if err := op.Configure(); err != nil {
 		return nil, err
@@ -70,12 +118,39 @@ func (c *OperatorConfig) New() (*Operator, error) {
 
 	// ---------------------------
 	op.kubeInformerFactory = informers.NewSharedInformerFactory(op.KubeClient, c.ResyncPeriod)
+	op.dynamicInformerFactory = dynamicinformer.NewFilteredDynamicSharedInformerFactory(op.DynamicClient, c.ResyncPeriod, c.ConfigSourceNamespace, nil)
+	op.kubedInformerFactory = kubedinformers.NewSharedInformerFactoryWithOptions(op.KubedClient, c.ResyncPeriod, kubedinformers.WithNamespace(c.ConfigSourceNamespace))
+	// RemoteClusters and their Secrets are only read from the operator namespace
+	op.operatorInformerFactory = informers.NewSharedInformerFactoryWithOptions(op.KubeClient, c.ResyncPeriod, informers.WithNamespace(c.OperatorNamespace))
+	op.remoteClusterInformerFactory = kubedinformers.NewSharedInformerFactoryWithOptions(op.KubedClient, c.ResyncPeriod, kubedinformers.WithNamespace(c.OperatorNamespace))
 	// ---------------------------
-	op.setupConfigInformers()
-	// ---------------------------
-
-	if err := op.Configure(); err != nil {
+	if err := op.setupConfigInformers(); err != nil {
 		return nil, err
 	}
+	// ---------------------------
 	return op, nil
 }
+
+// validateResources checks that the resources to be synced are served and namespaced
+func validateResources(kc kubernetes.Interface, rules []syncer.ResourceRule) error {
+	for _, rule := range rules {
+		list, err := kc.Discovery().ServerResourcesForGroupVersion(rule.GVR.GroupVersion().String())
+		if err != nil {
+			return errors.Wrapf(err, "failed to discover resource %s", rule.GVR)
+		}
+		found := false
+		for _, r := range list.APIResources {
+			if r.Name == rule.GVR.Resource {
+				if !r.Namespaced {
+					return errors.Errorf("resource %s is not namespaced", rule.GVR)
+				}
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errors.Errorf("resource %s is not served by the cluster", rule.GVR)
+		}
+	}
+	return nil
+}
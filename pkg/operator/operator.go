@@ -19,6 +19,8 @@ package operator
 import (
 	"time"
 
+	kubed_cs "kubeops.dev/config-syncer/client/clientset/versioned"
+	kubedinformers "kubeops.dev/config-syncer/client/informers/externalversions"
 	"kubeops.dev/config-syncer/pkg/syncer"
 
 	"github.com/pkg/errors"
@@ -26,6 +28,9 @@ import (
 	_ "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/typed/apiextensions/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
 	"k8s.io/client-go/informers"
 	core_informers "k8s.io/client-go/informers/core/v1"
 	"k8s.io/client-go/kubernetes"
@@ -46,6 +51,15 @@ type Operator struct {
 
 	KubeClient          kubernetes.Interface
 	kubeInformerFactory informers.SharedInformerFactory
+
+	DynamicClient          dynamic.Interface
+	dynamicInformerFactory dynamicinformer.DynamicSharedInformerFactory
+
+	KubedClient          kubed_cs.Interface
+	kubedInformerFactory kubedinformers.SharedInformerFactory
+
+	operatorInformerFactory      informers.SharedInformerFactory
+	remoteClusterInformerFactory kubedinformers.SharedInformerFactory
 }
 
 func (op *Operator) Configure() error {
@@ -54,35 +68,64 @@ func (op *Operator) Configure() error {
 	return op.configSyncer.Configure(op.Config.ClusterName, op.Config.KubeConfigFile)
 }
 
-func (op *Operator) setupConfigInformers() {
+func (op *Operator) setupConfigInformers() error {
+	// sources are found by their sync annotation and copies by their origin labels
+	indexers := syncer.SourceIndexers()
+	indexers[cache.NamespaceIndex] = cache.MetaNamespaceIndexFunc
+
 	configMapInformer := op.kubeInformerFactory.InformerFor(&core.ConfigMap{}, func(client kubernetes.Interface, resyncPeriod time.Duration) cache.SharedIndexInformer {
 		return core_informers.NewFilteredConfigMapInformer(
 			client,
 			op.Config.ConfigSourceNamespace,
 			resyncPeriod,
-			cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
+			indexers,
 			func(options *metav1.ListOptions) {},
 		)
 	})
-	configMapInformer.AddEventHandler(op.configSyncer.ConfigMapHandler())
+	configMapInformer.AddEventHandler(op.configSyncer.ConfigMapHandler(configMapInformer.GetIndexer()))
 
 	secretInformer := op.kubeInformerFactory.InformerFor(&core.Secret{}, func(client kubernetes.Interface, resyncPeriod time.Duration) cache.SharedIndexInformer {
 		return core_informers.NewFilteredSecretInformer(
 			client,
 			op.Config.ConfigSourceNamespace,
 			resyncPeriod,
-			cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
+			indexers,
 			func(options *metav1.ListOptions) {},
 		)
 	})
-	secretInformer.AddEventHandler(op.configSyncer.SecretHandler())
+	secretInformer.AddEventHandler(op.configSyncer.SecretHandler(secretInformer.GetIndexer()))
+
+	nsInformer := op.kubeInformerFactory.Core().V1().Namespaces()
+	nsInformer.Informer().AddEventHandler(op.configSyncer.NamespaceHandler(nsInformer.Lister()))
 
-	nsInformer := op.kubeInformerFactory.Core().V1().Namespaces().Informer()
-	nsInformer.AddEventHandler(op.configSyncer.NamespaceHandler())
+	csInformer := op.kubedInformerFactory.Kubed().V1alpha1().ConfigSyncs().Informer()
+	if err := csInformer.AddIndexers(cache.Indexers{syncer.ConfigSyncSourceIndex: syncer.ConfigSyncSourceIndexFunc}); err != nil {
+		return err
+	}
+	csInformer.AddEventHandler(op.configSyncer.ConfigSyncHandler(csInformer.GetIndexer()))
+
+	rcInformer := op.remoteClusterInformerFactory.Kubed().V1alpha1().RemoteClusters()
+	kubeconfigSecretInformer := op.operatorInformerFactory.Core().V1().Secrets()
+	rcHandler, kubeconfigSecretHandler := op.configSyncer.RemoteClusterHandler(rcInformer.Lister(), kubeconfigSecretInformer.Lister())
+	rcInformer.Informer().AddEventHandler(rcHandler)
+	kubeconfigSecretInformer.Informer().AddEventHandler(kubeconfigSecretHandler)
+
+	for _, rule := range op.Config.Resources {
+		informer := op.dynamicInformerFactory.ForResource(rule.GVR).Informer()
+		if err := informer.AddIndexers(syncer.SourceIndexers()); err != nil {
+			return err
+		}
+		informer.AddEventHandler(op.configSyncer.ResourceHandler(rule.GVR, informer.GetIndexer()))
+	}
+	return nil
 }
 
 func (op *Operator) Run(stopCh <-chan struct{}) {
 	op.kubeInformerFactory.Start(stopCh)
+	op.kubedInformerFactory.Start(stopCh)
+	op.dynamicInformerFactory.Start(stopCh)
+	op.operatorInformerFactory.Start(stopCh)
+	op.remoteClusterInformerFactory.Start(stopCh)
 
 	res := op.kubeInformerFactory.WaitForCacheSync(stopCh)
 	for _, v := range res {
@@ -91,7 +134,45 @@ func (op *Operator) Run(stopCh <-chan struct{}) {
 			return
 		}
 	}
+	for _, v := range op.kubedInformerFactory.WaitForCacheSync(stopCh) {
+		if !v {
+			runtime.HandleError(errors.Errorf("timed out waiting for caches to sync"))
+			return
+		}
+	}
+	for _, v := range op.dynamicInformerFactory.WaitForCacheSync(stopCh) {
+		if !v {
+			runtime.HandleError(errors.Errorf("timed out waiting for caches to sync"))
+			return
+		}
+	}
+	for _, v := range op.operatorInformerFactory.WaitForCacheSync(stopCh) {
+		if !v {
+			runtime.HandleError(errors.Errorf("timed out waiting for caches to sync"))
+			return
+		}
+	}
+	for _, v := range op.remoteClusterInformerFactory.WaitForCacheSync(stopCh) {
+		if !v {
+			runtime.HandleError(errors.Errorf("timed out waiting for caches to sync"))
+			return
+		}
+	}
+
+	op.configSyncer.Run(stopCh)
+
+	if op.GCPeriod > 0 {
+		go wait.Until(op.collectGarbage, op.GCPeriod, stopCh)
+	} else {
+		go op.collectGarbage()
+	}
 
 	<-stopCh
 	klog.Infoln("Stopping config-syncer controller")
 }
+
+func (op *Operator) collectGarbage() {
+	if err := op.configSyncer.CollectGarbage(); err != nil {
+		klog.Errorln(err)
+	}
+}
@@ -17,6 +17,9 @@ limitations under the License.
 package server
 
 import (
+	"context"
+	"time"
+
 	"kubeops.dev/config-syncer/pkg/operator"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -25,6 +28,8 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/serializer"
 	"k8s.io/apimachinery/pkg/version"
 	genericapiserver "k8s.io/apiserver/pkg/server"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/klog/v2"
 )
 
 var (
@@ -53,22 +58,60 @@ func init() {
 type ConfigSyncerConfig struct {
 	GenericConfig  *genericapiserver.RecommendedConfig
 	OperatorConfig *operator.OperatorConfig
+	// nil if leader election is disabled, callbacks are set by the server
+	LeaderElection *leaderelection.LeaderElectionConfig
 }
 
 // ConfigSyncerServer contains state for a Kubernetes cluster daemon.
 type ConfigSyncerServer struct {
 	GenericAPIServer *genericapiserver.GenericAPIServer
 	Operator         *operator.Operator
+
+	leaderElection *leaderelection.LeaderElectionConfig
 }
 
 func (op *ConfigSyncerServer) Run(stopCh <-chan struct{}) error {
-	go op.Operator.Run(stopCh)
+	if op.leaderElection == nil {
+		go op.Operator.Run(stopCh)
+	} else {
+		go runLeaderElection(*op.leaderElection, op.Operator.Run, stopCh)
+	}
 	return op.GenericAPIServer.PrepareRun().Run(stopCh)
 }
 
+// runLeaderElection calls run, which starts the controllers, once this replica holds the lease of lec. Informer
+// caches and queues can not be handed over cleanly, so the process exits once leadership is lost.
+func runLeaderElection(lec leaderelection.LeaderElectionConfig, run func(stopCh <-chan struct{}), stopCh <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stopCh
+		cancel()
+	}()
+
+	lec.Callbacks = leaderelection.LeaderCallbacks{
+		OnStartedLeading: func(ctx context.Context) {
+			klog.Infoln("started leading, starting config-syncer controller")
+			run(ctx.Done())
+		},
+		OnStoppedLeading: func() {
+			select {
+			case <-stopCh:
+				klog.Infoln("released leadership")
+			default:
+				klog.Fatalln("leader election lost")
+			}
+		},
+		OnNewLeader: func(identity string) {
+			klog.Infof("current leader is %s", identity)
+		},
+	}
+	leaderelection.RunOrDie(ctx, lec)
+}
+
 type completedConfig struct {
 	GenericConfig  genericapiserver.CompletedConfig
 	OperatorConfig *operator.OperatorConfig
+	LeaderElection *leaderelection.LeaderElectionConfig
 }
 
 type CompletedConfig struct {
@@ -81,6 +124,7 @@ func (c *ConfigSyncerConfig) Complete() CompletedConfig {
 	completedCfg := completedConfig{
 		c.GenericConfig.Complete(),
 		c.OperatorConfig,
+		c.LeaderElection,
 	}
 
 	completedCfg.GenericConfig.Version = &version.Info{
@@ -106,6 +150,15 @@ func (c completedConfig) New() (*ConfigSyncerServer, error) {
 		GenericAPIServer: genericServer,
 		Operator:         operator,
 	}
+	if c.LeaderElection != nil {
+		// reports unhealthy if this replica leads but fails to renew the lease
+		lec := *c.LeaderElection
+		lec.WatchDog = leaderelection.NewLeaderHealthzAdaptor(20 * time.Second)
+		if err := genericServer.AddHealthChecks(lec.WatchDog); err != nil {
+			return nil, err
+		}
+		s.leaderElection = &lec
+	}
 
 	return s, nil
 }
@@ -0,0 +1,104 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	coordination "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// the controllers only start once this replica holds the lease, and stop when it is released
+func TestRunLeaderElection(t *testing.T) {
+	other := "other"
+	now := metav1.NewMicroTime(time.Now())
+	kc := fake.NewSimpleClientset(&coordination.Lease{
+		ObjectMeta: metav1.ObjectMeta{Name: "config-syncer", Namespace: "kube-system"},
+		Spec: coordination.LeaseSpec{
+			HolderIdentity: &other,
+			AcquireTime:    &now,
+			RenewTime:      &now,
+		},
+	})
+	lec := leaderelection.LeaderElectionConfig{
+		Lock: &resourcelock.LeaseLock{
+			LeaseMeta:  metav1.ObjectMeta{Name: "config-syncer", Namespace: "kube-system"},
+			Client:     kc.CoordinationV1(),
+			LockConfig: resourcelock.ResourceLockConfig{Identity: "self"},
+		},
+		LeaseDuration:   time.Minute,
+		RenewDeadline:   time.Second,
+		RetryPeriod:     10 * time.Millisecond,
+		ReleaseOnCancel: true,
+		Name:            "config-syncer",
+	}
+
+	started, stopped := make(chan struct{}), make(chan struct{})
+	run := func(stopCh <-chan struct{}) {
+		close(started)
+		<-stopCh
+		close(stopped)
+	}
+	stopCh, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		runLeaderElection(lec, run, stopCh)
+		close(done)
+	}()
+
+	select {
+	case <-started:
+		t.Fatal("controllers started while another replica holds the lease")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// the other replica releases the lease
+	lease, err := kc.CoordinationV1().Leases("kube-system").Get(context.TODO(), "config-syncer", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lease.Spec.HolderIdentity = nil
+	if _, err := kc.CoordinationV1().Leases("kube-system").Update(context.TODO(), lease, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("controllers not started after the lease was released")
+	}
+	lease, err = kc.CoordinationV1().Leases("kube-system").Get(context.TODO(), "config-syncer", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != "self" {
+		t.Errorf("lease held by %v, want self", lease.Spec.HolderIdentity)
+	}
+
+	close(stopCh)
+	for _, ch := range []chan struct{}{stopped, done} {
+		select {
+		case <-ch:
+		case <-time.After(5 * time.Second):
+			t.Fatal("controllers not stopped")
+		}
+	}
+}
@@ -0,0 +1,216 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"reflect"
+
+	api "kubeops.dev/config-syncer/apis/kubed/v1alpha1"
+
+	"github.com/pkg/errors"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// AgentOptions configure a syncer running in a target cluster, which pulls the sources of a hub
+// cluster instead of the hub pushing copies into it
+type AgentOptions struct {
+	// name of the cluster of the agent, as listed in the sync-contexts annotation and in ConfigSyncs
+	ClusterName string
+	// labels of the cluster of the agent, matched by cluster selectors of sources
+	ClusterLabels map[string]string
+	// namespace copies are created in, like the namespace of a context. If empty, the namespace of the source is used.
+	Namespace string
+
+	// clients of the cluster of the agent
+	Client        kubernetes.Interface
+	DynamicClient dynamic.Interface
+}
+
+// agentConfig restricts the sources of the hub to the ones pulled by an agent
+type agentConfig struct {
+	clusterName   string
+	clusterLabels labels.Set
+}
+
+// restrict drops every target other than the cluster of the agent from opts. The cluster is
+// selected by name, via the contexts of the source, or by labels, via its cluster selector.
+func (a *agentConfig) restrict(opts SyncOptions) SyncOptions {
+	selected := opts.Contexts.Has(a.clusterName)
+	if !selected && opts.ClusterSelector != nil {
+		if selector, err := labels.Parse(*opts.ClusterSelector); err != nil {
+			klog.Warningf("ignoring invalid cluster selector %q: %v", *opts.ClusterSelector, err)
+		} else {
+			selected = selector.Matches(a.clusterLabels)
+		}
+	}
+
+	// the namespaces of the hub are synced by the operator running there
+	opts.NamespaceSelector = nil
+	opts.Namespaces = nil
+	opts.Contexts = sets.NewString()
+	if selected {
+		opts.Contexts.Insert(a.clusterName)
+	}
+	return opts
+}
+
+// ConfigureAgent turns s into an agent. The clients s was created with must be those of the hub
+// cluster, they are only used to read sources and ConfigSyncs. Copies are written into the cluster
+// of opts, using hubClusterName in their origin labels. hubClusterName must match the cluster name of
+// the operator running in the hub, if any, which is empty by default.
+func (s *ConfigSyncer) ConfigureAgent(hubClusterName string, opts AgentOptions) error {
+	if opts.ClusterName == "" {
+		return errors.New("cluster name of the agent is required")
+	}
+	hubID, err := ClusterID(s.kubeClient)
+	if err != nil {
+		return errors.Wrap(err, "hub cluster")
+	}
+	local := clusterContext{
+		Client:        opts.Client,
+		DynamicClient: opts.DynamicClient,
+		Namespace:     opts.Namespace,
+		Address:       "local",
+	}
+	localID, err := s.contextID(local)
+	if err != nil {
+		return err
+	}
+	if localID == hubID {
+		return errors.New("agent must not run in the hub cluster")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.clusterName = hubClusterName
+	s.clusterID = hubID
+	s.agent = &agentConfig{
+		clusterName:   opts.ClusterName,
+		clusterLabels: labels.Set(opts.ClusterLabels),
+	}
+	s.fileContexts = nil
+	s.remoteClusters = nil
+	s.contexts = map[string]clusterContext{opts.ClusterName: local}
+	return nil
+}
+
+// pullConfigMap syncs a ConfigMap of the hub into the cluster of the agent. src is nil if the ConfigMap was deleted.
+func (s *ConfigSyncer) pullConfigMap(namespace, name string, src *core.ConfigMap) error {
+	if src == nil {
+		deleted := &core.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         namespace,
+				DeletionTimestamp: deletedAt(),
+			},
+		}
+		s.forgetAttempt(resourceConfigMaps, deleted)
+		return s.syncIntoContexts(configMapCopier{s}, deleted, sets.NewString())
+	}
+	opts := s.syncOptionsFor(api.SourceKindConfigMap, src)
+	return s.syncAndRecord(resourceConfigMaps, src, opts, func(src object) error {
+		if err := s.checkKeys(src, opts); err != nil {
+			return err
+		}
+		return s.syncIntoContexts(configMapCopier{s}, src, opts.Contexts)
+	})
+}
+
+// pullSecret syncs a Secret of the hub into the cluster of the agent. src is nil if the Secret was deleted.
+func (s *ConfigSyncer) pullSecret(namespace, name string, src *core.Secret) error {
+	if src == nil {
+		deleted := &core.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         namespace,
+				DeletionTimestamp: deletedAt(),
+			},
+		}
+		s.forgetAttempt(resourceSecrets, deleted)
+		return s.syncIntoContexts(secretCopier{s}, deleted, sets.NewString())
+	}
+	opts := s.syncOptionsFor(api.SourceKindSecret, src)
+	return s.syncAndRecord(resourceSecrets, src, opts, func(src object) error {
+		if err := s.checkKeys(src, opts); err != nil {
+			return err
+		}
+		return s.syncIntoContexts(secretCopier{s}, src, opts.Contexts)
+	})
+}
+
+// AgentNamespaceHandler queues the pulled sources that may get copies in a namespace of the cluster of the
+// agent whenever the namespace is added or its labels or annotations change, as they decide which namespaces
+// get copies. Namespaces listed before synced returns true are skipped, every source is queued by its own
+// informer and pulled once the namespaces are cached.
+func (s *ConfigSyncer) AgentNamespaceHandler(synced cache.InformerSynced) cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if ns, ok := obj.(*core.Namespace); ok && synced() {
+				s.enqueueNamespaceSources(ns)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldNs, ok := oldObj.(*core.Namespace)
+			if !ok {
+				return
+			}
+			newNs, ok := newObj.(*core.Namespace)
+			if !ok {
+				return
+			}
+			if !reflect.DeepEqual(oldNs.Labels, newNs.Labels) || !reflect.DeepEqual(oldNs.Annotations, newNs.Annotations) {
+				s.enqueueNamespaceSources(oldNs, newNs)
+			}
+		},
+	}
+}
+
+// enqueueNamespaceSources queues the pulled sources that may get copies in any version of a namespace
+func (s *ConfigSyncer) enqueueNamespaceSources(versions ...*core.Namespace) {
+	s.enqueueSourcesWhere(func(src metav1.Object, opts SyncOptions) bool {
+		for _, ctx := range opts.Contexts.List() {
+			for _, ns := range versions {
+				if s.mayTarget(src, opts, ctx, ns) {
+					return true
+				}
+			}
+		}
+		return false
+	})
+}
+
+// mayTarget checks whether namespace ns of context ctx is selected for copies of src, regardless of
+// the annotations of ns. Sources with an invalid selector match, so that the error is reported.
+func (s *ConfigSyncer) mayTarget(src metav1.Object, opts SyncOptions, ctx string, ns *core.Namespace) bool {
+	if v := opts.contextSelector(ctx); v != nil {
+		selector, err := labels.Parse(*v)
+		return err != nil || selector.Matches(labels.Set(ns.Labels))
+	}
+	namespace := s.contexts[ctx].Namespace
+	if namespace == "" {
+		namespace = src.GetNamespace()
+	}
+	return ns.Name == namespace
+}
@@ -0,0 +1,116 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"reflect"
+	"testing"
+
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestAgentNamespaceHandler(t *testing.T) {
+	source := func(namespace, name string, annotations map[string]string) *core.ConfigMap {
+		return &core.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Annotations: annotations}}
+	}
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, SourceIndexers())
+	for _, src := range []*core.ConfigMap{
+		source("a", "same", map[string]string{ConfigSyncContexts: "edge"}),
+		source("b", "other", map[string]string{ConfigSyncContexts: "edge"}),
+		source("demo", "web", map[string]string{ConfigSyncContexts: "edge", ConfigSyncContextSelector: "app=web"}),
+		source("a", "local", map[string]string{ConfigSyncKey: ""}),
+	} {
+		if err := indexer.Add(src); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := New(fake.NewSimpleClientset(), nil, nil, record.NewFakeRecorder(100), Options{})
+	s.agent = &agentConfig{clusterName: "edge"}
+	s.contexts = map[string]clusterContext{"edge": {}}
+	s.ConfigMapHandler(indexer)
+	synced := false
+	h := s.AgentNamespaceHandler(func() bool { return synced })
+
+	// queued returns the keys of the queued configmaps since the last call
+	queued := func() sets.String {
+		q := s.cmQueue.GetQueue()
+		keys := sets.NewString()
+		for q.Len() > 0 {
+			key, _ := q.Get()
+			keys.Insert(key.(string))
+			q.Done(key)
+		}
+		return keys
+	}
+	namespace := func(name string, labels, annotations map[string]string) *core.Namespace {
+		return &core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels, Annotations: annotations}}
+	}
+
+	h.OnAdd(namespace("a", nil, nil))
+	if got := queued(); got.Len() > 0 {
+		t.Errorf("namespace listed before sync queued %v, want none", got.List())
+	}
+
+	synced = true
+	steps := []struct {
+		name     string
+		old, new *core.Namespace
+		want     []string
+	}{
+		{name: "added namespace of source", new: namespace("a", nil, nil), want: []string{"a/same"}},
+		{name: "added unselected namespace", new: namespace("c", nil, nil)},
+		{
+			name: "labels now match selector",
+			old:  namespace("c", nil, nil),
+			new:  namespace("c", map[string]string{"app": "web"}, nil),
+			want: []string{"demo/web"},
+		},
+		{
+			name: "labels no longer match selector",
+			old:  namespace("c", map[string]string{"app": "web"}, nil),
+			new:  namespace("c", map[string]string{"app": "db"}, nil),
+			want: []string{"demo/web"},
+		},
+		{
+			name: "opted out",
+			old:  namespace("b", nil, nil),
+			new:  namespace("b", nil, map[string]string{NamespaceSyncOptOutKey: "true"}),
+			want: []string{"b/other"},
+		},
+		{
+			name: "unchanged",
+			old:  namespace("b", nil, nil),
+			new:  namespace("b", nil, nil),
+		},
+	}
+	for _, step := range steps {
+		if step.old == nil {
+			h.OnAdd(step.new)
+		} else {
+			h.OnUpdate(step.old, step.new)
+		}
+		if got := queued(); !reflect.DeepEqual(got, sets.NewString(step.want...)) {
+			t.Errorf("%s: queued %v, want %v", step.name, got.List(), step.want)
+		}
+	}
+}
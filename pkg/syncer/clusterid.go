@@ -0,0 +1,168 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"kubeops.dev/config-syncer/pkg/eventer"
+
+	"github.com/pkg/errors"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+// contextProbeTimeout bounds identifying and probing the cluster of a context, so that an unreachable
+// cluster does not hold up the others
+const contextProbeTimeout = 10 * time.Second
+
+// ClusterID returns the UID of the kube-system namespace, which identifies a cluster
+// no matter which address or proxy it is reached through
+func ClusterID(kc kubernetes.Interface) (string, error) {
+	ns, err := kc.CoreV1().Namespaces().Get(context.TODO(), metav1.NamespaceSystem, metav1.GetOptions{})
+	if err != nil {
+		return "", errors.Wrap(err, "failed to identify cluster")
+	}
+	return string(ns.UID), nil
+}
+
+// contextID returns the ID of the cluster of ctx. It is looked up once for the clients of ctx.
+func (s *ConfigSyncer) contextID(ctx clusterContext) (string, error) {
+	if ctx.err != nil {
+		return "", ctx.err
+	}
+	if v, ok := s.clusterIDs.Load(ctx.Client); ok {
+		return v.(string), nil
+	}
+	id, err := ClusterID(ctx.probeClient())
+	if err != nil {
+		return "", err
+	}
+	s.clusterIDs.Store(ctx.Client, id)
+	return id, nil
+}
+
+// probeClient returns the client identifying and probing the cluster of ctx
+func (ctx clusterContext) probeClient() kubernetes.Interface {
+	if ctx.probe != nil {
+		return ctx.probe
+	}
+	return ctx.Client
+}
+
+// forgetContextIDs drops the IDs looked up for clients that are no longer used by contexts
+func (s *ConfigSyncer) forgetContextIDs(contexts map[string]clusterContext) {
+	s.clusterIDs.Range(func(key, _ interface{}) bool {
+		found := false
+		for _, ctx := range contexts {
+			if ctx.Client == key {
+				found = true
+				break
+			}
+		}
+		if !found {
+			s.clusterIDs.Delete(key)
+		}
+		return true
+	})
+}
+
+// checkContexts identifies the clusters of the contexts a source syncs into, and returns the usable
+// contexts and the IDs of their clusters. Unknown contexts, contexts pointing at the source cluster and
+// contexts pointing at the same cluster as another one are refused, the returned error lists them.
+// Events are recorded on src, if not nil.
+func (s *ConfigSyncer) checkContexts(src runtime.Object, contexts []string) ([]string, map[string]struct{}, error) {
+	var usable []string
+	var errs []error
+	taken := map[string]struct{}{}
+	owners := map[string]string{}
+	for _, ctx := range contexts {
+		cc, found := s.contexts[ctx]
+		if !found {
+			if src != nil {
+				s.recorder.Eventf(
+					src,
+					core.EventTypeWarning,
+					eventer.EventReasonUnknownContext,
+					"Context %s not found in kubeconfig file", ctx,
+				)
+			}
+			errs = append(errs, &TargetError{Context: ctx, Err: errors.New("context not found in kubeconfig file")})
+			continue
+		}
+		id, err := s.contextID(cc)
+		if err != nil {
+			errs = append(errs, &TargetError{Context: ctx, Err: err})
+			continue
+		}
+
+		var reason string
+		if id == s.clusterID {
+			reason = "it points at the source cluster"
+		} else if other, found := owners[id]; found {
+			reason = "it points at the same cluster as context " + other
+		}
+		if reason != "" {
+			if src != nil {
+				s.recorder.Eventf(
+					src,
+					core.EventTypeWarning,
+					eventer.EventReasonContextRefused,
+					"Refusing to sync into context %s, %s", ctx, reason,
+				)
+			}
+			errs = append(errs, &TargetError{Context: ctx, Err: errors.New("refusing to sync, " + reason)})
+			continue
+		}
+		owners[id] = ctx
+		taken[id] = struct{}{}
+		usable = append(usable, ctx)
+	}
+	return usable, taken, utilerrors.NewAggregate(errs)
+}
+
+// otherContexts returns, sorted by name, one context for every cluster other than the source cluster
+// whose ID is not in taken. taken is updated with the IDs of the returned contexts. Contexts whose
+// cluster can not be identified are skipped.
+func (s *ConfigSyncer) otherContexts(taken map[string]struct{}) []string {
+	names := make([]string, 0, len(s.contexts))
+	for ctx := range s.contexts {
+		names = append(names, ctx)
+	}
+	sort.Strings(names)
+
+	out := make([]string, 0, len(names))
+	for _, ctx := range names {
+		id, err := s.contextID(s.contexts[ctx])
+		if err != nil {
+			klog.Warningf("skipping context %s: %v", ctx, err)
+			continue
+		}
+		if _, found := taken[id]; found || id == s.clusterID {
+			continue
+		}
+		taken[id] = struct{}{}
+		out = append(out, ctx)
+	}
+	return out
+}
@@ -17,133 +17,166 @@ limitations under the License.
 package syncer
 
 import (
-	context "context"
+	"context"
 
+	api "kubeops.dev/config-syncer/apis/kubed/v1alpha1"
 	"kubeops.dev/config-syncer/pkg/eventer"
 
-	"github.com/pkg/errors"
 	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
-	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/klog/v2"
 	core_util "kmodules.xyz/client-go/core/v1"
 )
 
-func (s *ConfigSyncer) SyncConfigMap(src *core.ConfigMap) error {
-	opts := GetSyncOptions(src.Annotations)
+func (s *ConfigSyncer) reconcileConfigMap(key string) error {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
 
-	if opts.NamespaceSelector != nil { // delete that were in old-ns but not in new-ns and upsert to new-ns
-		newNs, err := NamespacesForSelector(s.kubeClient, *opts.NamespaceSelector)
-		if err != nil {
-			return err
-		}
-		klog.Infof("configmap %s/%s will be synced into namespaces %v if needed", src.Namespace, src.Name, newNs.List())
-		if err := s.syncConfigMapIntoNamespaces(s.kubeClient, src, newNs, true, ""); err != nil {
-			return err
-		}
-	} else { // no sync, delete that were previously added
-		if err := s.syncConfigMapIntoNamespaces(s.kubeClient, src, sets.NewString(), true, ""); err != nil {
-			return err
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+	src, err := s.cmLister.ConfigMaps(namespace).Get(name)
+	if s.agent != nil && (err == nil || kerr.IsNotFound(err)) {
+		return s.pullConfigMap(namespace, name, src)
+	}
+	if kerr.IsNotFound(err) {
+		klog.Infof("configmap %s does not exist anymore", key)
+		deleteManagedCopies(resourceConfigMaps, namespace, name)
+		deleted := &core.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         namespace,
+				DeletionTimestamp: deletedAt(),
+			},
 		}
+		s.forgetAttempt(resourceConfigMaps, deleted)
+		err = s.SyncDeletedConfigMap(deleted)
+		return utilerrors.NewAggregate([]error{err, s.updateConfigSyncStatus(api.SourceKindConfigMap, namespace, name, nil, err)})
+	} else if err != nil {
+		return err
 	}
+	err = s.syncAndRecord(resourceConfigMaps, src, s.syncOptionsFor(api.SourceKindConfigMap, src), func(src object) error {
+		return s.SyncConfigMap(src.(*core.ConfigMap))
+	})
+	return utilerrors.NewAggregate([]error{
+		err,
+		s.updateConfigMapSyncStatus(src, err),
+		s.updateConfigSyncStatus(api.SourceKindConfigMap, namespace, name, src, err),
+	})
+}
 
-	return s.syncConfigMapIntoContexts(src, opts.Contexts)
+func (s *ConfigSyncer) updateConfigMapSyncStatus(src *core.ConfigMap, syncErr error) error {
+	namespaces := func() ([]string, error) {
+		return s.copyNamespaces(configMapCopier{s}, src)
+	}
+	return s.updateSyncStatus(resourceConfigMaps, src, s.syncOptionsFor(api.SourceKindConfigMap, src), namespaces, syncErr, func(patch []byte) error {
+		_, err := s.kubeClient.CoreV1().ConfigMaps(src.Namespace).Patch(context.TODO(), src.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+		return err
+	})
+}
+
+func (s *ConfigSyncer) SyncConfigMap(src *core.ConfigMap) error {
+	return s.syncSource(configMapCopier{s}, src)
 }
 
 // source deleted, delete that were previously added
 func (s *ConfigSyncer) SyncDeletedConfigMap(src *core.ConfigMap) error {
-	if err := s.syncConfigMapIntoNamespaces(s.kubeClient, src, sets.NewString(), true, ""); err != nil {
-		return err
-	}
-	return s.syncConfigMapIntoContexts(src, sets.NewString())
+	return s.syncDeletedSource(configMapCopier{s}, src)
 }
 
-func (s *ConfigSyncer) syncConfigMapIntoContexts(src *core.ConfigMap, contexts sets.String) error {
-	// validate contexts specified via annotation
-	taken := map[string]struct{}{}
-	for _, ctx := range contexts.List() {
-		context, found := s.contexts[ctx]
-		if !found {
-			return errors.Errorf("context %s not found in kubeconfig file", ctx)
-		}
-		if _, found = taken[context.Address]; found {
-			return errors.Errorf("multiple contexts poniting same cluster")
-		}
-		taken[context.Address] = struct{}{}
-	}
+type configMapCopier struct {
+	s *ConfigSyncer
+}
 
-	// sync to contexts specified via annotation, do not ignore errors here
-	for _, ctx := range contexts.List() {
-		context := s.contexts[ctx]
-		if context.Namespace == "" { // use source namespace if not specified via context
-			context.Namespace = src.Namespace
-		}
-		err := s.syncConfigMapIntoNamespaces(context.Client, src, sets.NewString(context.Namespace), false, ctx)
-		if err != nil {
-			return err
-		}
-	}
+func (c configMapCopier) resource() string {
+	return resourceConfigMaps
+}
 
-	// delete from other contexts, ignore errors here
-	for ctxName, ctx := range s.contexts {
-		if _, found := taken[ctx.Address]; !found {
-			err := s.syncConfigMapIntoNamespaces(ctx.Client, src, sets.NewString(), false, ctxName)
-			if err != nil {
-				klog.Infoln(err)
-			}
-			taken[ctx.Address] = struct{}{} // to avoid deleting form same cluster twice
-		}
-	}
+func (c configMapCopier) options(src metav1.Object) SyncOptions {
+	return c.s.syncOptionsFor(api.SourceKindConfigMap, src)
+}
 
-	return nil
+func (c configMapCopier) source(namespace, name string) (object, error) {
+	if c.s.cmLister != nil {
+		return c.s.cmLister.ConfigMaps(namespace).Get(name)
+	}
+	return c.s.kubeClient.CoreV1().ConfigMaps(namespace).Get(context.TODO(), name, metav1.GetOptions{})
 }
 
-// upsert into newNs set, delete from (oldNs-newNs) set
-// use skipSrcNs = true for sync in source cluster
-func (s *ConfigSyncer) syncConfigMapIntoNamespaces(kc kubernetes.Interface, src *core.ConfigMap, newNs sets.String, skipSrcNs bool, ctx string) error {
-	oldNs, err := namespaceSetForConfigMapSelector(kc, s.syncerLabelSelector(src.Name, src.Namespace, s.clusterName))
+func (c configMapCopier) copies(src object, ctx, namespace string) ([]object, error) {
+	items, err := c.s.configMapCopies(c.s.kubeClientFor(ctx), src.(*core.ConfigMap), ctx, namespace)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	oldNs = oldNs.Difference(newNs)
-	if skipSrcNs {
-		oldNs.Delete(src.Namespace)
-		newNs.Delete(src.Namespace)
+	out := make([]object, len(items))
+	for i := range items {
+		out[i] = &items[i]
 	}
-	for _, ns := range oldNs.List() {
-		if err := kc.CoreV1().ConfigMaps(ns).Delete(context.TODO(), src.Name, metav1.DeleteOptions{}); err != nil {
-			return err
-		}
+	return out, nil
+}
+
+func (c configMapCopier) list(cluster clusterContext, sel labels.Selector) ([]object, error) {
+	items, err := cluster.Client.CoreV1().ConfigMaps(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: sel.String(),
+	})
+	if err != nil {
+		return nil, err
 	}
-	for _, ns := range newNs.List() {
-		if err = s.upsertConfigMap(kc, src, ns, ctx); err != nil {
-			return err
-		}
+	out := make([]object, len(items.Items))
+	for i := range items.Items {
+		out[i] = &items.Items[i]
 	}
-	return nil
+	return out, nil
+}
+
+func (c configMapCopier) upsert(src object, namespace, ctx string) error {
+	return c.s.upsertConfigMap(c.s.kubeClientFor(ctx), src.(*core.ConfigMap), namespace, ctx)
+}
+
+func (c configMapCopier) delete(cluster clusterContext, obj object) error {
+	return cluster.Client.CoreV1().ConfigMaps(obj.GetNamespace()).Delete(context.TODO(), obj.GetName(), metav1.DeleteOptions{})
 }
 
-func (s *ConfigSyncer) syncConfigMapIntoNewNamespace(src *core.ConfigMap, namespace *core.Namespace) error {
-	opts := GetSyncOptions(src.Annotations)
-	if opts.NamespaceSelector == nil {
-		return nil
+func (s *ConfigSyncer) upsertConfigMap(kc kubernetes.Interface, src *core.ConfigMap, namespace, ctx string) error {
+	opts := s.syncOptionsFor(api.SourceKindConfigMap, src)
+	var ns *core.Namespace
+	if opts.Template {
+		var err error
+		if ns, err = s.targetNamespace(kc, namespace, ctx); err != nil {
+			return err
+		}
 	}
-	if selector, err := labels.Parse(*opts.NamespaceSelector); err != nil {
+	desired, err := s.configMapCopy(src, opts, ns, ctx)
+	if err != nil {
+		s.recorder.Eventf(
+			src,
+			core.EventTypeWarning,
+			eventer.EventReasonTemplateRenderFailed,
+			"Failed to render copy for %s: %v", targetString(namespace, ctx), err,
+		)
 		return err
-	} else if selector.Matches(labels.Set(namespace.Labels)) {
-		return s.upsertConfigMap(s.kubeClient, src, namespace.Name, "")
 	}
-	return nil
-}
 
-func (s *ConfigSyncer) upsertConfigMap(kc kubernetes.Interface, src *core.ConfigMap, namespace, ctx string) error {
 	meta := metav1.ObjectMeta{
-		Name:      src.Name,
+		Name:      opts.CopyName(src.Name, ctx),
 		Namespace: namespace,
 	}
-	_, _, err := core_util.CreateOrPatchConfigMap(context.TODO(), kc, meta, func(obj *core.ConfigMap) *core.ConfigMap {
+	skipped := false
+	out, verb, err := core_util.CreateOrPatchConfigMap(context.TODO(), kc, meta, func(obj *core.ConfigMap) *core.ConfigMap {
+		if obj.UID != "" { // exists
+			if skipped = !s.resolveConflict(src, obj, opts, configMapMatches(obj, desired), namespace, ctx); skipped {
+				return obj
+			}
+		}
+
 		// check origin cluster, if not match overwrite and create an event
 		if v, ok := obj.Labels[OriginClusterLabelKey]; ok && v != s.clusterName {
 			s.recorder.Eventf(
@@ -154,36 +187,49 @@ func (s *ConfigSyncer) upsertConfigMap(kc kubernetes.Interface, src *core.Config
 			)
 		}
 
-		obj.Data = src.Data
-		obj.BinaryData = src.BinaryData
-		obj.Labels = labels.Merge(src.Labels, s.syncerLabels(src.Name, src.Namespace, s.clusterName))
-
-		ref := core.ObjectReference{
-			APIVersion:      src.APIVersion,
-			Kind:            src.Kind,
-			Name:            src.Name,
-			Namespace:       src.Namespace,
-			UID:             src.UID,
-			ResourceVersion: src.ResourceVersion,
-		}
-		obj.Annotations = s.syncerAnnotations(obj.Annotations, src.Annotations, ref)
+		obj.Data = desired.Data
+		obj.BinaryData = desired.BinaryData
+		s.setCopyMeta(obj, src, originRef(src))
 
 		return obj
 	}, metav1.PatchOptions{})
+	if err != nil {
+		return err
+	} else if skipped {
+		return errConflictSkipped
+	}
+	s.recordCopyWritten(src, out, verb, ctx)
+	return nil
+}
 
-	return err
+// configMapCopy returns a ConfigMap holding the data of a copy of src. Templates are rendered against ns,
+// the target namespace.
+func (s *ConfigSyncer) configMapCopy(src *core.ConfigMap, opts SyncOptions, ns *core.Namespace, ctx string) (*core.ConfigMap, error) {
+	out := &core.ConfigMap{
+		Data:       opts.selectStringData(src.Data),
+		BinaryData: opts.selectByteData(src.BinaryData),
+	}
+	if opts.Template {
+		data, err := renderData(out.Data, newTemplateData(ns, s.clusterName, ctx))
+		if err != nil {
+			return nil, err
+		}
+		out.Data = data
+	}
+	return out, nil
+}
+
+// configMapMatches tells whether cur already holds the data of desired
+func configMapMatches(cur, desired *core.ConfigMap) bool {
+	return equality.Semantic.DeepEqual(cur.Data, desired.Data) && equality.Semantic.DeepEqual(cur.BinaryData, desired.BinaryData)
 }
 
-func namespaceSetForConfigMapSelector(kc kubernetes.Interface, selector string) (sets.String, error) {
-	cfgMaps, err := kc.CoreV1().ConfigMaps(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{
+func configMapForSelector(kc kubernetes.Interface, selector string) ([]core.ConfigMap, error) {
+	copies, err := kc.CoreV1().ConfigMaps(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{
 		LabelSelector: selector,
 	})
 	if err != nil {
 		return nil, err
 	}
-	ns := sets.NewString()
-	for _, obj := range cfgMaps.Items {
-		ns.Insert(obj.Namespace)
-	}
-	return ns, nil
+	return copies.Items, nil
 }
@@ -0,0 +1,240 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	api "kubeops.dev/config-syncer/apis/kubed/v1alpha1"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// ConfigSyncSourceIndex indexes ConfigSyncs by the kind, namespace and name of their source
+const ConfigSyncSourceIndex = "source"
+
+func ConfigSyncSourceIndexFunc(obj interface{}) ([]string, error) {
+	cs, ok := obj.(*api.ConfigSync)
+	if !ok {
+		return nil, nil
+	}
+	return []string{sourceIndexKey(cs.Spec.Source.Kind, cs.Namespace, cs.Spec.Source.Name)}, nil
+}
+
+func sourceIndexKey(kind api.SourceKind, namespace, name string) string {
+	return string(kind) + "/" + namespace + "/" + name
+}
+
+// configSyncsFor returns the ConfigSyncs referring to a source, oldest first.
+// The first one takes effect, the others are superseded.
+func (s *ConfigSyncer) configSyncsFor(kind api.SourceKind, namespace, name string) []*api.ConfigSync {
+	if s.csIndexer == nil {
+		return nil
+	}
+	objs, err := s.csIndexer.ByIndex(ConfigSyncSourceIndex, sourceIndexKey(kind, namespace, name))
+	if err != nil {
+		klog.Errorln(err)
+		return nil
+	}
+	out := make([]*api.ConfigSync, 0, len(objs))
+	for _, obj := range objs {
+		if cs, ok := obj.(*api.ConfigSync); ok {
+			out = append(out, cs)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CreationTimestamp.Equal(&out[j].CreationTimestamp) {
+			return out[i].CreationTimestamp.Before(&out[j].CreationTimestamp)
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+// syncOptionsFor reads the sync options of a source from its annotations. If a ConfigSync refers
+// to the source, its spec replaces the namespace selector, contexts and key filter annotations.
+func (s *ConfigSyncer) syncOptionsFor(kind api.SourceKind, src metav1.Object) SyncOptions {
+	opts := GetSyncOptions(src.GetAnnotations())
+	if items := s.configSyncsFor(kind, src.GetNamespace(), src.GetName()); len(items) > 0 {
+		opts.applyConfigSync(items[0])
+	}
+	if s.agent != nil {
+		opts = s.agent.restrict(opts)
+	}
+	return opts
+}
+
+func (opts *SyncOptions) applyConfigSync(cs *api.ConfigSync) {
+	opts.NamespaceSelector = nil
+	if cs.Spec.NamespaceSelector != nil {
+		if selector, err := metav1.LabelSelectorAsSelector(cs.Spec.NamespaceSelector); err == nil {
+			v := selector.String()
+			opts.NamespaceSelector = &v
+		} else {
+			klog.Warningf("ignoring namespace selector of ConfigSync %s/%s: %v", cs.Namespace, cs.Name, err)
+		}
+	}
+	opts.Namespaces = cs.Spec.Namespaces
+	opts.Contexts = sets.NewString(cs.Spec.Contexts...)
+	opts.IncludeKeys = cs.Spec.IncludeKeys
+	opts.ExcludeKeys = cs.Spec.ExcludeKeys
+	opts.CreateNamespace = cs.Spec.CreateNamespace
+	opts.ClusterSelector = nil
+	if cs.Spec.ClusterSelector != nil {
+		if selector, err := metav1.LabelSelectorAsSelector(cs.Spec.ClusterSelector); err == nil {
+			v := selector.String()
+			opts.ClusterSelector = &v
+		} else {
+			klog.Warningf("ignoring cluster selector of ConfigSync %s/%s: %v", cs.Namespace, cs.Name, err)
+		}
+	}
+	opts.ContextSelector, opts.ContextSelectors = nil, nil
+	if cs.Spec.ContextNamespaceSelector != nil {
+		if selector, err := metav1.LabelSelectorAsSelector(cs.Spec.ContextNamespaceSelector); err == nil {
+			v := selector.String()
+			opts.ContextSelector = &v
+		} else {
+			klog.Warningf("ignoring context namespace selector of ConfigSync %s/%s: %v", cs.Namespace, cs.Name, err)
+		}
+	}
+}
+
+// updateConfigSyncStatus records the outcome of syncing a source in the status of the
+// ConfigSyncs referring to it. src is nil if the source does not exist.
+func (s *ConfigSyncer) updateConfigSyncStatus(kind api.SourceKind, namespace, name string, src object, syncErr error) error {
+	items := s.configSyncsFor(kind, namespace, name)
+	if len(items) == 0 {
+		return nil
+	}
+
+	for i, cs := range items {
+		status := api.ConfigSyncStatus{
+			ObservedGeneration: cs.Generation,
+			Namespaces:         cs.Status.Namespaces,
+			Contexts:           cs.Status.Contexts,
+			LastSyncTime:       cs.Status.LastSyncTime,
+		}
+		switch {
+		case i > 0:
+			status.Phase = api.ConfigSyncPhaseSuperseded
+			status.Reason = fmt.Sprintf("ConfigSync %s refers to the same source and takes precedence", items[0].Name)
+			status.Namespaces, status.Contexts = nil, nil
+		case src == nil:
+			status.Phase = api.ConfigSyncPhasePending
+			status.Reason = fmt.Sprintf("%s %s/%s not found", kind, namespace, name)
+			status.Namespaces, status.Contexts = nil, nil
+		case syncErr != nil:
+			status.Phase = api.ConfigSyncPhaseFailed
+			status.Reason = syncErr.Error()
+		default:
+			namespaces, err := s.copyNamespaces(s.copierFor(kind), src)
+			if err != nil {
+				return err
+			}
+			status.Phase = api.ConfigSyncPhaseCurrent
+			status.Namespaces = namespaces
+			status.Contexts = s.syncOptionsFor(kind, src).Contexts.List()
+		}
+		if equality.Semantic.DeepEqual(cs.Status, status) {
+			continue // only bump the sync time if anything else changed
+		}
+		if status.Phase == api.ConfigSyncPhaseCurrent {
+			now := metav1.Now()
+			status.LastSyncTime = &now
+		}
+
+		obj := cs.DeepCopy()
+		obj.Status = status
+		if _, err := s.kubedClient.KubedV1alpha1().ConfigSyncs(obj.Namespace).UpdateStatus(context.TODO(), obj, metav1.UpdateOptions{}); err != nil && !kerr.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyNamespaces returns the namespaces of the source cluster holding copies of src after its last sync
+// with c. They are the targets the sync wrote or kept a copy in, unless the sync failed as a whole and
+// the copies are looked up.
+func (s *ConfigSyncer) copyNamespaces(c copier, src object) ([]string, error) {
+	ns := sets.NewString()
+	if v, ok := s.attempts.Load(statusKey(c.resource(), src)); ok && v.(*syncAttempt).namespaces != nil &&
+		v.(*syncAttempt).resourceVersion == sourceResourceVersion(src) && v.(*syncAttempt).options == optionsHash(c.options(src)) {
+		ns.Insert(v.(*syncAttempt).namespaces.UnsortedList()...)
+	} else {
+		copies, err := c.copies(src, "", metav1.NamespaceAll)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range copies {
+			ns.Insert(obj.GetNamespace())
+		}
+	}
+	ns.Delete(src.GetNamespace())
+	return ns.List(), nil
+}
+
+// copierFor returns the copier of sources of kind
+func (s *ConfigSyncer) copierFor(kind api.SourceKind) copier {
+	if kind == api.SourceKindSecret {
+		return secretCopier{s}
+	}
+	return configMapCopier{s}
+}
+
+// LoadConfigSyncs reads the ConfigSyncs of a namespace, or of all namespaces if empty, for syncers
+// that run without informers. The ConfigSync CRD not being registered is not an error.
+func (s *ConfigSyncer) LoadConfigSyncs(namespace string) error {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{ConfigSyncSourceIndex: ConfigSyncSourceIndexFunc})
+	list, err := s.kubedClient.KubedV1alpha1().ConfigSyncs(namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil && !kerr.IsNotFound(err) {
+		return err
+	}
+	if list != nil {
+		for i := range list.Items {
+			if err := indexer.Add(&list.Items[i]); err != nil {
+				return err
+			}
+		}
+	}
+	s.csIndexer = indexer
+	return nil
+}
+
+// enqueueSourceOf queues the source a ConfigSync refers to
+func (s *ConfigSyncer) enqueueSourceOf(obj interface{}) {
+	if d, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = d.Obj
+	}
+	cs, ok := obj.(*api.ConfigSync)
+	if !ok {
+		return
+	}
+	key := cs.Namespace + "/" + cs.Spec.Source.Name
+	switch cs.Spec.Source.Kind {
+	case api.SourceKindConfigMap:
+		s.cmQueue.GetQueue().Add(key)
+	case api.SourceKindSecret:
+		s.secretQueue.GetQueue().Add(key)
+	}
+}
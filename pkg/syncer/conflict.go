@@ -0,0 +1,108 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"kubeops.dev/config-syncer/pkg/eventer"
+
+	"github.com/pkg/errors"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// errConflictSkipped is the error of a target whose object was left alone by the conflict policy. The target
+// holds no copy, so it fails like any other target that could not be written.
+var errConflictSkipped = errors.New("object exists and is not managed by config-syncer")
+
+// ConflictPolicy decides what happens to an object in a target namespace that has the
+// name of a copy, but was not created by config-syncer for the same source.
+type ConflictPolicy string
+
+const (
+	// leave the object alone and record a warning event
+	ConflictPolicySkip ConflictPolicy = "skip"
+	// replace the object with a copy of the source
+	ConflictPolicyOverwrite ConflictPolicy = "overwrite"
+	// take ownership of the object only when its content already matches the source
+	ConflictPolicyAdopt ConflictPolicy = "adopt"
+)
+
+func ParseConflictPolicy(s string) (ConflictPolicy, error) {
+	switch p := ConflictPolicy(s); p {
+	case ConflictPolicySkip, ConflictPolicyOverwrite, ConflictPolicyAdopt:
+		return p, nil
+	}
+	return "", errors.Errorf("unknown conflict policy %q, must be one of %s, %s or %s", s, ConflictPolicySkip, ConflictPolicyOverwrite, ConflictPolicyAdopt)
+}
+
+// conflictPolicyFor returns the policy of a source, falling back to the global default
+func (s *ConfigSyncer) conflictPolicyFor(opts SyncOptions) ConflictPolicy {
+	if opts.ConflictPolicy != "" {
+		return opts.ConflictPolicy
+	}
+	return s.conflictPolicy
+}
+
+// isCopyOf checks whether obj carries the origin labels of the source srcNamespace/srcName of this cluster.
+// Copies written by other clusters are conflicts like objects that are not managed by config-syncer.
+func (s *ConfigSyncer) isCopyOf(obj metav1.Object, srcNamespace, srcName string) bool {
+	l := obj.GetLabels()
+	cluster, found := l[OriginClusterLabelKey]
+	return found && cluster == s.clusterName && l[OriginNameLabelKey] == srcName && l[OriginNamespaceLabelKey] == srcNamespace
+}
+
+// overwritesConflict tells whether the conflict policy of a source allows writing a copy over an
+// object that is not a copy of the source. matches tells whether the object already has the content of the copy.
+func (s *ConfigSyncer) overwritesConflict(opts SyncOptions, matches bool) bool {
+	policy := s.conflictPolicyFor(opts)
+	return policy == ConflictPolicyOverwrite || (policy == ConflictPolicyAdopt && matches)
+}
+
+// writesCopy tells whether a copy of src is written over cur, an existing object with the name of the copy.
+// Objects that are not a copy of src are only written over if the conflict policy allows it. matches tells
+// whether cur already has the content of the copy. Syncing and planning share this decision.
+func (s *ConfigSyncer) writesCopy(cur, src metav1.Object, opts SyncOptions, matches bool) bool {
+	return s.isCopyOf(cur, src.GetNamespace(), src.GetName()) || s.overwritesConflict(opts, matches)
+}
+
+// resolveConflict is writesCopy for the sync, it records adopted and skipped objects on src
+func (s *ConfigSyncer) resolveConflict(src, cur object, opts SyncOptions, matches bool, namespace, ctx string) bool {
+	policy := s.conflictPolicyFor(opts)
+	name := cur.GetName()
+
+	if s.writesCopy(cur, src, opts, matches) {
+		if !s.isCopyOf(cur, src.GetNamespace(), src.GetName()) && policy == ConflictPolicyAdopt {
+			s.recorder.Eventf(
+				src,
+				core.EventTypeNormal,
+				eventer.EventReasonCopyAdopted,
+				"Adopted existing object %s in %s", name, targetString(namespace, ctx),
+			)
+		}
+		return true
+	}
+
+	klog.Warningf("skipping %s: object %s is not managed by config-syncer (conflict policy %s)", targetString(namespace, ctx), name, policy)
+	s.recorder.Eventf(
+		src,
+		core.EventTypeWarning,
+		eventer.EventReasonCopyConflict,
+		"Skipped %s: object %s exists and is not managed by config-syncer (conflict policy %s)", targetString(namespace, ctx), name, policy,
+	)
+	return false
+}
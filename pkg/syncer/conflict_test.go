@@ -0,0 +1,179 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"testing"
+
+	api "kubeops.dev/config-syncer/apis/kubed/v1alpha1"
+
+	"github.com/pkg/errors"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestParseConflictPolicy(t *testing.T) {
+	for _, s := range []string{"skip", "overwrite", "adopt"} {
+		if p, err := ParseConflictPolicy(s); err != nil || string(p) != s {
+			t.Errorf("ParseConflictPolicy(%q) = %q, %v", s, p, err)
+		}
+	}
+	for _, s := range []string{"", "Skip", "replace"} {
+		if _, err := ParseConflictPolicy(s); err == nil {
+			t.Errorf("ParseConflictPolicy(%q) succeeded, want error", s)
+		}
+	}
+}
+
+func TestUpsertConfigMapConflictPolicy(t *testing.T) {
+	src := &core.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "omni", Namespace: "demo", UID: "src"},
+		Data:       map[string]string{"k": "v"},
+	}
+
+	tests := []struct {
+		name        string
+		policy      ConflictPolicy
+		data        map[string]string
+		labels      map[string]string
+		wantWritten bool
+	}{
+		{name: "skip", policy: ConflictPolicySkip, data: map[string]string{"k": "v"}, wantWritten: false},
+		{name: "overwrite", policy: ConflictPolicyOverwrite, data: map[string]string{"k": "other"}, wantWritten: true},
+		{name: "adopt matching", policy: ConflictPolicyAdopt, data: map[string]string{"k": "v"}, wantWritten: true},
+		{name: "adopt different", policy: ConflictPolicyAdopt, data: map[string]string{"k": "other"}, wantWritten: false},
+		{
+			name:   "copy of another cluster",
+			policy: ConflictPolicySkip,
+			data:   map[string]string{"k": "other"},
+			labels: map[string]string{
+				OriginNameLabelKey:      "omni",
+				OriginNamespaceLabelKey: "demo",
+				OriginClusterLabelKey:   "other",
+			},
+			wantWritten: false,
+		},
+		{
+			name:   "copy of this cluster",
+			policy: ConflictPolicySkip,
+			data:   map[string]string{"k": "other"},
+			labels: map[string]string{
+				OriginNameLabelKey:      "omni",
+				OriginNamespaceLabelKey: "demo",
+				OriginClusterLabelKey:   "hub",
+			},
+			wantWritten: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cur := &core.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "omni", Namespace: "other", UID: "cur", Labels: tt.labels},
+				Data:       tt.data,
+			}
+			kc := fake.NewSimpleClientset(cur.DeepCopy())
+			s := New(kc, nil, nil, record.NewFakeRecorder(10), Options{ConflictPolicy: tt.policy})
+			s.clusterName = "hub"
+
+			// plan decides like the sync
+			change, err := s.planConfigMapCopy(planTarget{client: fake.NewSimpleClientset(cur)}, src, configMapCopier{s}.options(src), "other", "omni")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if planned := change == nil || change.Action != PlanActionSkip; planned != tt.wantWritten {
+				t.Errorf("planned write = %v, want %v", planned, tt.wantWritten)
+			}
+
+			if err := s.upsertConfigMap(kc, src, "other", ""); tt.wantWritten && err != nil {
+				t.Fatal(err)
+			} else if !tt.wantWritten && !errors.Is(err, errConflictSkipped) {
+				t.Fatalf("got error %v, want the conflict skipped", err)
+			}
+			cm, err := kc.CoreV1().ConfigMaps("other").Get(context.TODO(), "omni", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if written := s.isCopyOf(cm, src.Namespace, src.Name) && cm.Data["k"] == "v"; written != tt.wantWritten {
+				t.Errorf("copy written = %v, want %v", written, tt.wantWritten)
+			}
+
+			gets := 0
+			for _, action := range kc.Actions() {
+				if action.GetVerb() == "get" {
+					gets++
+				}
+			}
+			if gets != 2 { // one by upsertConfigMap, one above
+				t.Errorf("got %d gets, want 2", gets)
+			}
+		})
+	}
+}
+
+func TestSyncSkippedConflict(t *testing.T) {
+	src := &core.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "omni",
+			Namespace:       "demo",
+			ResourceVersion: "5",
+			Annotations:     map[string]string{ConfigSyncKey: ""},
+		},
+		Data: map[string]string{"k": "v"},
+	}
+	kc := fake.NewSimpleClientset(
+		&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "demo"}},
+		&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "a"}},
+		&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "b"}},
+		&core.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "omni", Namespace: "b", UID: "theirs"},
+			Data:       map[string]string{"k": "theirs"},
+		},
+		src,
+	)
+	s := New(kc, nil, nil, record.NewFakeRecorder(100), Options{ConflictPolicy: ConflictPolicySkip})
+	opts := s.syncOptionsFor(api.SourceKindConfigMap, src)
+	err := s.syncAndRecord(resourceConfigMaps, src, opts, func(src object) error {
+		return s.SyncConfigMap(src.(*core.ConfigMap))
+	})
+	if !errors.Is(err, errConflictSkipped) {
+		t.Fatalf("got error %v, want the conflict in namespace b skipped", err)
+	}
+	if _, perTarget := splitTargetErrors(err); len(perTarget) != 1 || perTarget["b"] == "" {
+		t.Errorf("got errors %v, want one for namespace b", perTarget)
+	}
+
+	last := s.lastAttempt(resourceConfigMaps, src, opts)
+	if last == nil {
+		t.Fatal("attempt not remembered, want namespace b retried")
+	}
+	if !last.written("a", "") || last.written("b", "") {
+		t.Errorf("attempt wrote %v, want namespace a only", last.succeeded.List())
+	}
+	if !last.failed.Has("b") {
+		t.Errorf("attempt failed for %v, want namespace b", last.failed.List())
+	}
+	cm, err := kc.CoreV1().ConfigMaps("b").Get(context.TODO(), "omni", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cm.Data["k"] != "theirs" {
+		t.Errorf("object in namespace b overwritten, want it left alone")
+	}
+}
@@ -0,0 +1,271 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"time"
+
+	"kubeops.dev/config-syncer/pkg/eventer"
+
+	"github.com/pkg/errors"
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+// copier reads, writes and deletes the copies of one kind of source. ConfigMaps, Secrets and
+// other resources share the sync flow built on top of it.
+type copier interface {
+	// resource names the kind of sources in metrics, logs and the sync bookkeeping
+	resource() string
+	options(src metav1.Object) SyncOptions
+	// source returns the source namespace/name of the cluster being synced
+	source(namespace, name string) (object, error)
+	// copies returns the copies of src in namespace of the cluster of ctx, in all namespaces if namespace is empty
+	copies(src object, ctx, namespace string) ([]object, error)
+	// list returns the objects selected by sel in all namespaces of cluster
+	list(cluster clusterContext, sel labels.Selector) ([]object, error)
+	upsert(src object, namespace, ctx string) error
+	delete(cluster clusterContext, obj object) error
+}
+
+// clusterFor returns the cluster of ctx, ctx is empty for the source cluster
+func (s *ConfigSyncer) clusterFor(ctx string) clusterContext {
+	if ctx == "" {
+		return clusterContext{Client: s.kubeClient, DynamicClient: s.dynamicClient}
+	}
+	return s.contexts[ctx]
+}
+
+// kubeClientFor returns the client of the cluster of ctx, ctx is empty for the source cluster
+func (s *ConfigSyncer) kubeClientFor(ctx string) kubernetes.Interface {
+	if ctx == "" {
+		return s.kubeClient
+	}
+	return s.contexts[ctx].Client
+}
+
+// dynamicClientFor returns the dynamic client of the cluster of ctx, ctx is empty for the source cluster
+func (s *ConfigSyncer) dynamicClientFor(ctx string) dynamic.Interface {
+	if ctx == "" {
+		return s.dynamicClient
+	}
+	return s.contexts[ctx].DynamicClient
+}
+
+func (s *ConfigSyncer) syncSource(c copier, src object) error {
+	opts := c.options(src)
+	if err := s.checkKeys(src, opts); err != nil {
+		return err
+	}
+
+	var errs []error
+	if opts.syncsNamespaces() { // delete that were in old-ns but not in new-ns and upsert to new-ns
+		if _, err := opts.namespaceSelector(); err != nil {
+			s.recorder.Eventf(
+				src,
+				core.EventTypeWarning,
+				eventer.EventReasonInvalidSelector,
+				"Invalid namespace selector %q: %v", *opts.NamespaceSelector, err,
+			)
+			errs = append(errs, err)
+		} else if newNs, err := s.localNamespacesForSource(opts, src.GetNamespace(), src.GetName()); err != nil {
+			errs = append(errs, err)
+		} else {
+			klog.Infof("%s %s/%s will be synced into namespaces %v if needed", c.resource(), src.GetNamespace(), src.GetName(), newNs.List())
+			errs = append(errs, s.syncIntoNamespaces(c, src, newNs, true, ""))
+		}
+	} else { // no sync, delete that were previously added
+		errs = append(errs, s.syncIntoNamespaces(c, src, sets.NewString(), true, ""))
+	}
+
+	// a failure in some namespaces does not stop syncing into other contexts
+	errs = append(errs, s.syncIntoContexts(c, src, opts.Contexts))
+	return utilerrors.NewAggregate(errs)
+}
+
+// source deleted, delete that were previously added
+func (s *ConfigSyncer) syncDeletedSource(c copier, src object) error {
+	return utilerrors.NewAggregate([]error{
+		s.syncIntoNamespaces(c, src, sets.NewString(), true, ""),
+		s.syncIntoContexts(c, src, sets.NewString()),
+	})
+}
+
+func (s *ConfigSyncer) syncIntoContexts(c copier, src object, contexts sets.String) error {
+	// validate contexts specified via annotation, contexts that can not be used are skipped
+	usable, taken, err := s.checkContexts(src, contexts.List())
+	errs := []error{err}
+
+	// sync to contexts specified via annotation, a failing context does not stop the others
+	opts := c.options(src)
+	errs = append(errs, s.fanOut.forEachContext(usable, func(ctx string) error {
+		cc := s.contexts[ctx]
+		if cc.Namespace == "" { // use source namespace if not specified via context
+			cc.Namespace = src.GetNamespace()
+		}
+		if opts.contextSelector(ctx) == nil {
+			if err := s.ensureNamespace(src, ctx, cc, opts); err != nil {
+				return &TargetError{Namespace: cc.Namespace, Context: ctx, Err: err}
+			}
+		}
+		newNs, err := contextNamespaces(opts, ctx, cc, src.GetNamespace(), src.GetName())
+		if err != nil {
+			return &TargetError{Context: ctx, Err: err}
+		}
+		return s.syncIntoNamespaces(c, src, newNs, false, ctx)
+	})...)
+
+	// delete from other contexts, ignore errors here
+	deleteErrs := s.fanOut.forEachContext(s.otherContexts(taken), func(ctx string) error {
+		return s.syncIntoNamespaces(c, src, sets.NewString(), false, ctx)
+	})
+	for _, err := range deleteErrs {
+		if err != nil {
+			klog.Infoln(err)
+		}
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
+
+// checkKeys refuses to sync src with invalid key patterns, copies would get keys meant to be kept out
+func (s *ConfigSyncer) checkKeys(src object, opts SyncOptions) error {
+	err := opts.validateKeys()
+	if err != nil {
+		s.recorder.Eventf(src, core.EventTypeWarning, eventer.EventReasonInvalidKeyPattern, "Not synced: %v", err)
+	}
+	return err
+}
+
+// upsert into newNs set, then delete copies outside of newNs set or with an outdated name
+// use skipSrcNs = true for sync in source cluster
+func (s *ConfigSyncer) syncIntoNamespaces(c copier, src object, newNs sets.String, skipSrcNs bool, ctx string) (err error) {
+	defer func(start time.Time) { observeSync(c.resource(), src.GetNamespace(), ctx, start, err) }(time.Now())
+
+	oldCopies, err := c.copies(src, ctx, metav1.NamespaceAll)
+	if err != nil {
+		if ctx != "" {
+			return &TargetError{Context: ctx, Err: err}
+		}
+		return err
+	}
+	if skipSrcNs {
+		newNs.Delete(src.GetNamespace())
+	}
+	// on retries, namespaces the current version of src was written into are skipped
+	last := s.lastAttempt(c.resource(), src, c.options(src))
+	namespaces := make([]string, 0, newNs.Len())
+	for _, ns := range newNs.List() {
+		if last.written(ns, ctx) {
+			s.markWritten(src, ns, ctx)
+		} else {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	errs := s.fanOut.run(s.clusterKey(ctx), len(namespaces), func(i int) error {
+		if err := c.upsert(src, namespaces[i], ctx); err != nil {
+			return &TargetError{Namespace: namespaces[i], Context: ctx, Err: err}
+		}
+		return nil
+	})
+	failed := sets.NewString()
+	for i := range errs {
+		if errs[i] != nil {
+			failed.Insert(namespaces[i])
+		} else {
+			s.markWritten(src, namespaces[i], ctx)
+		}
+	}
+	// failed namespaces only hold a copy if one was kept, an object left alone by the conflict policy is none
+	if ctx == "" {
+		for _, obj := range oldCopies {
+			if failed.Has(obj.GetNamespace()) {
+				s.markKept(src, obj.GetNamespace())
+			}
+		}
+	}
+
+	name := c.options(src).CopyName(src.GetName(), ctx)
+	// copies with an outdated name are kept while writing their replacement fails
+	stale := make([]object, 0, len(oldCopies))
+	for _, obj := range oldCopies {
+		if (skipSrcNs && obj.GetNamespace() == src.GetNamespace()) || (newNs.Has(obj.GetNamespace()) && obj.GetName() == name) || failed.Has(obj.GetNamespace()) {
+			continue
+		}
+		stale = append(stale, obj)
+	}
+	errs = append(errs, s.fanOut.run(s.clusterKey(ctx), len(stale), func(i int) error {
+		obj := stale[i]
+		if err := c.delete(s.clusterFor(ctx), obj); kerr.IsNotFound(err) {
+			return nil
+		} else if err != nil {
+			return &TargetError{Namespace: obj.GetNamespace(), Context: ctx, Err: err}
+		}
+		s.recordCopyDeleted(src, obj, ctx)
+		if ctx != "" {
+			s.pruneNamespace(src, ctx, obj.GetNamespace())
+		}
+		return nil
+	})...)
+	return utilerrors.NewAggregate(errs)
+}
+
+func (s *ConfigSyncer) syncIntoNewNamespace(c copier, src object, namespace *core.Namespace) error {
+	opts := c.options(src)
+	if !opts.syncsNamespaces() {
+		return nil
+	}
+	if namespace.Name == src.GetNamespace() {
+		return nil
+	}
+	selected, err := opts.selectsNamespace(namespace)
+	if err != nil {
+		return err
+	}
+	if selected && NamespaceAccepts(namespace, src.GetNamespace(), src.GetName()) {
+		if err := c.upsert(src, namespace.Name, ""); !errors.Is(err, errConflictSkipped) {
+			return err
+		}
+		return nil // recorded on src, the sync of src reports it
+	}
+	// the labels of the namespace may no longer match the selector
+	return s.deleteFromNamespace(c, src, namespace.Name)
+}
+
+// delete copies of src from a namespace that is no longer selected or no longer accepts them
+func (s *ConfigSyncer) deleteFromNamespace(c copier, src object, namespace string) error {
+	copies, err := c.copies(src, "", namespace)
+	if err != nil {
+		return err
+	}
+	for _, obj := range copies {
+		if err := c.delete(s.clusterFor(""), obj); kerr.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		s.recordCopyDeleted(src, obj, "")
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"testing"
+
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestSyncIntoNewNamespace(t *testing.T) {
+	src := &core.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "omni",
+			Namespace:   "demo",
+			UID:         "src-uid",
+			Annotations: map[string]string{ConfigSyncKey: "team=a"},
+		},
+		Data: map[string]string{"k": "v"},
+	}
+	tests := []struct {
+		name        string
+		labels      map[string]string
+		annotations map[string]string
+		want        bool
+	}{
+		{name: "selected", labels: map[string]string{"team": "a"}, want: true},
+		{name: "deselected", labels: map[string]string{"team": "b"}},
+		{name: "opted out", labels: map[string]string{"team": "a"}, annotations: map[string]string{NamespaceSyncOptOutKey: "true"}},
+		{name: "denied", labels: map[string]string{"team": "a"}, annotations: map[string]string{NamespaceSyncDenyKey: "demo/omni"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ns := &core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "target", Labels: map[string]string{"team": "a"}}}
+			kc := fake.NewSimpleClientset(
+				&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "demo"}},
+				ns,
+				src,
+				// copy of another source in the same namespace
+				newCopy("other", "target", "other", "demo", "", "other-uid"),
+			)
+			s := New(kc, nil, nil, record.NewFakeRecorder(10), Options{})
+
+			// the copy is written while the namespace is selected
+			if err := s.syncIntoNewNamespace(configMapCopier{s}, src, ns); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := kc.CoreV1().ConfigMaps("target").Get(context.TODO(), "omni", metav1.GetOptions{}); err != nil {
+				t.Fatalf("copy not created in selected namespace: %v", err)
+			}
+
+			updated := ns.DeepCopy()
+			updated.Labels = tt.labels
+			updated.Annotations = tt.annotations
+			if err := s.syncIntoNewNamespace(configMapCopier{s}, src, updated); err != nil {
+				t.Fatal(err)
+			}
+			_, err := kc.CoreV1().ConfigMaps("target").Get(context.TODO(), "omni", metav1.GetOptions{})
+			if err != nil && !kerr.IsNotFound(err) {
+				t.Fatal(err)
+			}
+			if got := err == nil; got != tt.want {
+				t.Errorf("copy kept = %v, want %v", got, tt.want)
+			}
+			if _, err := kc.CoreV1().ConfigMaps("target").Get(context.TODO(), "other", metav1.GetOptions{}); err != nil {
+				t.Errorf("copy of another source deleted: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,213 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	api "kubeops.dev/config-syncer/apis/kubed/v1alpha1"
+
+	"github.com/pkg/errors"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes"
+)
+
+type CopyState string
+
+const (
+	// the copy matches the source
+	CopyStateCurrent CopyState = "Current"
+	// data, type, labels or annotations of the copy differ from the source
+	CopyStateStale CopyState = "Stale"
+	// the copy is no longer selected, the next sync deletes it
+	CopyStateOrphaned CopyState = "Orphaned"
+	// a copy is selected but does not exist
+	CopyStateMissing CopyState = "Missing"
+	// an object that is not a copy has the name of the copy and the conflict policy leaves it alone
+	CopyStateConflict CopyState = "Conflict"
+	// the copy exists but can not be compared with the source, see CopyStatus.Error
+	CopyStateUnknown CopyState = "Unknown"
+)
+
+// CopyStatus compares a copy with its source
+type CopyStatus struct {
+	// empty for the source cluster
+	Context   string    `json:"context,omitempty"`
+	Namespace string    `json:"namespace"`
+	Name      string    `json:"name"`
+	State     CopyState `json:"state"`
+	// resourceVersion of the source recorded in the origin annotation of the copy
+	SourceResourceVersion string `json:"sourceResourceVersion,omitempty"`
+	// whether the recorded resourceVersion is the one of the current source
+	ResourceVersionMatches bool `json:"resourceVersionMatches"`
+	// whether the data of the copy matches the source
+	DataMatches bool `json:"dataMatches"`
+	// data keys of the source that differ in the copy
+	ChangedKeys []string `json:"changedKeys,omitempty"`
+	// why the copy, or the target of a missing copy, can not be compared with the source
+	Error string `json:"error,omitempty"`
+}
+
+// SourceStatus lists the copies of a source in the source cluster and in every context
+type SourceStatus struct {
+	Kind            api.SourceKind `json:"kind"`
+	Namespace       string         `json:"namespace"`
+	Name            string         `json:"name"`
+	ResourceVersion string         `json:"resourceVersion"`
+	SyncStatus      *SyncStatus    `json:"syncStatus,omitempty"`
+	Copies          []CopyStatus   `json:"copies"`
+	// errors of contexts that can not be used or listed, keyed by context
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// ConfigMapStatus finds the copies of src using the origin labels and compares them with src
+func (s *ConfigSyncer) ConfigMapStatus(src *core.ConfigMap) (*SourceStatus, error) {
+	list := func(kc kubernetes.Interface) ([]metav1.Object, error) {
+		copies, err := configMapForSelector(kc, s.syncerLabelSelector(src.Name, src.Namespace, s.clusterName))
+		if err != nil {
+			return nil, err
+		}
+		out := make([]metav1.Object, 0, len(copies))
+		for i := range copies {
+			out = append(out, &copies[i])
+		}
+		return out, nil
+	}
+	return s.sourceStatus(api.SourceKindConfigMap, src, list, func(t planTarget, opts SyncOptions, namespace, name string) (*PlannedChange, error) {
+		return s.planConfigMapCopy(t, src, opts, namespace, name)
+	})
+}
+
+// SecretStatus finds the copies of src using the origin labels and compares them with src
+func (s *ConfigSyncer) SecretStatus(src *core.Secret) (*SourceStatus, error) {
+	list := func(kc kubernetes.Interface) ([]metav1.Object, error) {
+		copies, err := secretForSelector(kc, s.syncerLabelSelector(src.Name, src.Namespace, s.clusterName))
+		if err != nil {
+			return nil, err
+		}
+		out := make([]metav1.Object, 0, len(copies))
+		for i := range copies {
+			out = append(out, &copies[i])
+		}
+		return out, nil
+	}
+	return s.sourceStatus(api.SourceKindSecret, src, list, func(t planTarget, opts SyncOptions, namespace, name string) (*PlannedChange, error) {
+		return s.planSecretCopy(t, src, opts, namespace, name)
+	})
+}
+
+func (s *ConfigSyncer) sourceStatus(
+	kind api.SourceKind,
+	src metav1.Object,
+	list func(kc kubernetes.Interface) ([]metav1.Object, error),
+	plan func(t planTarget, opts SyncOptions, namespace, name string) (*PlannedChange, error),
+) (*SourceStatus, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	syncStatus, err := GetSyncStatus(src.GetAnnotations())
+	if err != nil {
+		return nil, err
+	}
+	opts := s.syncOptionsFor(kind, src)
+	targets, err := s.planTargets(opts, src.GetNamespace(), src.GetName())
+	if err != nil {
+		return nil, err
+	}
+
+	status := &SourceStatus{
+		Kind:            kind,
+		Namespace:       src.GetNamespace(),
+		Name:            src.GetName(),
+		ResourceVersion: src.GetResourceVersion(),
+		SyncStatus:      syncStatus,
+		Copies:          []CopyStatus{},
+	}
+	for _, t := range targets {
+		// contexts that can not be used are reported, not listed
+		var copies []metav1.Object
+		err := t.err
+		if err == nil && t.client == nil {
+			err = errors.Errorf("no client for context %s", t.context)
+		}
+		if err == nil {
+			copies, err = list(t.client)
+		}
+		if err != nil {
+			if status.Errors == nil {
+				status.Errors = map[string]string{}
+			}
+			status.Errors[t.context] = err.Error()
+			continue
+		}
+
+		name := opts.CopyName(src.GetName(), t.context)
+		found := sets.NewString()
+		for _, obj := range copies {
+			if t.context == "" && obj.GetNamespace() == src.GetNamespace() {
+				continue // the source itself
+			}
+			cs := CopyStatus{
+				Context:   t.context,
+				Namespace: obj.GetNamespace(),
+				Name:      obj.GetName(),
+				State:     CopyStateCurrent,
+			}
+			if origin, err := GetOrigin(obj.GetAnnotations()); err == nil && origin != nil {
+				cs.SourceResourceVersion = origin.ResourceVersion
+			}
+			// writing the sync status changes the resourceVersion of the source after its copies were written
+			cs.ResourceVersionMatches = cs.SourceResourceVersion == src.GetResourceVersion() ||
+				cs.SourceResourceVersion == sourceResourceVersion(src)
+
+			// a copy that can not be compared does not stop comparing the others, like syncs continue past failed targets
+			change, err := plan(t, opts, obj.GetNamespace(), obj.GetName())
+			switch {
+			case err != nil:
+				cs.State, cs.Error = CopyStateUnknown, err.Error()
+			case change != nil:
+				cs.State = CopyStateStale
+				cs.ChangedKeys = append(append(append([]string{}, change.AddedKeys...), change.ChangedKeys...), change.RemovedKeys...)
+				cs.DataMatches = len(cs.ChangedKeys) == 0
+			default:
+				cs.DataMatches = true
+			}
+			if !t.namespaces.Has(obj.GetNamespace()) || obj.GetName() != name {
+				cs.State = CopyStateOrphaned
+			} else {
+				found.Insert(obj.GetNamespace())
+			}
+			status.Copies = append(status.Copies, cs)
+		}
+
+		for _, ns := range t.namespaces.Difference(found).List() {
+			cs := CopyStatus{
+				Context:   t.context,
+				Namespace: ns,
+				Name:      name,
+				State:     CopyStateMissing,
+			}
+			if change, err := plan(t, opts, ns, name); err != nil {
+				cs.Error = err.Error() // it is unknown whether another object has the name of the copy
+			} else if change != nil && change.Action == PlanActionSkip {
+				cs.State = CopyStateConflict
+			}
+			status.Copies = append(status.Copies, cs)
+		}
+	}
+	return status, nil
+}
@@ -0,0 +1,100 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestStatusReportsUnusableContexts(t *testing.T) {
+	src := &core.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "omni",
+			Namespace:   "demo",
+			Annotations: map[string]string{ConfigSyncKey: "", ConfigSyncContexts: "typo"},
+		},
+		Data: map[string]string{"k": "v"},
+	}
+	kc := fake.NewSimpleClientset(
+		&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "demo"}},
+		&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "a"}},
+		src,
+	)
+	s := New(kc, nil, nil, record.NewFakeRecorder(10), Options{})
+	s.clusterID = "hub"
+
+	status, err := s.ConfigMapStatus(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status.Errors) != 1 || status.Errors["typo"] == "" {
+		t.Errorf("errors = %v, want one for context typo", status.Errors)
+	}
+	if len(status.Copies) != 1 || status.Copies[0].Namespace != "a" || status.Copies[0].State != CopyStateMissing {
+		t.Errorf("copies = %+v, want the missing copy in namespace a", status.Copies)
+	}
+}
+
+func TestStatusContinuesPastFailedCopies(t *testing.T) {
+	src := &core.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "omni",
+			Namespace:   "demo",
+			Annotations: map[string]string{ConfigSyncKey: ""},
+		},
+		Data: map[string]string{"k": "v"},
+	}
+	kc := fake.NewSimpleClientset(
+		&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "demo"}},
+		&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "a"}},
+		&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "b"}},
+		src,
+	)
+	s := New(kc, nil, nil, record.NewFakeRecorder(10), Options{})
+	if err := s.SyncConfigMap(src); err != nil {
+		t.Fatal(err)
+	}
+	kc.PrependReactor("get", "configmaps", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		if action.GetNamespace() == "b" {
+			return true, nil, errors.New("connection refused")
+		}
+		return false, nil, nil
+	})
+
+	status, err := s.ConfigMapStatus(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	states := map[string]CopyStatus{}
+	for _, c := range status.Copies {
+		states[c.Namespace] = c
+	}
+	if c := states["a"]; c.State != CopyStateCurrent || c.Error != "" {
+		t.Errorf("copy in namespace a = %+v, want it current", c)
+	}
+	if c := states["b"]; c.State != CopyStateUnknown || c.Error == "" {
+		t.Errorf("copy in namespace b = %+v, want it unknown with an error", c)
+	}
+}
@@ -0,0 +1,143 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"kubeops.dev/config-syncer/pkg/eventer"
+
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	kutil "kmodules.xyz/client-go"
+)
+
+// object is a source or copy events can be recorded on
+type object interface {
+	runtime.Object
+	metav1.Object
+}
+
+// syncAndRecord syncs a copy of src with sync, remembers the attempt and records its outcome on src.
+// Successful syncs are only recorded for sources that are synced somewhere, as every configmap and
+// secret is reconciled, and only if copies changed or the last sync failed, so resyncs record none.
+func (s *ConfigSyncer) syncAndRecord(resource string, src object, opts SyncOptions, sync func(src object) error) error {
+	recovering := s.lastSyncFailed(resource, src)
+	cp := src.DeepCopyObject().(object)
+	progress := &syncProgress{written: sets.NewString(), namespaces: sets.NewString()}
+	s.running.Store(cp, progress)
+	err := sync(cp)
+	s.running.Delete(cp)
+	s.finishAttempt(resource, src, opts, err, progress)
+
+	if err != nil {
+		s.recorder.Eventf(src, core.EventTypeWarning, eventer.EventReasonSyncFailed, "Failed to sync: %v", err)
+	} else if (opts.syncsNamespaces() || opts.Contexts.Len() > 0) && (atomic.LoadInt32(&progress.changes) > 0 || recovering) {
+		s.recorder.Event(src, core.EventTypeNormal, eventer.EventReasonSyncSucceeded, "Copies are up to date")
+	}
+	return err
+}
+
+// syncProgress tracks a sync started by syncAndRecord
+type syncProgress struct {
+	// copies written or deleted
+	changes int32
+
+	lock sync.Mutex
+	// keys of the targets holding an up to date copy, see TargetError.Target
+	written sets.String
+	// namespaces of the source cluster holding a copy, up to date or kept as writing it failed
+	namespaces sets.String
+}
+
+// countChange counts a copy written or deleted by the running sync of src
+func (s *ConfigSyncer) countChange(src object) {
+	if v, ok := s.running.Load(src); ok {
+		atomic.AddInt32(&v.(*syncProgress).changes, 1)
+	}
+}
+
+// markWritten records that namespace of ctx holds an up to date copy of src after the running sync of src
+func (s *ConfigSyncer) markWritten(src object, namespace, ctx string) {
+	if v, ok := s.running.Load(src); ok {
+		p := v.(*syncProgress)
+		p.lock.Lock()
+		p.written.Insert(targetKey(namespace, ctx))
+		if ctx == "" {
+			p.namespaces.Insert(namespace)
+		}
+		p.lock.Unlock()
+	}
+}
+
+// markKept records that namespace of the source cluster holds an older copy of src, as writing it failed
+// in the running sync of src
+func (s *ConfigSyncer) markKept(src object, namespace string) {
+	if v, ok := s.running.Load(src); ok {
+		p := v.(*syncProgress)
+		p.lock.Lock()
+		p.namespaces.Insert(namespace)
+		p.lock.Unlock()
+	}
+}
+
+// recordCopyWritten records that a copy was created or updated, both on the source and on copies in the source cluster
+func (s *ConfigSyncer) recordCopyWritten(src, obj object, verb kutil.VerbType, ctx string) {
+	if verb != kutil.VerbUnchanged {
+		s.countChange(src)
+	}
+	switch verb {
+	case kutil.VerbCreated:
+		s.recordCopyEvent(src, obj, ctx, eventer.EventReasonCopyCreated,
+			"Created copy in %s", "Created as a copy of %s")
+	case kutil.VerbPatched, kutil.VerbUpdated:
+		s.recordCopyEvent(src, obj, ctx, eventer.EventReasonCopyUpdated,
+			"Updated copy in %s", "Updated from %s")
+	}
+}
+
+// recordCopyDeleted records that a copy was deleted on the source. The copy no longer exists, so it gets none.
+func (s *ConfigSyncer) recordCopyDeleted(src, obj object, ctx string) {
+	s.countChange(src)
+	s.recordCopyEvent(src, obj, ctx, eventer.EventReasonCopyDeleted, "Deleted copy from %s", "")
+}
+
+// recordCopyEvent formats srcMsg with the target and copyMsg with the source namespace/name. Copies get no event
+// if copyMsg is empty. Events can only be recorded in the source cluster, so copies in other contexts get none.
+func (s *ConfigSyncer) recordCopyEvent(src, obj object, ctx, reason, srcMsg, copyMsg string) {
+	if recordable(src) {
+		s.recorder.Eventf(src, core.EventTypeNormal, reason, srcMsg, targetString(obj.GetNamespace(), ctx))
+	}
+	if ctx == "" && copyMsg != "" && recordable(obj) {
+		s.recorder.Eventf(obj, core.EventTypeNormal, reason, copyMsg, src.GetNamespace()+"/"+src.GetName())
+	}
+}
+
+// recordable checks whether events can be recorded on obj. Events on objects being deleted would be
+// left behind with nothing to link them to.
+func recordable(obj metav1.Object) bool {
+	return obj.GetDeletionTimestamp() == nil
+}
+
+// deletedAt marks the stand-in for a deleted source, so that no events are recorded on it
+func deletedAt() *metav1.Time {
+	now := metav1.Now()
+	return &now
+}
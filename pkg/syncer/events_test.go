@@ -0,0 +1,191 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	api "kubeops.dev/config-syncer/apis/kubed/v1alpha1"
+	"kubeops.dev/config-syncer/pkg/eventer"
+
+	"github.com/pkg/errors"
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestSyncSucceededEvent(t *testing.T) {
+	src := &core.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "omni",
+			Namespace:       "demo",
+			ResourceVersion: "5",
+			Annotations:     map[string]string{ConfigSyncKey: ""},
+		},
+		Data: map[string]string{"k": "v"},
+	}
+	kc := fake.NewSimpleClientset(
+		&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "demo"}},
+		&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "a"}},
+		src,
+	)
+	recorder := record.NewFakeRecorder(100)
+	s := New(kc, nil, nil, recorder, Options{})
+	opts := s.syncOptionsFor(api.SourceKindConfigMap, src)
+
+	// recorded returns the reasons of the events recorded since the last call
+	recorded := func() []string {
+		var reasons []string
+		for {
+			select {
+			case e := <-recorder.Events:
+				reasons = append(reasons, strings.Fields(e)[1])
+			default:
+				return reasons
+			}
+		}
+	}
+	has := func(reasons []string, reason string) bool {
+		for _, r := range reasons {
+			if r == reason {
+				return true
+			}
+		}
+		return false
+	}
+	syncConfigMap := func(src object) error {
+		return s.SyncConfigMap(src.(*core.ConfigMap))
+	}
+
+	steps := []struct {
+		name        string
+		sync        func(src object) error
+		wantReasons []string
+		wantNone    []string
+	}{
+		{
+			name:        "copy created",
+			sync:        syncConfigMap,
+			wantReasons: []string{eventer.EventReasonCopyCreated, eventer.EventReasonSyncSucceeded},
+		},
+		{
+			name:     "nothing changed",
+			sync:     syncConfigMap,
+			wantNone: []string{eventer.EventReasonSyncSucceeded},
+		},
+		{
+			name: "failed",
+			sync: func(object) error {
+				return errors.New("boom")
+			},
+			wantReasons: []string{eventer.EventReasonSyncFailed},
+			wantNone:    []string{eventer.EventReasonSyncSucceeded},
+		},
+		{
+			name:        "recovered",
+			sync:        syncConfigMap,
+			wantReasons: []string{eventer.EventReasonSyncSucceeded},
+			wantNone:    []string{eventer.EventReasonCopyUpdated},
+		},
+		{
+			name:     "nothing changed after recovery",
+			sync:     syncConfigMap,
+			wantNone: []string{eventer.EventReasonSyncSucceeded},
+		},
+	}
+	for _, step := range steps {
+		_ = s.syncAndRecord(resourceConfigMaps, src, opts, step.sync)
+		reasons := recorded()
+		for _, r := range step.wantReasons {
+			if !has(reasons, r) {
+				t.Errorf("%s: recorded %v, want %s", step.name, reasons, r)
+			}
+		}
+		for _, r := range step.wantNone {
+			if has(reasons, r) {
+				t.Errorf("%s: recorded %v, want no %s", step.name, reasons, r)
+			}
+		}
+	}
+}
+
+func TestNoEventsOnDeletedObjects(t *testing.T) {
+	src := &core.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "omni",
+			Namespace:   "demo",
+			Annotations: map[string]string{ConfigSyncKey: ""},
+		},
+		Data: map[string]string{"k": "v"},
+	}
+	kc := fake.NewSimpleClientset(
+		&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "demo"}},
+		&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "a"}},
+		src,
+	)
+	recorder := record.NewFakeRecorder(100)
+	s := New(kc, nil, nil, recorder, Options{})
+	if err := s.SyncConfigMap(src); err != nil {
+		t.Fatal(err)
+	}
+	// recorded returns the events recorded since the last call
+	recorded := func() []string {
+		var events []string
+		for {
+			select {
+			case e := <-recorder.Events:
+				events = append(events, e)
+			default:
+				return events
+			}
+		}
+	}
+	recorded()
+
+	// the copy is deleted as the source no longer syncs, the event is recorded on the source only
+	unsynced := src.DeepCopy()
+	delete(unsynced.Annotations, ConfigSyncKey)
+	if err := s.SyncConfigMap(unsynced); err != nil {
+		t.Fatal(err)
+	}
+	if events := recorded(); len(events) != 1 || !strings.Contains(events[0], "Deleted copy from namespace a") {
+		t.Errorf("recorded %v, want one event on the source", events)
+	}
+
+	// the source is deleted, no event is recorded at all
+	if err := s.SyncConfigMap(src); err != nil {
+		t.Fatal(err)
+	}
+	recorded()
+	if err := kc.CoreV1().ConfigMaps("demo").Delete(context.TODO(), "omni", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	deleted := &core.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "omni", Namespace: "demo", DeletionTimestamp: deletedAt()}}
+	if err := s.SyncDeletedConfigMap(deleted); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kc.CoreV1().ConfigMaps("a").Get(context.TODO(), "omni", metav1.GetOptions{}); !kerr.IsNotFound(err) {
+		t.Errorf("copy kept after the source was deleted: %v", err)
+	}
+	if events := recorded(); len(events) > 0 {
+		t.Errorf("recorded %v on deleted objects, want none", events)
+	}
+}
@@ -0,0 +1,132 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"sync"
+)
+
+const (
+	DefaultMaxParallelWrites           = 20
+	DefaultMaxParallelWritesPerCluster = 5
+)
+
+// fanOut bounds the number of copies written in parallel, in total and per cluster, and the number
+// of contexts synced in parallel. Slots are shared by all sources being synced at the same time.
+type fanOut struct {
+	global     chan struct{}
+	perCluster int
+	// contexts are bounded separately from the writes, as syncing a context waits for its writes
+	contexts chan struct{}
+
+	lock     sync.Mutex
+	clusters map[string]chan struct{}
+}
+
+func newFanOut(limit, perCluster int) *fanOut {
+	if limit < 1 {
+		limit = DefaultMaxParallelWrites
+	}
+	if perCluster < 1 {
+		perCluster = DefaultMaxParallelWritesPerCluster
+	}
+	return &fanOut{
+		global:     make(chan struct{}, limit),
+		perCluster: perCluster,
+		contexts:   make(chan struct{}, limit),
+		clusters:   map[string]chan struct{}{},
+	}
+}
+
+func (f *fanOut) clusterSlots(cluster string) chan struct{} {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	slots, found := f.clusters[cluster]
+	if !found {
+		slots = make(chan struct{}, f.perCluster)
+		f.clusters[cluster] = slots
+	}
+	return slots
+}
+
+// run calls fn for every item in parallel, each call holding a slot of cluster and a global slot.
+// It waits for all calls and returns their errors in the order of items.
+func (f *fanOut) run(cluster string, n int, fn func(i int) error) []error {
+	errs := make([]error, n)
+	if n == 0 {
+		return errs
+	}
+	slots := f.clusterSlots(cluster)
+
+	var wg sync.WaitGroup
+	next := make(chan int)
+	workers := f.perCluster
+	if n < workers {
+		workers = n
+	}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				// always take the cluster slot first, so that writes never wait for each other in a cycle
+				slots <- struct{}{}
+				f.global <- struct{}{}
+				errs[i] = fn(i)
+				<-f.global
+				<-slots
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return errs
+}
+
+// forEachContext calls fn for every context in parallel, at most as many calls as copies may be
+// written in total, and returns their errors in the order of contexts. The copies they write hold
+// slots of their own.
+func (f *fanOut) forEachContext(contexts []string, fn func(ctx string) error) []error {
+	errs := make([]error, len(contexts))
+	var wg sync.WaitGroup
+	for i, ctx := range contexts {
+		f.contexts <- struct{}{}
+		wg.Add(1)
+		go func(i int, ctx string) {
+			defer wg.Done()
+			defer func() { <-f.contexts }()
+			errs[i] = fn(ctx)
+		}(i, ctx)
+	}
+	wg.Wait()
+	return errs
+}
+
+// clusterKey identifies the cluster of ctx for per cluster limits, ctx is empty for the source cluster
+func (s *ConfigSyncer) clusterKey(ctx string) string {
+	if ctx == "" {
+		return ""
+	}
+	if id, err := s.contextID(s.contexts[ctx]); err == nil {
+		return id
+	}
+	return ctx
+}
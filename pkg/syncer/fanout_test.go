@@ -0,0 +1,124 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// gauge tracks the maximum number of calls running at the same time
+type gauge struct {
+	cur, max int32
+}
+
+func (g *gauge) call(fn func() error) error {
+	n := atomic.AddInt32(&g.cur, 1)
+	for {
+		max := atomic.LoadInt32(&g.max)
+		if n <= max || atomic.CompareAndSwapInt32(&g.max, max, n) {
+			break
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+	defer atomic.AddInt32(&g.cur, -1)
+	return fn()
+}
+
+func TestFanOutPerClusterLimit(t *testing.T) {
+	f := newFanOut(10, 2)
+	var g gauge
+	f.run("east", 8, func(i int) error {
+		return g.call(func() error { return nil })
+	})
+	if g.max != 2 {
+		t.Errorf("max parallel writes = %d, want 2", g.max)
+	}
+}
+
+func TestFanOutGlobalLimit(t *testing.T) {
+	f := newFanOut(3, 2)
+	var g gauge
+	var wg sync.WaitGroup
+	for _, cluster := range []string{"", "east", "west"} {
+		wg.Add(1)
+		go func(cluster string) {
+			defer wg.Done()
+			f.run(cluster, 6, func(i int) error {
+				return g.call(func() error { return nil })
+			})
+		}(cluster)
+	}
+	wg.Wait()
+	if g.max > 3 {
+		t.Errorf("max parallel writes = %d, want at most 3", g.max)
+	}
+}
+
+func TestFanOutErrorOrder(t *testing.T) {
+	f := newFanOut(4, 3)
+	errs := f.run("", 10, func(i int) error {
+		time.Sleep(time.Duration(10-i) * time.Millisecond) // later items finish first
+		if i%2 == 1 {
+			return fmt.Errorf("%d", i)
+		}
+		return nil
+	})
+	if len(errs) != 10 {
+		t.Fatalf("got %d errors, want 10", len(errs))
+	}
+	for i, err := range errs {
+		switch {
+		case i%2 == 0 && err != nil:
+			t.Errorf("errs[%d] = %v, want nil", i, err)
+		case i%2 == 1 && (err == nil || err.Error() != strconv.Itoa(i)):
+			t.Errorf("errs[%d] = %v, want %d", i, err, i)
+		}
+	}
+	if errs := f.run("", 0, nil); len(errs) != 0 {
+		t.Errorf("got %d errors for no items, want none", len(errs))
+	}
+}
+
+func TestFanOutForEachContext(t *testing.T) {
+	f := newFanOut(2, 1)
+	contexts := []string{"a", "b", "c", "d", "e"}
+	var g gauge
+	errs := f.forEachContext(contexts, func(ctx string) error {
+		return g.call(func() error {
+			// writes of a context take slots of their own, so they do not wait for the context slots
+			f.run(ctx, 2, func(i int) error { return nil })
+			if ctx == "b" || ctx == "e" {
+				return fmt.Errorf("%s", ctx)
+			}
+			return nil
+		})
+	})
+	if g.max != 2 {
+		t.Errorf("max parallel contexts = %d, want 2", g.max)
+	}
+	for i, err := range errs {
+		want := contexts[i] == "b" || contexts[i] == "e"
+		if (err != nil) != want || (want && err.Error() != contexts[i]) {
+			t.Errorf("errs[%d] = %v, want error of context %s: %v", i, err, contexts[i], want)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"kubeops.dev/config-syncer/pkg/eventer"
+
+	"github.com/pkg/errors"
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/selection"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/klog/v2"
+)
+
+// CollectGarbage deletes copies left behind by sources that no longer exist or
+// no longer select the namespace or context holding the copy. This catches
+// deletions and annotation changes that happened while config-syncer was down.
+func (s *ConfigSyncer) CollectGarbage() error {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	klog.Infoln("collecting orphaned copies ...")
+
+	var errs []error
+	if s.agent == nil { // agents only read the hub cluster
+		for _, c := range s.copiers() {
+			errs = append(errs, s.collect(c, s.clusterFor(""), ""))
+		}
+	}
+
+	taken := map[string]struct{}{}
+	for ctxName, ctx := range s.contexts {
+		id, err := s.contextID(ctx)
+		if err != nil {
+			errs = append(errs, errors.Wrapf(err, "context %s", ctxName))
+			continue
+		}
+		if _, found := taken[id]; found || id == s.clusterID {
+			continue // avoid sweeping same cluster twice, or the source cluster as another cluster
+		}
+		taken[id] = struct{}{}
+
+		for _, c := range s.copiers() {
+			if err := s.collect(c, ctx, id); err != nil {
+				errs = append(errs, errors.Wrapf(err, "context %s", ctxName))
+			}
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// collect deletes the orphaned copies of kind c in cluster. Sources are read through the informer listers,
+// clusterID is empty for copies in the source cluster.
+func (s *ConfigSyncer) collect(c copier, cluster clusterContext, clusterID string) error {
+	copies, err := c.list(cluster, s.copySelector())
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, obj := range copies {
+		srcName, srcNamespace := obj.GetLabels()[OriginNameLabelKey], obj.GetLabels()[OriginNamespaceLabelKey]
+		if clusterID == "" && srcName == obj.GetName() && srcNamespace == obj.GetNamespace() {
+			continue // never treat a source as its own copy
+		}
+
+		var src runtime.Object
+		if cur, err := c.source(srcNamespace, srcName); err == nil {
+			wanted, err := s.copyWanted(c.options(cur), cur.GetNamespace(), cur.GetName(), clusterID, obj)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			} else if wanted {
+				continue
+			}
+			src = cur
+		} else if !kerr.IsNotFound(err) {
+			errs = append(errs, err)
+			continue
+		}
+		if !s.ownCopy(src, obj) {
+			continue
+		}
+
+		if err := c.delete(cluster, obj); err != nil && !kerr.IsNotFound(err) {
+			errs = append(errs, err)
+			continue
+		}
+		s.recordOrphanDeleted(c.resource(), src, obj, clusterID)
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// copiers returns a copier for every kind of source that is synced
+func (s *ConfigSyncer) copiers() []copier {
+	out := []copier{configMapCopier{s}, secretCopier{s}}
+	for _, rs := range s.resources {
+		out = append(out, resourceCopier{s, rs.ResourceRule})
+	}
+	return out
+}
+
+// copySelector selects every copy that originates from this cluster
+func (s *ConfigSyncer) copySelector() labels.Selector {
+	sel := labels.SelectorFromSet(labels.Set{OriginClusterLabelKey: s.clusterName})
+	for _, key := range []string{OriginNameLabelKey, OriginNamespaceLabelKey} {
+		req, _ := labels.NewRequirement(key, selection.Exists, nil)
+		sel = sel.Add(*req)
+	}
+	return sel
+}
+
+// ownCopy checks whether obj was copied by this cluster. Copies are selected by their origin.cluster label
+// only, which other clusters using the same cluster name set as well. Copies of a source that exists carry its UID
+// in their origin annotation. Otherwise, src is nil or was recreated, and the copy is ours if it records the ID of
+// this cluster. Copies written before the ID was recorded are only known to be ours if the cluster name is set.
+func (s *ConfigSyncer) ownCopy(src runtime.Object, obj metav1.Object) bool {
+	ref, err := GetOrigin(obj.GetAnnotations())
+	if err != nil || ref == nil {
+		return false
+	}
+	if src != nil {
+		if m, err := meta.Accessor(src); err == nil && m.GetUID() == ref.UID {
+			return true
+		}
+	}
+	if id, found := obj.GetAnnotations()[OriginClusterIDKey]; found && s.clusterID != "" {
+		return id == s.clusterID
+	}
+	if s.clusterName == "" {
+		klog.V(4).Infof("skipping copy %s/%s, it may have been written by another cluster without a cluster name", obj.GetNamespace(), obj.GetName())
+		return false
+	}
+	return true
+}
+
+// copyWanted checks whether the source still selects the namespace of the copy in the
+// cluster with ID clusterID and still uses the name of the copy. clusterID is empty for the source cluster.
+func (s *ConfigSyncer) copyWanted(opts SyncOptions, srcNamespace, srcName, clusterID string, obj metav1.Object) (bool, error) {
+	namespace := obj.GetNamespace()
+
+	if clusterID != "" {
+		for _, ctxName := range opts.Contexts.List() {
+			ctx, found := s.contexts[ctxName]
+			if !found || opts.CopyName(srcName, ctxName) != obj.GetName() {
+				continue
+			}
+			if id, err := s.contextID(ctx); err != nil {
+				return false, err
+			} else if id != clusterID {
+				continue
+			}
+			// like the sync, the namespace must be selected and accept copies of the source
+			selected, err := contextNamespaces(opts, ctxName, ctx, srcNamespace, srcName)
+			if err != nil {
+				return false, err
+			}
+			if selected.Has(namespace) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	if !opts.syncsNamespaces() || namespace == srcNamespace || opts.CopyName(srcName, "") != obj.GetName() {
+		return false, nil
+	}
+	ns, err := s.getNamespace(namespace)
+	if err != nil {
+		return false, err
+	}
+	selected, err := opts.selectsNamespace(ns)
+	if err != nil {
+		return false, err
+	}
+	return selected && NamespaceAccepts(ns, srcNamespace, srcName), nil
+}
+
+func (s *ConfigSyncer) recordOrphanDeleted(resource string, src runtime.Object, obj metav1.Object, clusterID string) {
+	orphansDeleted.WithLabelValues(resource, clusterID).Inc()
+
+	where := "namespace " + obj.GetNamespace()
+	if clusterID != "" {
+		where += " of cluster " + clusterID
+	}
+	klog.Infof("deleted orphaned copy %s/%s from %s", obj.GetNamespace(), obj.GetName(), where)
+
+	// the deleted copy gets no event, it would be left behind with nothing to link it to
+	if src != nil {
+		s.recorder.Eventf(
+			src,
+			core.EventTypeNormal,
+			eventer.EventReasonOrphanDeleted,
+			"Deleted orphaned copy %s from %s", obj.GetName(), where,
+		)
+	}
+}
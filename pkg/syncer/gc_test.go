@@ -0,0 +1,198 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"testing"
+
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes/fake"
+	core_listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+)
+
+func newCopy(name, namespace, srcName, srcNamespace, cluster string, srcUID types.UID) *core.ConfigMap {
+	return &core.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels: map[string]string{
+				OriginNameLabelKey:      srcName,
+				OriginNamespaceLabelKey: srcNamespace,
+				OriginClusterLabelKey:   cluster,
+			},
+			Annotations: map[string]string{
+				ConfigOriginKey: `{"kind":"ConfigMap","namespace":"` + srcNamespace + `","name":"` + srcName + `","uid":"` + string(srcUID) + `"}`,
+			},
+		},
+	}
+}
+
+func TestCollectGarbageSkipsForeignCopies(t *testing.T) {
+	tests := []struct {
+		clusterName string
+		deleted     []string
+	}{
+		{clusterName: "", deleted: []string{"omni"}},
+		{clusterName: "hub", deleted: []string{"omni", "foreign", "gone"}},
+	}
+	for _, tt := range tests {
+		t.Run("cluster="+tt.clusterName, func(t *testing.T) {
+			kc := fake.NewSimpleClientset(
+				&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "demo"}},
+				&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "other"}},
+				&core.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "omni", Namespace: "demo", UID: "local"}},
+				// the source no longer selects the namespace
+				newCopy("omni", "other", "omni", "demo", tt.clusterName, "local"),
+				// pushed by another cluster from a source of the same name
+				newCopy("foreign", "other", "omni", "demo", tt.clusterName, "remote"),
+				// pushed by another cluster from a source that does not exist here
+				newCopy("gone", "other", "gone", "demo", tt.clusterName, "remote"),
+			)
+			s := New(kc, nil, nil, record.NewFakeRecorder(10), Options{})
+			s.clusterName = tt.clusterName
+
+			if err := s.collect(configMapCopier{s}, s.clusterFor(""), ""); err != nil {
+				t.Fatal(err)
+			}
+			deleted := map[string]bool{}
+			for _, name := range tt.deleted {
+				deleted[name] = true
+			}
+			for _, name := range []string{"omni", "foreign", "gone"} {
+				_, err := kc.CoreV1().ConfigMaps("other").Get(context.TODO(), name, metav1.GetOptions{})
+				if got := kerr.IsNotFound(err); got != deleted[name] {
+					t.Errorf("copy %s deleted = %v, want %v (err: %v)", name, got, deleted[name], err)
+				}
+			}
+		})
+	}
+}
+
+// sources are read through the informer cache, which the copies are checked against
+func TestCollectGarbageReadsListers(t *testing.T) {
+	src := &core.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "omni", Namespace: "demo", UID: "local", Annotations: map[string]string{ConfigSyncKey: ""}},
+	}
+	kc := fake.NewSimpleClientset(
+		&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "demo"}},
+		&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "other"}},
+		newCopy("omni", "other", "omni", "demo", "hub", "local"),
+	)
+	s := New(kc, nil, nil, record.NewFakeRecorder(10), Options{})
+	s.clusterName = "hub"
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	if err := indexer.Add(src); err != nil {
+		t.Fatal(err)
+	}
+	s.cmLister = core_listers.NewConfigMapLister(indexer)
+
+	if err := s.collect(configMapCopier{s}, s.clusterFor(""), ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kc.CoreV1().ConfigMaps("other").Get(context.TODO(), "omni", metav1.GetOptions{}); err != nil {
+		t.Errorf("copy of a cached source was collected: %v", err)
+	}
+}
+
+// copies record the ID of the cluster they were copied from, so copies of deleted sources are collected
+// without a cluster name
+func TestCollectGarbageDefaultOptions(t *testing.T) {
+	withID := func(obj *core.ConfigMap, id string) *core.ConfigMap {
+		obj.Annotations[OriginClusterIDKey] = id
+		return obj
+	}
+	kc := fake.NewSimpleClientset(
+		&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: metav1.NamespaceSystem, UID: "hub-uid"}},
+		&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "demo"}},
+		&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "other"}},
+		// the source was deleted while config-syncer was down
+		withID(newCopy("gone", "other", "gone", "demo", "", "local"), "hub-uid"),
+		// pushed by another cluster without a cluster name
+		withID(newCopy("foreign", "other", "foreign", "demo", "", "remote"), "remote-uid"),
+		// written by an older release, which did not record the cluster ID
+		newCopy("legacy", "other", "legacy", "demo", "", "local"),
+	)
+	s := New(kc, nil, nil, record.NewFakeRecorder(10), Options{})
+	if err := s.Configure("", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.CollectGarbage(); err != nil {
+		t.Fatal(err)
+	}
+	for name, deleted := range map[string]bool{"gone": true, "foreign": false, "legacy": false} {
+		_, err := kc.CoreV1().ConfigMaps("other").Get(context.TODO(), name, metav1.GetOptions{})
+		if got := kerr.IsNotFound(err); got != deleted {
+			t.Errorf("copy %s deleted = %v, want %v (err: %v)", name, got, deleted, err)
+		}
+	}
+
+	// new copies record the ID
+	src := &core.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "omni", Namespace: "demo", UID: "src-uid", Annotations: map[string]string{ConfigSyncKey: ""}},
+	}
+	if err := s.SyncConfigMap(src); err != nil {
+		t.Fatal(err)
+	}
+	out, err := kc.CoreV1().ConfigMaps("other").Get(context.TODO(), "omni", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := out.Annotations[OriginClusterIDKey]; id != "hub-uid" {
+		t.Errorf("copy records cluster ID %q, want hub-uid", id)
+	}
+}
+
+// copies in the namespace of a context are only wanted while the namespace accepts them, like the sync decides
+func TestCopyWantedInContextNamespace(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		annotations map[string]string
+		want        bool
+	}{
+		{name: "accepting", want: true},
+		{name: "opted out", annotations: map[string]string{NamespaceSyncOptOutKey: "true"}, want: false},
+		{name: "source denied", annotations: map[string]string{NamespaceSyncDenyKey: "demo/omni"}, want: false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			remote := newCluster("east-uid")
+			if err := remote.Tracker().Add(&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team", Annotations: tt.annotations}}); err != nil {
+				t.Fatal(err)
+			}
+			s := New(fake.NewSimpleClientset(), nil, nil, record.NewFakeRecorder(10), Options{})
+			s.clusterID = "hub-uid"
+			s.contexts = map[string]clusterContext{"east": {Client: remote, Namespace: "team"}}
+
+			opts := SyncOptions{Contexts: sets.NewString("east")}
+			obj := newCopy("omni", "team", "omni", "demo", "", "local")
+			got, err := s.copyWanted(opts, "demo", "omni", "east-uid", obj)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("copyWanted() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+
+	api "kubeops.dev/config-syncer/apis/kubed/v1alpha1"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// SyncSourceIndex indexes sources carrying the kubed.appscode.com/sync annotation
+	SyncSourceIndex = "syncSource"
+	// OriginIndex indexes copies by the cluster, namespace and name of their source, as recorded in their origin labels
+	OriginIndex = "origin"
+
+	syncSourceIndexValue = "namespaces"
+)
+
+func SyncSourceIndexFunc(obj interface{}) ([]string, error) {
+	m, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, nil
+	}
+	if _, found := m.GetAnnotations()[ConfigSyncKey]; found {
+		return []string{syncSourceIndexValue}, nil
+	}
+	return nil, nil
+}
+
+func OriginIndexFunc(obj interface{}) ([]string, error) {
+	m, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, nil
+	}
+	l := m.GetLabels()
+	name, found := l[OriginNameLabelKey]
+	if !found {
+		return nil, nil
+	}
+	namespace, found := l[OriginNamespaceLabelKey]
+	if !found {
+		return nil, nil
+	}
+	cluster, found := l[OriginClusterLabelKey]
+	if !found {
+		return nil, nil
+	}
+	return []string{originIndexKey(cluster, namespace, name)}, nil
+}
+
+func originIndexKey(cluster, namespace, name string) string {
+	return cluster + "/" + namespace + "/" + name
+}
+
+// SourceIndexers are the indexers ConfigMapHandler, SecretHandler and ResourceHandler expect on the
+// informers whose indexers are passed to them
+func SourceIndexers() cache.Indexers {
+	return cache.Indexers{
+		SyncSourceIndex: SyncSourceIndexFunc,
+		OriginIndex:     OriginIndexFunc,
+	}
+}
+
+// namespaceSources returns the cached sources that may sync into namespaces of the source cluster,
+// the ones with the sync annotation and, for ConfigMaps and Secrets, the ones referred to by ConfigSyncs
+func (s *ConfigSyncer) namespaceSources(indexer cache.Indexer, kind api.SourceKind) ([]interface{}, error) {
+	if indexer == nil {
+		return nil, nil // sources of this kind are not watched
+	}
+	objs, err := indexer.ByIndex(SyncSourceIndex, syncSourceIndexValue)
+	if err != nil {
+		return nil, err
+	}
+	if s.csIndexer == nil || kind == "" {
+		return objs, nil
+	}
+
+	keys := sets.NewString()
+	for _, obj := range objs {
+		if key, err := cache.MetaNamespaceKeyFunc(obj); err == nil {
+			keys.Insert(key)
+		}
+	}
+	for _, v := range s.csIndexer.List() {
+		cs, ok := v.(*api.ConfigSync)
+		if !ok || cs.Spec.Source.Kind != kind {
+			continue
+		}
+		key := cs.Namespace + "/" + cs.Spec.Source.Name
+		if keys.Has(key) {
+			continue
+		}
+		obj, exists, err := indexer.GetByKey(key)
+		if err != nil {
+			return nil, err
+		} else if exists {
+			objs = append(objs, obj)
+			keys.Insert(key)
+		}
+	}
+	return objs, nil
+}
+
+// copiesCached checks whether copies in the source cluster can be looked up in indexer. Informers
+// restricted to the config source namespace do not see copies in other namespaces.
+func (s *ConfigSyncer) copiesCached(indexer cache.Indexer, ctx string) bool {
+	return ctx == "" && indexer != nil && s.sourceNamespace == ""
+}
+
+// configMapCopies returns the copies of src in namespace of the cluster of ctx, in all namespaces if
+// namespace is empty. ctx is empty for the source cluster.
+func (s *ConfigSyncer) configMapCopies(kc kubernetes.Interface, src *core.ConfigMap, ctx, namespace string) ([]core.ConfigMap, error) {
+	if !s.copiesCached(s.cmIndexer, ctx) {
+		copies, err := kc.CoreV1().ConfigMaps(namespace).List(context.TODO(), metav1.ListOptions{
+			LabelSelector: s.syncerLabelSelector(src.Name, src.Namespace, s.clusterName),
+		})
+		if err != nil {
+			return nil, err
+		}
+		return copies.Items, nil
+	}
+	objs, err := s.cmIndexer.ByIndex(OriginIndex, originIndexKey(s.clusterName, src.Namespace, src.Name))
+	if err != nil {
+		return nil, err
+	}
+	out := make([]core.ConfigMap, 0, len(objs))
+	for _, obj := range objs {
+		if cm, ok := obj.(*core.ConfigMap); ok && (namespace == "" || cm.Namespace == namespace) {
+			out = append(out, *cm)
+		}
+	}
+	return out, nil
+}
+
+// secretCopies returns the copies of src in namespace of the cluster of ctx, in all namespaces if
+// namespace is empty. ctx is empty for the source cluster.
+func (s *ConfigSyncer) secretCopies(kc kubernetes.Interface, src *core.Secret, ctx, namespace string) ([]core.Secret, error) {
+	if !s.copiesCached(s.secretIndexer, ctx) {
+		copies, err := kc.CoreV1().Secrets(namespace).List(context.TODO(), metav1.ListOptions{
+			LabelSelector: s.syncerLabelSelector(src.Name, src.Namespace, s.clusterName),
+		})
+		if err != nil {
+			return nil, err
+		}
+		return copies.Items, nil
+	}
+	objs, err := s.secretIndexer.ByIndex(OriginIndex, originIndexKey(s.clusterName, src.Namespace, src.Name))
+	if err != nil {
+		return nil, err
+	}
+	out := make([]core.Secret, 0, len(objs))
+	for _, obj := range objs {
+		if secret, ok := obj.(*core.Secret); ok && (namespace == "" || secret.Namespace == namespace) {
+			out = append(out, *secret)
+		}
+	}
+	return out, nil
+}
+
+// resourceCopies returns the copies of src in namespace of the cluster of ctx, in all namespaces if
+// namespace is empty. ctx is empty for the source cluster.
+func (s *ConfigSyncer) resourceCopies(dc dynamic.Interface, rule ResourceRule, src *unstructured.Unstructured, ctx, namespace string) ([]unstructured.Unstructured, error) {
+	var indexer cache.Indexer
+	if rs, found := s.resources[rule.GVR]; found {
+		indexer = rs.indexer
+	}
+	if !s.copiesCached(indexer, ctx) {
+		copies, err := dc.Resource(rule.GVR).Namespace(namespace).List(context.TODO(), metav1.ListOptions{
+			LabelSelector: s.syncerLabelSelector(src.GetName(), src.GetNamespace(), s.clusterName),
+		})
+		if err != nil {
+			return nil, err
+		}
+		return copies.Items, nil
+	}
+	objs, err := indexer.ByIndex(OriginIndex, originIndexKey(s.clusterName, src.GetNamespace(), src.GetName()))
+	if err != nil {
+		return nil, err
+	}
+	out := make([]unstructured.Unstructured, 0, len(objs))
+	for _, obj := range objs {
+		if u, ok := obj.(*unstructured.Unstructured); ok && (namespace == "" || u.GetNamespace() == namespace) {
+			out = append(out, *u)
+		}
+	}
+	return out, nil
+}
+
+// getNamespace returns a namespace of the source cluster, from the informer cache if available
+func (s *ConfigSyncer) getNamespace(name string) (*core.Namespace, error) {
+	if s.nsLister != nil {
+		return s.nsLister.Get(name)
+	}
+	return s.kubeClient.CoreV1().Namespaces().Get(context.TODO(), name, metav1.GetOptions{})
+}
+
+// targetNamespace returns a namespace of the cluster of ctx. Namespaces of the source cluster are served
+// from the informer cache if available, ctx is empty for the source cluster.
+func (s *ConfigSyncer) targetNamespace(kc kubernetes.Interface, name, ctx string) (*core.Namespace, error) {
+	if ctx == "" {
+		return s.getNamespace(name)
+	}
+	return kc.CoreV1().Namespaces().Get(context.TODO(), name, metav1.GetOptions{})
+}
+
+// localNamespacesForSource is namespacesForSource for the source cluster, served from the informer cache if available
+func (s *ConfigSyncer) localNamespacesForSource(opts SyncOptions, srcNamespace, srcName string) (sets.String, error) {
+	if s.nsLister == nil {
+		return namespacesForSource(s.kubeClient, opts, srcNamespace, srcName)
+	}
+	namespaces, err := s.nsLister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	return selectNamespaces(namespaces, opts, srcNamespace, srcName)
+}
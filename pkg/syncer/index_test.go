@@ -0,0 +1,188 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	api "kubeops.dev/config-syncer/apis/kubed/v1alpha1"
+
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestOriginIndexFunc(t *testing.T) {
+	tests := []struct {
+		name   string
+		labels map[string]string
+		want   []string
+	}{
+		{
+			name: "copy",
+			labels: map[string]string{
+				OriginNameLabelKey:      "omni",
+				OriginNamespaceLabelKey: "demo",
+				OriginClusterLabelKey:   "hub",
+			},
+			want: []string{"hub/demo/omni"},
+		},
+		{
+			name: "copy with empty cluster name",
+			labels: map[string]string{
+				OriginNameLabelKey:      "omni",
+				OriginNamespaceLabelKey: "demo",
+				OriginClusterLabelKey:   "",
+			},
+			want: []string{"/demo/omni"},
+		},
+		{
+			name: "missing cluster label",
+			labels: map[string]string{
+				OriginNameLabelKey:      "omni",
+				OriginNamespaceLabelKey: "demo",
+			},
+		},
+		{
+			name: "not a copy",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := OriginIndexFunc(&core.ConfigMap{ObjectMeta: metav1.ObjectMeta{Labels: tt.labels}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSyncSourceIndexFunc(t *testing.T) {
+	for annotations, want := range map[string][]string{
+		"":     nil,
+		"true": {syncSourceIndexValue},
+		"a=b":  {syncSourceIndexValue},
+	} {
+		obj := &core.Secret{}
+		if annotations != "" {
+			obj.Annotations = map[string]string{ConfigSyncKey: annotations}
+		}
+		got, err := SyncSourceIndexFunc(obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("sync annotation %q: got %v, want %v", annotations, got, want)
+		}
+	}
+	if got, _ := SyncSourceIndexFunc("not an object"); got != nil {
+		t.Errorf("got %v for an invalid object, want nil", got)
+	}
+}
+
+func TestNamespaceSources(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, SourceIndexers())
+	for _, cm := range []*core.ConfigMap{
+		{ObjectMeta: metav1.ObjectMeta{Name: "annotated", Namespace: "demo", Annotations: map[string]string{ConfigSyncKey: "true"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "referred", Namespace: "demo"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "both", Namespace: "demo", Annotations: map[string]string{ConfigSyncKey: "true"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "secret", Namespace: "demo"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "unsynced", Namespace: "demo"}},
+	} {
+		if err := indexer.Add(cm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	csIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, cs := range []*api.ConfigSync{
+		newConfigSync("referred", api.SourceKindConfigMap, "referred"),
+		newConfigSync("both", api.SourceKindConfigMap, "both"),
+		newConfigSync("twice", api.SourceKindConfigMap, "referred"),
+		newConfigSync("secret", api.SourceKindSecret, "secret"),
+		newConfigSync("missing", api.SourceKindConfigMap, "missing"),
+	} {
+		if err := csIndexer.Add(cs); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := New(fake.NewSimpleClientset(), nil, nil, record.NewFakeRecorder(10), Options{})
+	names := func(kind api.SourceKind) []string {
+		objs, err := s.namespaceSources(indexer, kind)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out []string
+		for _, obj := range objs {
+			out = append(out, obj.(*core.ConfigMap).Name)
+		}
+		sort.Strings(out)
+		return out
+	}
+
+	if got, want := names(api.SourceKindConfigMap), []string{"annotated", "both"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("without ConfigSyncs got %v, want %v", got, want)
+	}
+	s.csIndexer = csIndexer
+	if got, want := names(api.SourceKindConfigMap), []string{"annotated", "both", "referred"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := names(""), []string{"annotated", "both"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("for resources got %v, want %v", got, want)
+	}
+	if objs, err := s.namespaceSources(nil, api.SourceKindConfigMap); err != nil || objs != nil {
+		t.Errorf("got %v, %v for an unwatched kind, want nothing", objs, err)
+	}
+}
+
+func newConfigSync(name string, kind api.SourceKind, source string) *api.ConfigSync {
+	cs := &api.ConfigSync{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "demo"}}
+	cs.Spec.Source.Kind = kind
+	cs.Spec.Source.Name = source
+	return cs
+}
+
+func TestCopiesCached(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, SourceIndexers())
+	tests := []struct {
+		name            string
+		indexer         cache.Indexer
+		ctx             string
+		sourceNamespace string
+		want            bool
+	}{
+		{name: "source cluster", indexer: indexer, want: true},
+		{name: "context", indexer: indexer, ctx: "remote"},
+		{name: "not watched"},
+		{name: "restricted to source namespace", indexer: indexer, sourceNamespace: "config"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(fake.NewSimpleClientset(), nil, nil, record.NewFakeRecorder(10), Options{SourceNamespace: tt.sourceNamespace})
+			if got := s.copiesCached(tt.indexer, tt.ctx); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,359 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	api "kubeops.dev/config-syncer/apis/kubed/v1alpha1"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"k8s.io/klog/v2"
+	clientcmd_util "kmodules.xyz/client-go/tools/clientcmd"
+)
+
+// contextRetryPeriod is how often contexts whose clients could not be built are built again
+const contextRetryPeriod = time.Minute
+
+// loadContexts builds a clusterContext for every context of kubeconfigFile. Contexts whose clients can not
+// be built are kept with their error, so that they are not mistaken for removed ones. It also returns the
+// sha256 of the file.
+func loadContexts(kubeconfigFile string) (map[string]clusterContext, string, error) {
+	contexts := map[string]clusterContext{}
+	// Parse external kubeconfig file, assume that it doesn't include source cluster
+	if kubeconfigFile == "" {
+		return contexts, "", nil
+	}
+
+	data, err := os.ReadFile(kubeconfigFile)
+	if err != nil {
+		return nil, "", errors.Errorf("failed to parse context list. Reason: %v", err)
+	}
+	kConfig, err := clientcmd.Load(data)
+	if err != nil {
+		return nil, "", errors.Errorf("failed to parse context list. Reason: %v", err)
+	}
+	// resolve certificate and key files relative to the kubeconfig file, like clientcmd.LoadFromFile
+	for name, authInfo := range kConfig.AuthInfos {
+		authInfo.LocationOfOrigin = kubeconfigFile
+		kConfig.AuthInfos[name] = authInfo
+	}
+	for name, cluster := range kConfig.Clusters {
+		cluster.LocationOfOrigin = kubeconfigFile
+		kConfig.Clusters[name] = cluster
+	}
+	if err := clientcmd.ResolveLocalPaths(kConfig); err != nil {
+		return nil, "", errors.Errorf("failed to parse context list. Reason: %v", err)
+	}
+
+	for contextName := range kConfig.Contexts {
+		ctx, err := newClusterContext(kConfig, contextName)
+		if err != nil {
+			klog.Errorf("context %s of kubeconfig file %s can not be used: %v", contextName, kubeconfigFile, err)
+			ctx = clusterContext{Namespace: ctx.Namespace, err: err}
+		}
+		contexts[contextName] = ctx
+	}
+
+	sum := sha256.Sum256(data)
+	return contexts, hex.EncodeToString(sum[:]), nil
+}
+
+// newClusterContext builds the clients for a context of kConfig
+func newClusterContext(kConfig *clientcmdapi.Config, contextName string) (clusterContext, error) {
+	kctx, found := kConfig.Contexts[contextName]
+	if !found {
+		return clusterContext{}, errors.Errorf("context %s not found in kubeconfig file", contextName)
+	}
+	ctx := clusterContext{Namespace: kctx.Namespace}
+
+	cfg, err := clientcmd.NewNonInteractiveClientConfig(*kConfig, contextName, &clientcmd.ConfigOverrides{}, nil).ClientConfig()
+	if err != nil {
+		return ctx, err
+	}
+	cfg = clientcmd_util.Fix(cfg)
+	if ctx.Client, err = kubernetes.NewForConfig(cfg); err != nil {
+		return ctx, err
+	}
+	if ctx.DynamicClient, err = dynamic.NewForConfig(cfg); err != nil {
+		return ctx, err
+	}
+	probeCfg := rest.CopyConfig(cfg)
+	probeCfg.Timeout = contextProbeTimeout
+	if ctx.probe, err = kubernetes.NewForConfig(probeCfg); err != nil {
+		return ctx, err
+	}
+
+	u, err := url.Parse(cfg.Host)
+	if err != nil {
+		return ctx, err
+	}
+	host := u.Hostname()
+	port := u.Port()
+	if port == "" {
+		if u.Scheme == "https" {
+			port = "443"
+		} else if u.Scheme == "http" {
+			port = "80"
+		}
+	}
+	ctx.Address = host + ":" + port
+	return ctx, nil
+}
+
+// ReloadContexts loads the contexts of the kubeconfig file again if the file changed or the clients of
+// some contexts could not be built. Copies are deleted from clusters that are no longer in the file, and
+// every source syncing into contexts is queued so that new and changed contexts get their copies.
+func (s *ConfigSyncer) ReloadContexts() error {
+	contexts, hash, err := loadContexts(s.kubeconfigFile)
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	if hash == s.kubeconfigHash {
+		s.lock.Unlock()
+		return nil
+	}
+	old := s.contexts
+	s.kubeconfigHash = contextsHash(contexts, hash)
+	// e.g. a certificate file may be unreadable for a moment, keep using the clients built before
+	for name, ctx := range contexts {
+		if prev, found := s.fileContexts[name]; found && ctx.err != nil && prev.err == nil {
+			klog.Warningf("keeping the previous clients of context %s", name)
+			contexts[name] = prev
+		}
+	}
+	s.fileContexts = contexts
+	s.mergeContexts()
+	cur := s.contexts
+	s.lock.Unlock()
+
+	klog.Infof("reloaded %d context(s) from kubeconfig file %s", len(contexts), s.kubeconfigFile)
+	s.enqueueRemoteClusters() // contexts of the file take precedence over RemoteClusters of the same name
+	return s.contextsChanged(old, cur)
+}
+
+// contextsHash returns hash, or an empty one if the clients of some contexts of the kubeconfig file could
+// not be built, so that the next reload builds them again
+func contextsHash(contexts map[string]clusterContext, hash string) string {
+	for _, ctx := range contexts {
+		if ctx.err != nil {
+			return ""
+		}
+	}
+	return hash
+}
+
+// contextsFailed checks whether the clients of some contexts of the kubeconfig file could not be built
+func (s *ConfigSyncer) contextsFailed() bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.kubeconfigFile != "" && s.kubeconfigHash == ""
+}
+
+// mergeContexts combines the contexts of the kubeconfig file and the RemoteClusters into
+// s.contexts. Contexts of the kubeconfig file take precedence. The lock must be held.
+func (s *ConfigSyncer) mergeContexts() {
+	s.contexts = make(map[string]clusterContext, len(s.fileContexts)+len(s.remoteClusters))
+	for name, rc := range s.remoteClusters {
+		s.contexts[name] = rc.clusterContext
+	}
+	for name, ctx := range s.fileContexts {
+		s.contexts[name] = ctx
+	}
+}
+
+// contextsChanged deletes the copies in clusters that are no longer used and queues
+// every source syncing into contexts
+func (s *ConfigSyncer) contextsChanged(old, cur map[string]clusterContext) error {
+	err := s.removeFromClusters(old, cur)
+	s.forgetContextIDs(cur)
+	s.enqueueContextSources()
+	return err
+}
+
+// removeFromClusters deletes the copies in clusters of old that are not in cur
+func (s *ConfigSyncer) removeFromClusters(old, cur map[string]clusterContext) error {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	var errs []error
+	taken := map[string]struct{}{s.clusterID: {}}
+	for ctxName, ctx := range cur {
+		id, err := s.contextID(ctx)
+		if err != nil {
+			// the cluster can not be told apart from removed ones, keep copies everywhere
+			return errors.Wrapf(err, "context %s", ctxName)
+		}
+		taken[id] = struct{}{}
+	}
+
+	for ctxName, ctx := range old {
+		id, err := s.contextID(ctx)
+		if err != nil {
+			errs = append(errs, errors.Wrapf(err, "context %s", ctxName))
+			continue
+		}
+		if _, found := taken[id]; found {
+			continue // cluster is still in use, swept already or the source cluster
+		}
+		taken[id] = struct{}{}
+
+		// no context selects the cluster anymore, so the garbage collector deletes every copy
+		klog.Infof("deleting copies from cluster %s of removed context %s", id, ctxName)
+		for _, c := range s.copiers() {
+			if err := s.collect(c, ctx, id); err != nil {
+				errs = append(errs, errors.Wrapf(err, "context %s", ctxName))
+			}
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// enqueueContextSources queues every source that syncs into contexts
+func (s *ConfigSyncer) enqueueContextSources() {
+	s.enqueueSourcesWhere(func(_ metav1.Object, opts SyncOptions) bool {
+		return opts.Contexts.Len() > 0
+	})
+}
+
+// enqueueContextSelectorSources queues every source that selects namespaces inside the clusters
+// of contexts, as namespaces of other clusters are not watched
+func (s *ConfigSyncer) enqueueContextSelectorSources() {
+	s.enqueueSourcesWhere(func(_ metav1.Object, opts SyncOptions) bool {
+		for _, ctx := range opts.Contexts.List() {
+			if opts.contextSelector(ctx) != nil {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// enqueueSourcesWhere queues every source that matches with its sync options
+func (s *ConfigSyncer) enqueueSourcesWhere(match func(src metav1.Object, opts SyncOptions) bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if s.cmLister != nil {
+		if items, err := s.cmLister.List(labels.Everything()); err != nil {
+			klog.Errorln(err)
+		} else {
+			for _, src := range items {
+				if match(src, s.syncOptionsFor(api.SourceKindConfigMap, src)) {
+					s.cmQueue.GetQueue().Add(src.Namespace + "/" + src.Name)
+				}
+			}
+		}
+	}
+	if s.secretLister != nil {
+		if items, err := s.secretLister.List(labels.Everything()); err != nil {
+			klog.Errorln(err)
+		} else {
+			for _, src := range items {
+				if match(src, s.syncOptionsFor(api.SourceKindSecret, src)) {
+					s.secretQueue.GetQueue().Add(src.Namespace + "/" + src.Name)
+				}
+			}
+		}
+	}
+	for _, rs := range s.resources {
+		if rs.lister == nil {
+			continue
+		}
+		items, err := rs.lister.List(labels.Everything())
+		if err != nil {
+			klog.Errorln(err)
+			continue
+		}
+		for _, obj := range items {
+			src, ok := obj.(metav1.Object)
+			if !ok || !match(src, resourceCopier{s, rs.ResourceRule}.options(src)) {
+				continue
+			}
+			if key, err := cache.MetaNamespaceKeyFunc(obj); err == nil {
+				rs.queue.GetQueue().Add(key)
+			}
+		}
+	}
+}
+
+// watchKubeconfig reloads the contexts whenever the kubeconfig file changes, until stopCh is closed
+func (s *ConfigSyncer) watchKubeconfig(stopCh <-chan struct{}) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		klog.Errorf("failed to watch kubeconfig file %s: %v", s.kubeconfigFile, err)
+		return
+	}
+	defer watcher.Close()
+
+	// watch the directory, editors and mounted Secrets replace the file instead of writing to it
+	file := filepath.Clean(s.kubeconfigFile)
+	if err := watcher.Add(filepath.Dir(file)); err != nil {
+		klog.Errorf("failed to watch kubeconfig file %s: %v", s.kubeconfigFile, err)
+		return
+	}
+
+	// contexts whose clients could not be built are retried until they can be used
+	var reload <-chan time.Time
+	if s.contextsFailed() {
+		reload = time.After(contextRetryPeriod)
+	}
+	for {
+		select {
+		case <-stopCh:
+			return
+		case ev, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			// kubelet updates mounted Secrets by swapping the ..data symlink
+			if filepath.Clean(ev.Name) == file || filepath.Base(ev.Name) == "..data" {
+				reload = time.After(time.Second) // wait for writes to settle
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			klog.Errorf("error watching kubeconfig file %s: %v", s.kubeconfigFile, err)
+		case <-reload:
+			reload = nil
+			if err := s.ReloadContexts(); err != nil {
+				klog.Errorf("failed to reload kubeconfig file %s: %v", s.kubeconfigFile, err)
+			}
+			if s.contextsFailed() {
+				reload = time.After(contextRetryPeriod)
+			}
+		}
+	}
+}
@@ -0,0 +1,228 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"k8s.io/client-go/tools/record"
+)
+
+func newCluster(uid types.UID, objs ...*core.ConfigMap) *fake.Clientset {
+	kc := fake.NewSimpleClientset(
+		&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: metav1.NamespaceSystem, UID: uid}},
+		&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "demo"}},
+	)
+	for _, obj := range objs {
+		if err := kc.Tracker().Add(obj); err != nil {
+			panic(err)
+		}
+	}
+	return kc
+}
+
+func TestMergeContexts(t *testing.T) {
+	s := New(fake.NewSimpleClientset(), nil, nil, record.NewFakeRecorder(10), Options{})
+	s.fileContexts = map[string]clusterContext{
+		"both": {Address: "file"},
+		"file": {Address: "file"},
+	}
+	s.remoteClusters = map[string]remoteCluster{
+		"both":   {clusterContext: clusterContext{Address: "remote"}},
+		"remote": {clusterContext: clusterContext{Address: "remote"}},
+	}
+	s.mergeContexts()
+
+	want := map[string]string{"both": "file", "file": "file", "remote": "remote"}
+	if len(s.contexts) != len(want) {
+		t.Errorf("got %d contexts, want %d", len(s.contexts), len(want))
+	}
+	for name, address := range want {
+		if ctx, found := s.contexts[name]; !found || ctx.Address != address {
+			t.Errorf("context %s = %+v, want address %s", name, ctx, address)
+		}
+	}
+
+	s.fileContexts = nil
+	s.mergeContexts()
+	if ctx := s.contexts["both"]; ctx.Address != "remote" {
+		t.Errorf("context both = %+v once removed from the file, want the RemoteCluster", ctx)
+	}
+	if _, found := s.contexts["file"]; found {
+		t.Error("context file kept after being removed from the file")
+	}
+}
+
+func TestContextProbeTimeout(t *testing.T) {
+	kConfig := clientcmdapi.NewConfig()
+	kConfig.Clusters["east"] = &clientcmdapi.Cluster{Server: "https://east.example.com:6443"}
+	kConfig.AuthInfos["east"] = &clientcmdapi.AuthInfo{Token: "token"}
+	kConfig.Contexts["east"] = &clientcmdapi.Context{Cluster: "east", AuthInfo: "east"}
+
+	ctx, err := newClusterContext(kConfig, "east")
+	if err != nil {
+		t.Fatal(err)
+	}
+	probe, ok := ctx.probeClient().CoreV1().RESTClient().(*rest.RESTClient)
+	if !ok {
+		t.Fatalf("unexpected probe client %T", ctx.probeClient().CoreV1().RESTClient())
+	}
+	if probe.Client.Timeout != contextProbeTimeout {
+		t.Errorf("probe timeout = %s, want %s", probe.Client.Timeout, contextProbeTimeout)
+	}
+	if c := ctx.Client.CoreV1().RESTClient().(*rest.RESTClient); c.Client.Timeout != 0 {
+		t.Errorf("client timeout = %s, want none", c.Client.Timeout)
+	}
+}
+
+func TestContextsChanged(t *testing.T) {
+	src := &core.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "omni",
+			Namespace:   "demo",
+			UID:         "src-uid",
+			Annotations: map[string]string{ConfigSyncContexts: "kept"},
+		},
+	}
+	hub := fake.NewSimpleClientset(
+		&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: metav1.NamespaceSystem, UID: "hub-uid"}},
+		src,
+	)
+	kept := newCluster("kept-uid", newCopy("omni", "demo", "omni", "demo", "", "src-uid"))
+	gone := newCluster("gone-uid", newCopy("omni", "demo", "omni", "demo", "", "src-uid"))
+
+	s := New(hub, nil, nil, record.NewFakeRecorder(10), Options{})
+	s.clusterID = "hub-uid"
+	old := map[string]clusterContext{
+		"kept":  {Client: kept},
+		"alias": {Client: kept}, // removed, but the cluster is still used by another context
+		"gone":  {Client: gone},
+	}
+	cur := map[string]clusterContext{
+		"kept": {Client: kept},
+	}
+	s.contexts = cur
+
+	if err := s.contextsChanged(old, cur); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kept.CoreV1().ConfigMaps("demo").Get(context.TODO(), "omni", metav1.GetOptions{}); err != nil {
+		t.Errorf("copy in cluster still in use deleted: %v", err)
+	}
+	if _, err := gone.CoreV1().ConfigMaps("demo").Get(context.TODO(), "omni", metav1.GetOptions{}); !kerr.IsNotFound(err) {
+		t.Errorf("copy in cluster of removed context not deleted: %v", err)
+	}
+	if _, found := s.clusterIDs.Load(kept); !found {
+		t.Error("ID of cluster still in use forgotten")
+	}
+	if _, found := s.clusterIDs.Load(gone); found {
+		t.Error("ID of cluster of removed context kept")
+	}
+}
+
+const brokenKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: east
+  cluster:
+    server: https://east.example.com
+contexts:
+- name: east
+  context:
+    cluster: east
+    user: east
+users:
+- name: east
+  user:
+    client-certificate: missing.crt
+    client-key: missing.key
+`
+
+// contexts whose clients can not be built, e.g. as a certificate file is unreadable for a moment, must not
+// be mistaken for removed ones, which would delete every copy in their cluster
+func TestReloadKeepsFailedContexts(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "kubeconfig")
+	if err := os.WriteFile(file, []byte(brokenKubeconfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	contexts, hash, err := loadContexts(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ctx, found := contexts["east"]; !found || ctx.err == nil {
+		t.Fatalf("context east = %+v, want it kept with its error", ctx)
+	}
+	if hash == "" || contextsHash(contexts, hash) != "" {
+		t.Error("hash of a kubeconfig file with failed contexts is remembered, they would not be built again")
+	}
+
+	src := &core.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "omni",
+			Namespace:   "demo",
+			UID:         "src-uid",
+			Annotations: map[string]string{ConfigSyncContexts: "east"},
+		},
+	}
+	hub := fake.NewSimpleClientset(
+		&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: metav1.NamespaceSystem, UID: "hub-uid"}},
+		src,
+	)
+	east := newCluster("east-uid", newCopy("omni", "demo", "omni", "demo", "", "src-uid"))
+	exists := func() bool {
+		_, err := east.CoreV1().ConfigMaps("demo").Get(context.TODO(), "omni", metav1.GetOptions{})
+		return err == nil
+	}
+
+	// the clients built before are kept
+	s := New(hub, nil, nil, record.NewFakeRecorder(10), Options{})
+	s.clusterID = "hub-uid"
+	s.kubeconfigFile = file
+	s.fileContexts = map[string]clusterContext{"east": {Client: east}}
+	s.mergeContexts()
+	if err := s.ReloadContexts(); err != nil {
+		t.Fatal(err)
+	}
+	if s.contexts["east"].Client != east {
+		t.Error("previous clients of context east not kept")
+	}
+	if !exists() {
+		t.Error("copy in cluster of failed context deleted")
+	}
+	if !s.contextsFailed() {
+		t.Error("failed context is not built again")
+	}
+
+	// without previous clients, the cluster can not be identified and is not swept
+	err = s.removeFromClusters(map[string]clusterContext{"east": {Client: east}}, contexts)
+	if err == nil {
+		t.Error("got no error for a failed context")
+	}
+	if !exists() {
+		t.Error("copy in cluster of failed context deleted")
+	}
+}
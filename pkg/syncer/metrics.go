@@ -0,0 +1,163 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+	"k8s.io/klog/v2"
+)
+
+const metricsNamespace = "config_syncer"
+
+// values of the resource label for ConfigMaps and Secrets, other resources use their group resource
+const (
+	resourceConfigMaps = "configmaps"
+	resourceSecrets    = "secrets"
+)
+
+var (
+	syncAttempts = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace:      metricsNamespace,
+			Name:           "sync_attempts_total",
+			Help:           "Number of attempts to sync a source into the namespaces of a cluster. The context is empty for the source cluster.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"resource", "source_namespace", "context"},
+	)
+	syncFailures = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace:      metricsNamespace,
+			Name:           "sync_failures_total",
+			Help:           "Number of failed attempts to sync a source into the namespaces of a cluster. The context is empty for the source cluster.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"resource", "source_namespace", "context"},
+	)
+	syncDuration = metrics.NewHistogramVec(
+		&metrics.HistogramOpts{
+			Namespace:      metricsNamespace,
+			Name:           "sync_duration_seconds",
+			Help:           "Time taken to sync a source into the namespaces of a cluster. The context is empty for the source cluster.",
+			Buckets:        metrics.ExponentialBuckets(0.005, 2, 14),
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"resource", "context"},
+	)
+	managedCopies = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Namespace:      metricsNamespace,
+			Name:           "managed_copies",
+			Help:           "Number of copies of a source, counting the namespaces of the source cluster and the contexts holding a copy.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"resource", "source_namespace", "source_name"},
+	)
+	orphansDeleted = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace:      metricsNamespace,
+			Name:           "orphaned_copies_deleted_total",
+			Help:           "Number of orphaned copies deleted by the garbage collector. The cluster ID is empty for the source cluster.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"resource", "cluster"},
+	)
+	contextReachable = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Namespace:      metricsNamespace,
+			Name:           "context_reachable",
+			Help:           "Whether the cluster of a kubeconfig context answered the last probe (1) or not (0).",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"context"},
+	)
+)
+
+var registerMetrics sync.Once
+
+// RegisterMetrics registers the syncer metrics on the legacy registry served at /metrics
+func RegisterMetrics() {
+	registerMetrics.Do(func() {
+		legacyregistry.MustRegister(syncAttempts)
+		legacyregistry.MustRegister(syncFailures)
+		legacyregistry.MustRegister(syncDuration)
+		legacyregistry.MustRegister(managedCopies)
+		legacyregistry.MustRegister(orphansDeleted)
+		legacyregistry.MustRegister(contextReachable)
+	})
+}
+
+// observeSync records an attempt to sync a source into the namespaces of a cluster started at start
+func observeSync(resource, srcNamespace, ctx string, start time.Time, err error) {
+	syncAttempts.WithLabelValues(resource, srcNamespace, ctx).Inc()
+	if err != nil {
+		syncFailures.WithLabelValues(resource, srcNamespace, ctx).Inc()
+	}
+	syncDuration.WithLabelValues(resource, ctx).Observe(time.Since(start).Seconds())
+}
+
+func setManagedCopies(resource, srcNamespace, srcName string, n int) {
+	managedCopies.WithLabelValues(resource, srcNamespace, srcName).Set(float64(n))
+}
+
+func deleteManagedCopies(resource, srcNamespace, srcName string) {
+	managedCopies.Delete(map[string]string{
+		"resource":         resource,
+		"source_namespace": srcNamespace,
+		"source_name":      srcName,
+	})
+}
+
+// probeContexts checks whether the clusters of the configured contexts are reachable
+func (s *ConfigSyncer) probeContexts() {
+	s.lock.RLock()
+	contexts := make(map[string]clusterContext, len(s.contexts))
+	for name, ctx := range s.contexts {
+		contexts[name] = ctx
+	}
+	s.lock.RUnlock()
+
+	names := make([]string, 0, len(contexts))
+	for name := range contexts {
+		names = append(names, name)
+	}
+	// probed in parallel, so that unreachable clusters do not delay the others
+	errs := s.fanOut.forEachContext(names, func(name string) error {
+		ctx := contexts[name]
+		if ctx.err != nil {
+			return ctx.err
+		}
+		_, err := ctx.probeClient().Discovery().ServerVersion()
+		return err
+	})
+
+	contextReachable.Reset() // forget contexts removed from the kubeconfig file
+	for i, name := range names {
+		v := 0.0
+		if errs[i] == nil {
+			v = 1
+		} else {
+			klog.Warningf("context %s is not reachable: %v", name, errs[i])
+		}
+		contextReachable.WithLabelValues(name).Set(v)
+	}
+	s.enqueueRemoteClusters() // refresh their status
+}
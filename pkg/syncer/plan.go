@@ -0,0 +1,539 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	api "kubeops.dev/config-syncer/apis/kubed/v1alpha1"
+
+	"github.com/pkg/errors"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes"
+)
+
+type PlanAction string
+
+const (
+	PlanActionCreate PlanAction = "Create"
+	PlanActionUpdate PlanAction = "Update"
+	PlanActionDelete PlanAction = "Delete"
+	// an object that is not a copy has the name of the copy and the conflict policy leaves it alone
+	PlanActionSkip PlanAction = "Skip"
+	// a source, context or namespace can not be planned, Reason holds the error
+	PlanActionError PlanAction = "Error"
+)
+
+// PlannedChange is a change of a single copy that syncing a source would make
+type PlannedChange struct {
+	Action PlanAction     `json:"action"`
+	Kind   api.SourceKind `json:"kind"`
+	// namespace/name of the source
+	Source string `json:"source"`
+	// empty for the source cluster
+	Context   string `json:"context,omitempty"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+
+	// data keys of the copy, never their values
+	AddedKeys   []string `json:"addedKeys,omitempty"`
+	ChangedKeys []string `json:"changedKeys,omitempty"`
+	RemovedKeys []string `json:"removedKeys,omitempty"`
+
+	Reason string `json:"reason,omitempty"`
+}
+
+// planTarget is a cluster copies of a source are synced into
+type planTarget struct {
+	client kubernetes.Interface
+	// empty for the source cluster
+	context    string
+	namespaces sets.String
+	// why the context can not be planned
+	err error
+}
+
+// planTargets selects namespaces and contexts the same way syncSource does. Contexts that can not be
+// used are returned with their error, so that the other targets are still planned.
+func (s *ConfigSyncer) planTargets(opts SyncOptions, srcNamespace, srcName string) ([]planTarget, error) {
+	local := sets.NewString()
+	if opts.syncsNamespaces() {
+		if _, err := opts.namespaceSelector(); err != nil {
+			return nil, errors.Wrapf(err, "invalid namespace selector %q", *opts.NamespaceSelector)
+		}
+		ns, err := s.localNamespacesForSource(opts, srcNamespace, srcName)
+		if err != nil {
+			return nil, err
+		}
+		local = ns
+	}
+	local.Delete(srcNamespace)
+	targets := []planTarget{{client: s.kubeClient, namespaces: local}}
+
+	usable, taken, err := s.checkContexts(nil, opts.Contexts.List())
+	if err != nil {
+		for _, e := range utilerrors.Flatten(err.(utilerrors.Aggregate)).Errors() {
+			var te *TargetError
+			if !errors.As(e, &te) {
+				return nil, e
+			}
+			targets = append(targets, planTarget{context: te.Context, err: te.Err})
+		}
+	}
+	for _, ctx := range usable {
+		cc := s.contexts[ctx]
+		newNs, err := contextNamespaces(opts, ctx, cc, srcNamespace, srcName)
+		targets = append(targets, planTarget{client: cc.Client, context: ctx, namespaces: newNs, err: err})
+	}
+
+	// copies in other contexts are deleted
+	for _, ctx := range s.otherContexts(taken) {
+		targets = append(targets, planTarget{client: s.contexts[ctx].Client, context: ctx, namespaces: sets.NewString()})
+	}
+	return targets, nil
+}
+
+// planSource plans the sync of src by c into every target. planCopy plans a single copy, it returns nil if the
+// copy is up to date. Targets that can not be planned are reported as changes with PlanActionError.
+func (s *ConfigSyncer) planSource(c copier, kind api.SourceKind, src object, planCopy func(t planTarget, namespace, name string) (*PlannedChange, error)) ([]PlannedChange, error) {
+	opts := c.options(src)
+	if err := opts.validateKeys(); err != nil {
+		return nil, err
+	}
+	targets, err := s.planTargets(opts, src.GetNamespace(), src.GetName())
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []PlannedChange
+	for _, t := range targets {
+		if t.err != nil {
+			changes = append(changes, plannedError(kind, src, t.context, "", t.err))
+			continue
+		}
+		oldCopies, err := c.copies(src, t.context, metav1.NamespaceAll)
+		if err != nil {
+			changes = append(changes, plannedError(kind, src, t.context, "", err))
+			continue
+		}
+		name := opts.CopyName(src.GetName(), t.context)
+		failed := sets.NewString()
+		for _, ns := range t.namespaces.List() {
+			change, err := planCopy(t, ns, name)
+			if err != nil {
+				failed.Insert(ns)
+				changes = append(changes, plannedError(kind, src, t.context, ns, err))
+			} else if change != nil {
+				changes = append(changes, *change)
+			}
+		}
+		// like syncIntoNamespaces, copies in namespaces that failed are kept
+		for _, obj := range oldCopies {
+			if (t.context == "" && obj.GetNamespace() == src.GetNamespace()) || (t.namespaces.Has(obj.GetNamespace()) && obj.GetName() == name) || failed.Has(obj.GetNamespace()) {
+				continue
+			}
+			changes = append(changes, plannedDelete(kind, src, obj, t.context))
+		}
+	}
+	return changes, nil
+}
+
+// PlanConfigMap returns the changes syncing src would make, without writing anything
+func (s *ConfigSyncer) PlanConfigMap(src *core.ConfigMap) ([]PlannedChange, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	c := configMapCopier{s}
+	opts := c.options(src)
+	return s.planSource(c, api.SourceKindConfigMap, src, func(t planTarget, namespace, name string) (*PlannedChange, error) {
+		return s.planConfigMapCopy(t, src, opts, namespace, name)
+	})
+}
+
+func (s *ConfigSyncer) planConfigMapCopy(t planTarget, src *core.ConfigMap, opts SyncOptions, namespace, name string) (*PlannedChange, error) {
+	var ns *core.Namespace
+	if opts.Template {
+		var err error
+		if ns, err = s.planNamespace(t, opts, namespace); err != nil {
+			return nil, err
+		}
+	}
+	desired, err := s.configMapCopy(src, opts, ns, t.context)
+	if err != nil {
+		return nil, err
+	}
+	keys := configMapKeys(desired.Data, desired.BinaryData)
+
+	change := &PlannedChange{
+		Kind:      api.SourceKindConfigMap,
+		Source:    src.Namespace + "/" + src.Name,
+		Context:   t.context,
+		Namespace: namespace,
+		Name:      name,
+	}
+	cur, err := t.client.CoreV1().ConfigMaps(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if kerr.IsNotFound(err) {
+		change.Action = PlanActionCreate
+		change.AddedKeys = sets.StringKeySet(keys).List()
+		return change, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if !s.writesCopy(cur, src, opts, configMapMatches(cur, desired)) {
+		return s.plannedSkip(change, opts), nil
+	}
+
+	change.AddedKeys, change.ChangedKeys, change.RemovedKeys = diffKeys(configMapKeys(cur.Data, cur.BinaryData), keys)
+	metaChanged := s.copyMetaChanged(cur, src)
+	if len(change.AddedKeys)+len(change.ChangedKeys)+len(change.RemovedKeys) == 0 && !metaChanged {
+		return nil, nil
+	}
+	change.Action = PlanActionUpdate
+	if metaChanged {
+		change.Reason = "labels or annotations change"
+	}
+	return change, nil
+}
+
+// planNamespace returns the target namespace of t templates are rendered against. The namespace of a context
+// that does not exist, but would be created by the sync, is rendered as it would be created.
+func (s *ConfigSyncer) planNamespace(t planTarget, opts SyncOptions, namespace string) (*core.Namespace, error) {
+	ns, err := s.targetNamespace(t.client, namespace, t.context)
+	if kerr.IsNotFound(err) && t.context != "" && opts.contextSelector(t.context) == nil {
+		if creation := namespaceCreation(opts, s.contexts[t.context]); creation != nil {
+			return createdNamespace(namespace, creation), nil
+		}
+	}
+	return ns, err
+}
+
+// PlanSecret returns the changes syncing src would make, without writing anything
+func (s *ConfigSyncer) PlanSecret(src *core.Secret) ([]PlannedChange, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	c := secretCopier{s}
+	opts := c.options(src)
+	return s.planSource(c, api.SourceKindSecret, src, func(t planTarget, namespace, name string) (*PlannedChange, error) {
+		return s.planSecretCopy(t, src, opts, namespace, name)
+	})
+}
+
+func (s *ConfigSyncer) planSecretCopy(t planTarget, src *core.Secret, opts SyncOptions, namespace, name string) (*PlannedChange, error) {
+	desired := secretCopy(src, opts)
+
+	change := &PlannedChange{
+		Kind:      api.SourceKindSecret,
+		Source:    src.Namespace + "/" + src.Name,
+		Context:   t.context,
+		Namespace: namespace,
+		Name:      name,
+	}
+	cur, err := t.client.CoreV1().Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if kerr.IsNotFound(err) {
+		change.Action = PlanActionCreate
+		change.AddedKeys = sets.StringKeySet(desired.Data).List()
+		return change, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if !s.writesCopy(cur, src, opts, secretMatches(cur, desired)) {
+		return s.plannedSkip(change, opts), nil
+	}
+
+	change.AddedKeys, change.ChangedKeys, change.RemovedKeys = diffKeys(cur.Data, desired.Data)
+	metaChanged := cur.Type != desired.Type || s.copyMetaChanged(cur, src)
+	if len(change.AddedKeys)+len(change.ChangedKeys)+len(change.RemovedKeys) == 0 && !metaChanged {
+		return nil, nil
+	}
+	change.Action = PlanActionUpdate
+	if metaChanged {
+		change.Reason = "type, labels or annotations change"
+	}
+	return change, nil
+}
+
+// PlanResource returns the changes syncing src of a resource of rule would make, without writing anything
+func (s *ConfigSyncer) PlanResource(rule ResourceRule, src *unstructured.Unstructured) ([]PlannedChange, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	c := resourceCopier{s, rule}
+	opts := c.options(src)
+	return s.planSource(c, api.SourceKind(src.GetKind()), src, func(t planTarget, namespace, name string) (*PlannedChange, error) {
+		return s.planResourceCopy(t, rule, src, opts, namespace, name)
+	})
+}
+
+func (s *ConfigSyncer) planResourceCopy(t planTarget, rule ResourceRule, src *unstructured.Unstructured, opts SyncOptions, namespace, name string) (*PlannedChange, error) {
+	desired := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	if err := s.setResourceCopy(rule, src, desired); err != nil {
+		return nil, err
+	}
+
+	change := &PlannedChange{
+		Kind:      api.SourceKind(src.GetKind()),
+		Source:    src.GetNamespace() + "/" + src.GetName(),
+		Context:   t.context,
+		Namespace: namespace,
+		Name:      name,
+	}
+	cur, err := s.dynamicClientFor(t.context).Resource(rule.GVR).Namespace(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if kerr.IsNotFound(err) {
+		change.Action = PlanActionCreate
+		change.AddedKeys = sets.StringKeySet(rule.fieldValues(desired, cur)).List()
+		return change, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if !s.writesCopy(cur, src, opts, rule.fieldsEqual(src, cur)) {
+		return s.plannedSkip(change, opts), nil
+	}
+
+	change.AddedKeys, change.ChangedKeys, change.RemovedKeys = diffKeys(rule.fieldValues(cur, desired), rule.fieldValues(desired, cur))
+	metaChanged := s.copyMetaChanged(cur, src)
+	if len(change.AddedKeys)+len(change.ChangedKeys)+len(change.RemovedKeys) == 0 && !metaChanged {
+		return nil, nil
+	}
+	change.Action = PlanActionUpdate
+	if metaChanged {
+		change.Reason = "labels or annotations change"
+	}
+	return change, nil
+}
+
+// fieldValues returns the fields of obj selected by rule as JSON, keyed by their dot separated path.
+// other is the object obj is compared with, top level fields of either are included if rule selects every field.
+func (rule ResourceRule) fieldValues(obj, other *unstructured.Unstructured) map[string][]byte {
+	paths := rule.fieldPaths(obj)
+	if len(rule.Fields) == 0 && other != nil {
+		paths = append(paths, rule.fieldPaths(other)...)
+	}
+	out := make(map[string][]byte, len(paths))
+	for _, p := range paths {
+		v, found, err := unstructured.NestedFieldNoCopy(obj.Object, p...)
+		if err != nil || !found {
+			continue
+		}
+		if data, err := json.Marshal(v); err == nil {
+			out[strings.Join(p, ".")] = data
+		}
+	}
+	return out
+}
+
+// PlanResources plans the sync of every source of the synced resources in a namespace, or in all
+// namespaces if empty, that is synced or has copies in the source cluster. Sources that can not be
+// planned are reported as changes with PlanActionError.
+func (s *ConfigSyncer) PlanResources(namespace string) ([]PlannedChange, error) {
+	var changes []PlannedChange
+	for _, rule := range s.ResourceRules() {
+		ri := s.dynamicClient.Resource(rule.GVR)
+		sources, err := ri.Namespace(namespace).List(context.TODO(), metav1.ListOptions{})
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to list %s", rule.GVR.GroupResource())
+		}
+		copies, err := ri.Namespace(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{
+			LabelSelector: s.copySelector().String(),
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to list %s", rule.GVR.GroupResource())
+		}
+		origins := sets.NewString()
+		for _, obj := range copies.Items {
+			origins.Insert(obj.GetLabels()[OriginNamespaceLabelKey] + "/" + obj.GetLabels()[OriginNameLabelKey])
+		}
+
+		for i := range sources.Items {
+			src := &sources.Items[i]
+			opts := resourceCopier{s, rule}.options(src)
+			if !opts.syncsNamespaces() && opts.Contexts.Len() == 0 && !origins.Has(src.GetNamespace()+"/"+src.GetName()) {
+				continue
+			}
+			c, err := s.PlanResource(rule, src)
+			if err != nil {
+				c = []PlannedChange{plannedError(api.SourceKind(src.GetKind()), src, "", "", err)}
+			}
+			changes = append(changes, c...)
+		}
+	}
+	return changes, nil
+}
+
+// ResourceRules returns the rules of the synced resources other than ConfigMaps and Secrets, sorted by resource
+func (s *ConfigSyncer) ResourceRules() []ResourceRule {
+	rules := make([]ResourceRule, 0, len(s.resources))
+	for _, rs := range s.resources {
+		rules = append(rules, rs.ResourceRule)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		return rules[i].String() < rules[j].String()
+	})
+	return rules
+}
+
+// copyMetaChanged tells whether syncing would change the labels or annotations of cur. The resourceVersion
+// in the origin annotation is ignored, it changes with every write of the sync status.
+func (s *ConfigSyncer) copyMetaChanged(cur metav1.Object, src object) bool {
+	ref := originRef(src)
+	if origin, err := GetOrigin(cur.GetAnnotations()); err == nil && origin != nil {
+		ref.APIVersion, ref.Kind, ref.ResourceVersion = origin.APIVersion, origin.Kind, origin.ResourceVersion
+	}
+	desired := &metav1.ObjectMeta{Annotations: cur.GetAnnotations()}
+	s.setCopyMeta(desired, src, ref)
+	return !equality.Semantic.DeepEqual(cur.GetLabels(), desired.Labels) || !equality.Semantic.DeepEqual(cur.GetAnnotations(), desired.Annotations)
+}
+
+// plannedSkip reports change as left alone by the conflict policy of opts
+func (s *ConfigSyncer) plannedSkip(change *PlannedChange, opts SyncOptions) *PlannedChange {
+	change.Action = PlanActionSkip
+	change.Reason = fmt.Sprintf("object is not managed by config-syncer (conflict policy %s)", s.conflictPolicyFor(opts))
+	return change
+}
+
+func plannedError(kind api.SourceKind, src metav1.Object, ctx, namespace string, err error) PlannedChange {
+	return PlannedChange{
+		Action:    PlanActionError,
+		Kind:      kind,
+		Source:    src.GetNamespace() + "/" + src.GetName(),
+		Context:   ctx,
+		Namespace: namespace,
+		Reason:    err.Error(),
+	}
+}
+
+func plannedDelete(kind api.SourceKind, src, obj metav1.Object, ctx string) PlannedChange {
+	return PlannedChange{
+		Action:    PlanActionDelete,
+		Kind:      kind,
+		Source:    src.GetNamespace() + "/" + src.GetName(),
+		Context:   ctx,
+		Namespace: obj.GetNamespace(),
+		Name:      obj.GetName(),
+	}
+}
+
+// PlanConfigMaps plans the sync of every ConfigMap of a namespace, or of all namespaces if empty,
+// that is synced or has copies in the source cluster. Sources that can not be planned are reported
+// as changes with PlanActionError.
+func (s *ConfigSyncer) PlanConfigMaps(namespace string) ([]PlannedChange, error) {
+	sources, err := s.kubeClient.CoreV1().ConfigMaps(namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	copies, err := configMapForSelector(s.kubeClient, s.copySelector().String())
+	if err != nil {
+		return nil, err
+	}
+	origins := sets.NewString()
+	for _, obj := range copies {
+		origins.Insert(obj.Labels[OriginNamespaceLabelKey] + "/" + obj.Labels[OriginNameLabelKey])
+	}
+
+	var changes []PlannedChange
+	for i := range sources.Items {
+		src := &sources.Items[i]
+		opts := s.syncOptionsFor(api.SourceKindConfigMap, src)
+		if !opts.syncsNamespaces() && opts.Contexts.Len() == 0 && !origins.Has(src.Namespace+"/"+src.Name) {
+			continue
+		}
+		c, err := s.PlanConfigMap(src)
+		if err != nil {
+			c = []PlannedChange{plannedError(api.SourceKindConfigMap, src, "", "", err)}
+		}
+		changes = append(changes, c...)
+	}
+	return changes, nil
+}
+
+// PlanSecrets plans the sync of every Secret of a namespace, or of all namespaces if empty,
+// that is synced or has copies in the source cluster. Sources that can not be planned are reported
+// as changes with PlanActionError.
+func (s *ConfigSyncer) PlanSecrets(namespace string) ([]PlannedChange, error) {
+	sources, err := s.kubeClient.CoreV1().Secrets(namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	copies, err := secretForSelector(s.kubeClient, s.copySelector().String())
+	if err != nil {
+		return nil, err
+	}
+	origins := sets.NewString()
+	for _, obj := range copies {
+		origins.Insert(obj.Labels[OriginNamespaceLabelKey] + "/" + obj.Labels[OriginNameLabelKey])
+	}
+
+	var changes []PlannedChange
+	for i := range sources.Items {
+		src := &sources.Items[i]
+		opts := s.syncOptionsFor(api.SourceKindSecret, src)
+		if !opts.syncsNamespaces() && opts.Contexts.Len() == 0 && !origins.Has(src.Namespace+"/"+src.Name) {
+			continue
+		}
+		c, err := s.PlanSecret(src)
+		if err != nil {
+			c = []PlannedChange{plannedError(api.SourceKindSecret, src, "", "", err)}
+		}
+		changes = append(changes, c...)
+	}
+	return changes, nil
+}
+
+// configMapKeys merges the string and binary data of a ConfigMap, keys are unique across both
+func configMapKeys(data map[string]string, binaryData map[string][]byte) map[string][]byte {
+	out := make(map[string][]byte, len(data)+len(binaryData))
+	for k, v := range data {
+		out[k] = []byte(v)
+	}
+	for k, v := range binaryData {
+		out[k] = v
+	}
+	return out
+}
+
+// diffKeys compares the data of a copy with the desired data by key
+func diffKeys(cur, desired map[string][]byte) (added, changed, removed []string) {
+	for k, v := range desired {
+		if old, ok := cur[k]; !ok {
+			added = append(added, k)
+		} else if !bytes.Equal(old, v) {
+			changed = append(changed, k)
+		}
+	}
+	for k := range cur {
+		if _, ok := desired[k]; !ok {
+			removed = append(removed, k)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(changed)
+	sort.Strings(removed)
+	return
+}
@@ -0,0 +1,198 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestDiffKeys(t *testing.T) {
+	tests := []struct {
+		name                                string
+		cur, desired                        map[string][]byte
+		wantAdded, wantChanged, wantRemoved []string
+	}{
+		{name: "empty"},
+		{name: "equal", cur: map[string][]byte{"a": []byte("1")}, desired: map[string][]byte{"a": []byte("1")}},
+		{
+			name:      "create",
+			desired:   map[string][]byte{"b": []byte("2"), "a": []byte("1")},
+			wantAdded: []string{"a", "b"},
+		},
+		{
+			name:        "mixed",
+			cur:         map[string][]byte{"a": []byte("1"), "b": []byte("2"), "c": []byte("3")},
+			desired:     map[string][]byte{"a": []byte("1"), "b": []byte("20"), "d": []byte("4")},
+			wantAdded:   []string{"d"},
+			wantChanged: []string{"b"},
+			wantRemoved: []string{"c"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			added, changed, removed := diffKeys(tt.cur, tt.desired)
+			if !reflect.DeepEqual(added, tt.wantAdded) || !reflect.DeepEqual(changed, tt.wantChanged) || !reflect.DeepEqual(removed, tt.wantRemoved) {
+				t.Errorf("diffKeys() = %v, %v, %v, want %v, %v, %v", added, changed, removed, tt.wantAdded, tt.wantChanged, tt.wantRemoved)
+			}
+		})
+	}
+}
+
+func TestPlanReportsUnusableContexts(t *testing.T) {
+	src := &core.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "omni",
+			Namespace:   "demo",
+			Annotations: map[string]string{ConfigSyncKey: "", ConfigSyncContexts: "east,west"},
+		},
+		Data: map[string]string{"k": "v"},
+	}
+	kc := fake.NewSimpleClientset(
+		&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "demo"}},
+		&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "a"}},
+		src,
+	)
+	unreachable := fake.NewSimpleClientset()
+	unreachable.PrependReactor("*", "*", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("connection refused")
+	})
+	s := New(kc, nil, nil, record.NewFakeRecorder(10), Options{})
+	s.clusterID = "hub"
+	s.contexts = map[string]clusterContext{"east": {Client: unreachable}}
+
+	changes, err := s.PlanConfigMap(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]PlanAction{}
+	for _, c := range changes {
+		got[targetKey(c.Namespace, c.Context)] = c.Action
+		if c.Action == PlanActionError && c.Reason == "" {
+			t.Errorf("error of %s has no reason", targetKey(c.Namespace, c.Context))
+		}
+	}
+	want := map[string]PlanAction{
+		"a":    PlanActionCreate,
+		"east": PlanActionError,
+		"west": PlanActionError, // not in the kubeconfig file
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("planned %v, want %v", got, want)
+	}
+}
+
+// a template renders against the namespace of a context the sync would create, like the sync does
+func TestPlanTemplateIntoCreatedNamespace(t *testing.T) {
+	tests := []struct {
+		name            string
+		createNamespace string
+		want            PlanAction
+	}{
+		{name: "created", createNamespace: "true", want: PlanActionCreate},
+		{name: "missing", createNamespace: "false", want: PlanActionError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := &core.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "omni",
+					Namespace: "demo",
+					Annotations: map[string]string{
+						ConfigSyncContexts:        "east",
+						ConfigSyncTemplate:        "true",
+						ConfigSyncCreateNamespace: tt.createNamespace,
+						ConfigSyncNamespaceLabels: "team=a",
+					},
+				},
+				Data: map[string]string{"k": `{{ .Namespace.Name }}/{{ index .Namespace.Labels "team" }}`},
+			}
+			kc := fake.NewSimpleClientset(&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "demo"}}, src)
+			s := New(kc, nil, nil, record.NewFakeRecorder(10), Options{})
+			s.clusterID = "hub"
+			s.contexts = map[string]clusterContext{"east": {Client: fake.NewSimpleClientset(
+				&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: metav1.NamespaceSystem, UID: "east-uid"}},
+			), Namespace: "apps"}}
+
+			changes, err := s.PlanConfigMap(src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(changes) != 1 || changes[0].Action != tt.want || changes[0].Namespace != "apps" {
+				t.Fatalf("planned %+v, want %s of apps", changes, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlanResource(t *testing.T) {
+	rule := ResourceRule{
+		GVR:    schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1", Resource: "networkpolicies"},
+		Fields: []string{"spec"},
+	}
+	policy := func(namespace string, spec map[string]interface{}) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "networking.k8s.io/v1",
+			"kind":       "NetworkPolicy",
+			"spec":       spec,
+		}}
+		obj.SetNamespace(namespace)
+		obj.SetName("deny-all")
+		return obj
+	}
+	src := policy("demo", map[string]interface{}{"podSelector": map[string]interface{}{}})
+	src.SetAnnotations(map[string]string{ConfigSyncKey: ""})
+
+	kc := fake.NewSimpleClientset(
+		&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "demo"}},
+		&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "a"}},
+		&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "b"}},
+	)
+	s := New(kc, nil, nil, record.NewFakeRecorder(10), Options{})
+	s.clusterName = "hub"
+	outdated := policy("b", nil)
+	if err := s.setResourceCopy(rule, src, outdated); err != nil {
+		t.Fatal(err)
+	}
+	outdated.Object["spec"] = map[string]interface{}{"podSelector": map[string]interface{}{"app": "web"}}
+	s.dynamicClient = dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		rule.GVR: "NetworkPolicyList",
+	}, src.DeepCopy(), outdated)
+
+	changes, err := s.PlanResource(rule, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []PlannedChange{
+		{Action: PlanActionCreate, Kind: "NetworkPolicy", Source: "demo/deny-all", Namespace: "a", Name: "deny-all", AddedKeys: []string{"spec"}},
+		{Action: PlanActionUpdate, Kind: "NetworkPolicy", Source: "demo/deny-all", Namespace: "b", Name: "deny-all", ChangedKeys: []string{"spec"}},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("PlanResource() = %+v, want %+v", changes, want)
+	}
+}
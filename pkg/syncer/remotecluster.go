@@ -0,0 +1,350 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+
+	api "kubeops.dev/config-syncer/apis/kubed/v1alpha1"
+	kubed_listers "kubeops.dev/config-syncer/client/listers/kubed/v1alpha1"
+
+	"github.com/pkg/errors"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	core_listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"k8s.io/klog/v2"
+	"kmodules.xyz/client-go/tools/queue"
+)
+
+// remoteCluster is a cluster registered via a RemoteCluster
+type remoteCluster struct {
+	clusterContext
+	// sha256 of the kubeconfig file and the spec the context was built from
+	hash string
+}
+
+// RemoteClusterHandler queues changed RemoteClusters. RemoteClusters and the Secrets
+// they refer to must be listed from the operator namespace only.
+func (s *ConfigSyncer) RemoteClusterHandler(lister kubed_listers.RemoteClusterLister, secretLister core_listers.SecretLister) (cache.ResourceEventHandler, cache.ResourceEventHandler) {
+	s.rcLister = lister
+	s.rcSecretLister = secretLister
+	return &remoteClusterSyncer{s}, &kubeconfigSecretSyncer{s}
+}
+
+type remoteClusterSyncer struct {
+	*ConfigSyncer
+}
+
+var _ cache.ResourceEventHandler = &remoteClusterSyncer{}
+
+func (s *remoteClusterSyncer) OnAdd(obj interface{}) {
+	if _, ok := obj.(*api.RemoteCluster); ok {
+		queue.Enqueue(s.rcQueue.GetQueue(), obj)
+	}
+}
+
+func (s *remoteClusterSyncer) OnUpdate(oldObj, newObj interface{}) {
+	oldRes, ok := oldObj.(*api.RemoteCluster)
+	if !ok {
+		return
+	}
+	newRes, ok := newObj.(*api.RemoteCluster)
+	if !ok {
+		return
+	}
+	// status updates do not change the generation
+	if oldRes.Generation != newRes.Generation {
+		queue.Enqueue(s.rcQueue.GetQueue(), newObj)
+	}
+}
+
+func (s *remoteClusterSyncer) OnDelete(obj interface{}) {
+	// also handles cache.DeletedFinalStateUnknown, the reconciler only needs the key
+	queue.Enqueue(s.rcQueue.GetQueue(), obj)
+}
+
+// kubeconfigSecretSyncer queues the RemoteClusters referring to a changed Secret
+type kubeconfigSecretSyncer struct {
+	*ConfigSyncer
+}
+
+var _ cache.ResourceEventHandler = &kubeconfigSecretSyncer{}
+
+func (s *kubeconfigSecretSyncer) OnAdd(obj interface{}) {
+	s.enqueueRemoteClustersOf(obj)
+}
+
+func (s *kubeconfigSecretSyncer) OnUpdate(oldObj, newObj interface{}) {
+	s.enqueueRemoteClustersOf(newObj)
+}
+
+func (s *kubeconfigSecretSyncer) OnDelete(obj interface{}) {
+	s.enqueueRemoteClustersOf(obj)
+}
+
+func (s *ConfigSyncer) enqueueRemoteClustersOf(obj interface{}) {
+	if d, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = d.Obj
+	}
+	secret, ok := obj.(*core.Secret)
+	if !ok {
+		return
+	}
+	items, err := s.rcLister.RemoteClusters(secret.Namespace).List(labels.Everything())
+	if err != nil {
+		klog.Errorln(err)
+		return
+	}
+	for _, rc := range items {
+		if rc.Spec.KubeconfigSecretRef.Name == secret.Name {
+			queue.Enqueue(s.rcQueue.GetQueue(), rc)
+		}
+	}
+}
+
+// enqueueRemoteClusters queues every RemoteCluster, to probe their clusters
+func (s *ConfigSyncer) enqueueRemoteClusters() {
+	if s.rcLister == nil {
+		return
+	}
+	items, err := s.rcLister.List(labels.Everything())
+	if err != nil {
+		klog.Errorln(err)
+		return
+	}
+	for _, rc := range items {
+		queue.Enqueue(s.rcQueue.GetQueue(), rc)
+	}
+}
+
+func (s *ConfigSyncer) reconcileRemoteCluster(key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+	rc, err := s.rcLister.RemoteClusters(namespace).Get(name)
+	if kerr.IsNotFound(err) {
+		klog.Infof("RemoteCluster %s does not exist anymore", key)
+		return s.setRemoteCluster(name, nil)
+	} else if err != nil {
+		return err
+	}
+
+	status := api.RemoteClusterStatus{ObservedGeneration: rc.Generation}
+	s.lock.RLock()
+	_, taken := s.fileContexts[name]
+	s.lock.RUnlock()
+	if taken {
+		status.LastError = "context " + name + " of the kubeconfig file takes precedence"
+		if err := s.setRemoteCluster(name, nil); err != nil {
+			return err
+		}
+		return s.updateRemoteClusterStatus(rc, status)
+	}
+
+	secret, err := s.rcSecretLister.Secrets(rc.Namespace).Get(rc.Spec.KubeconfigSecretRef.Name)
+	if err != nil && !kerr.IsNotFound(err) {
+		return err
+	}
+	cluster, err := newRemoteCluster(rc, secret)
+	if err != nil {
+		// keep using the previous clients, if any, until the Secret is fixed
+		status.LastError = err.Error()
+		return s.updateRemoteClusterStatus(rc, status)
+	}
+	if err := s.setRemoteCluster(name, cluster); err != nil {
+		return err
+	}
+
+	if info, err := cluster.probeClient().Discovery().ServerVersion(); err != nil {
+		status.LastError = err.Error()
+	} else {
+		status.Reachable = true
+		status.ServerVersion = info.GitVersion
+	}
+	if status.Reachable {
+		if id, err := s.contextID(cluster.clusterContext); err != nil {
+			status.LastError = err.Error()
+		} else {
+			status.ClusterID = id
+			if id == s.clusterID {
+				status.LastError = "cluster is the source cluster, sources are not synced into it"
+			}
+		}
+	}
+	return s.updateRemoteClusterStatus(rc, status)
+}
+
+// checkSelfContained refuses kubeconfig files that run commands or read files of the operator. Anyone who
+// can write a Secret in the operator namespace could otherwise do so by registering a RemoteCluster.
+func checkSelfContained(kConfig *clientcmdapi.Config) error {
+	var errs []error
+	users := make([]string, 0, len(kConfig.AuthInfos))
+	for name := range kConfig.AuthInfos {
+		users = append(users, name)
+	}
+	sort.Strings(users)
+	for _, name := range users {
+		authInfo := kConfig.AuthInfos[name]
+		switch {
+		case authInfo.Exec != nil:
+			errs = append(errs, errors.Errorf("user %s uses an exec plugin", name))
+		case authInfo.AuthProvider != nil:
+			errs = append(errs, errors.Errorf("user %s uses an auth provider", name))
+		case authInfo.ClientCertificate != "" || authInfo.ClientKey != "" || authInfo.TokenFile != "":
+			errs = append(errs, errors.Errorf("user %s refers to files, use client-certificate-data, client-key-data or token instead", name))
+		}
+	}
+	clusters := make([]string, 0, len(kConfig.Clusters))
+	for name := range kConfig.Clusters {
+		clusters = append(clusters, name)
+	}
+	sort.Strings(clusters)
+	for _, name := range clusters {
+		if kConfig.Clusters[name].CertificateAuthority != "" {
+			errs = append(errs, errors.Errorf("cluster %s refers to a file, use certificate-authority-data instead", name))
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// newRemoteCluster builds the clients for the kubeconfig file in the Secret of rc. secret is nil if it does not exist.
+func newRemoteCluster(rc *api.RemoteCluster, secret *core.Secret) (*remoteCluster, error) {
+	ref := rc.Spec.KubeconfigSecretRef
+	if secret == nil {
+		return nil, errors.Errorf("Secret %s not found", ref.Name)
+	}
+	data, found := secret.Data[ref.KubeconfigKey()]
+	if !found {
+		return nil, errors.Errorf("key %s not found in Secret %s", ref.KubeconfigKey(), ref.Name)
+	}
+	kConfig, err := clientcmd.Load(data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse kubeconfig file of Secret %s", ref.Name)
+	}
+	if err := checkSelfContained(kConfig); err != nil {
+		return nil, errors.Wrapf(err, "refusing kubeconfig file of Secret %s", ref.Name)
+	}
+	contextName := rc.Spec.Context
+	if contextName == "" {
+		contextName = kConfig.CurrentContext
+	}
+	ctx, err := newClusterContext(kConfig, contextName)
+	if err != nil {
+		return nil, err
+	}
+	if rc.Spec.Namespace != "" {
+		ctx.Namespace = rc.Spec.Namespace
+	}
+	ctx.CreateNamespace = rc.Spec.CreateNamespace
+
+	spec, err := json.Marshal(rc.Spec)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	h.Write(data)
+	h.Write(spec)
+	return &remoteCluster{clusterContext: ctx, hash: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// setRemoteCluster registers or, if cluster is nil, removes the cluster of a RemoteCluster
+func (s *ConfigSyncer) setRemoteCluster(name string, cluster *remoteCluster) error {
+	s.lock.Lock()
+	prev, found := s.remoteClusters[name]
+	if (cluster == nil && !found) || (cluster != nil && found && prev.hash == cluster.hash) {
+		s.lock.Unlock()
+		return nil
+	}
+	old := s.contexts
+	if s.remoteClusters == nil {
+		s.remoteClusters = map[string]remoteCluster{}
+	}
+	if cluster == nil {
+		delete(s.remoteClusters, name)
+	} else {
+		s.remoteClusters[name] = *cluster
+	}
+	s.mergeContexts()
+	cur := s.contexts
+	s.lock.Unlock()
+
+	if cluster == nil {
+		klog.Infof("removed RemoteCluster %s", name)
+	} else {
+		klog.Infof("registered RemoteCluster %s at %s", name, cluster.Address)
+	}
+	return s.contextsChanged(old, cur)
+}
+
+// LoadRemoteClusters registers the RemoteClusters of the operator namespace for syncers that run
+// without informers. RemoteClusters that can not be used are skipped, the RemoteCluster CRD not
+// being registered is not an error.
+func (s *ConfigSyncer) LoadRemoteClusters(namespace string) error {
+	list, err := s.kubedClient.KubedV1alpha1().RemoteClusters(namespace).List(context.TODO(), metav1.ListOptions{})
+	if kerr.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	clusters := map[string]remoteCluster{}
+	for i := range list.Items {
+		rc := &list.Items[i]
+		secret, err := s.kubeClient.CoreV1().Secrets(namespace).Get(context.TODO(), rc.Spec.KubeconfigSecretRef.Name, metav1.GetOptions{})
+		if kerr.IsNotFound(err) {
+			secret = nil
+		} else if err != nil {
+			return err
+		}
+		cluster, err := newRemoteCluster(rc, secret)
+		if err != nil {
+			klog.Warningf("skipping RemoteCluster %s: %v", rc.Name, err)
+			continue
+		}
+		clusters[rc.Name] = *cluster
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.remoteClusters = clusters
+	s.mergeContexts()
+	return nil
+}
+
+func (s *ConfigSyncer) updateRemoteClusterStatus(rc *api.RemoteCluster, status api.RemoteClusterStatus) error {
+	if equality.Semantic.DeepEqual(rc.Status, status) {
+		return nil
+	}
+	obj := rc.DeepCopy()
+	obj.Status = status
+	_, err := s.kubedClient.KubedV1alpha1().RemoteClusters(obj.Namespace).UpdateStatus(context.TODO(), obj, metav1.UpdateOptions{})
+	if kerr.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
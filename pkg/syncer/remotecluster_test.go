@@ -0,0 +1,122 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	api "kubeops.dev/config-syncer/apis/kubed/v1alpha1"
+	kubedfake "kubeops.dev/config-syncer/client/clientset/versioned/fake"
+	kubed_listers "kubeops.dev/config-syncer/client/listers/kubed/v1alpha1"
+
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	core_listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+)
+
+func remoteKubeconfig(user, cluster string) []byte {
+	return []byte(`apiVersion: v1
+kind: Config
+current-context: east
+clusters:
+- name: east
+  cluster:
+    server: https://east.example.com
+` + cluster + `
+contexts:
+- name: east
+  context:
+    cluster: east
+    user: east
+users:
+- name: east
+  user:
+` + user)
+}
+
+func TestNewRemoteCluster(t *testing.T) {
+	tests := []struct {
+		name    string
+		user    string
+		cluster string
+		wantErr string
+	}{
+		{name: "token", user: "    token: secret\n"},
+		{name: "exec plugin", user: "    exec:\n      apiVersion: client.authentication.k8s.io/v1\n      command: /bin/sh\n", wantErr: "exec plugin"},
+		{name: "auth provider", user: "    auth-provider:\n      name: gcp\n      config:\n        cmd-path: /bin/sh\n", wantErr: "auth provider"},
+		{name: "client certificate file", user: "    client-certificate: /etc/ssl/tls.crt\n    client-key: /etc/ssl/tls.key\n", wantErr: "refers to files"},
+		{name: "token file", user: "    tokenFile: /var/run/secrets/kubernetes.io/serviceaccount/token\n", wantErr: "refers to files"},
+		{name: "certificate authority file", user: "    token: secret\n", cluster: "    certificate-authority: /etc/ssl/ca.crt\n", wantErr: "refers to a file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc := &api.RemoteCluster{ObjectMeta: metav1.ObjectMeta{Name: "east", Namespace: "kubed"}}
+			rc.Spec.KubeconfigSecretRef.Name = "east"
+			secret := &core.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "east", Namespace: "kubed"},
+				Data:       map[string][]byte{api.DefaultKubeconfigKey: remoteKubeconfig(tt.user, tt.cluster)},
+			}
+			_, err := newRemoteCluster(rc, secret)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("got error %v, want none", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRemoteClusterStatusReportsRefusedKubeconfig(t *testing.T) {
+	rc := &api.RemoteCluster{ObjectMeta: metav1.ObjectMeta{Name: "east", Namespace: "kubed", Generation: 1}}
+	rc.Spec.KubeconfigSecretRef.Name = "east"
+	secret := &core.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "east", Namespace: "kubed"},
+		Data:       map[string][]byte{api.DefaultKubeconfigKey: remoteKubeconfig("    exec:\n      apiVersion: client.authentication.k8s.io/v1\n      command: /bin/sh\n", "")},
+	}
+	rcIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	secretIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	if err := rcIndexer.Add(rc); err != nil {
+		t.Fatal(err)
+	}
+	if err := secretIndexer.Add(secret); err != nil {
+		t.Fatal(err)
+	}
+	kubedClient := kubedfake.NewSimpleClientset(rc)
+	s := New(fake.NewSimpleClientset(), nil, kubedClient, record.NewFakeRecorder(10), Options{})
+	s.rcLister = kubed_listers.NewRemoteClusterLister(rcIndexer)
+	s.rcSecretLister = core_listers.NewSecretLister(secretIndexer)
+
+	if err := s.reconcileRemoteCluster("kubed/east"); err != nil {
+		t.Fatal(err)
+	}
+	if _, found := s.contexts["east"]; found {
+		t.Error("context east registered from a refused kubeconfig file")
+	}
+	out, err := kubedClient.KubedV1alpha1().RemoteClusters("kubed").Get(context.TODO(), "east", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.Status.LastError, "exec plugin") {
+		t.Errorf("last error = %q, want the refused exec plugin", out.Status.LastError)
+	}
+}
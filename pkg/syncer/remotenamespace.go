@@ -0,0 +1,176 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"strings"
+
+	api "kubeops.dev/config-syncer/apis/kubed/v1alpha1"
+	"kubeops.dev/config-syncer/pkg/eventer"
+
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+)
+
+// ensureNamespace creates the target namespace in the cluster of ctx if it is missing and
+// either the source or the context opts in
+func (s *ConfigSyncer) ensureNamespace(src object, ctxName string, ctx clusterContext, opts SyncOptions) error {
+	creation := namespaceCreation(opts, ctx)
+	if creation == nil {
+		return nil
+	}
+
+	_, err := ctx.Client.CoreV1().Namespaces().Get(context.TODO(), ctx.Namespace, metav1.GetOptions{})
+	if err == nil || !kerr.IsNotFound(err) {
+		return err
+	}
+
+	ns := createdNamespace(ctx.Namespace, creation)
+	if _, err = ctx.Client.CoreV1().Namespaces().Create(context.TODO(), ns, metav1.CreateOptions{}); kerr.IsAlreadyExists(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	klog.Infof("created namespace %s of context %s", ctx.Namespace, ctxName)
+	s.recorder.Eventf(src, core.EventTypeNormal, eventer.EventReasonNamespaceCreated, "Created %s", targetString(ctx.Namespace, ctxName))
+	return nil
+}
+
+// namespaceCreation returns how a missing namespace of ctx is created, nil if it is not. The source takes
+// precedence over the context.
+func namespaceCreation(opts SyncOptions, ctx clusterContext) *api.NamespaceCreation {
+	if opts.CreateNamespace != nil {
+		return opts.CreateNamespace
+	}
+	return ctx.CreateNamespace
+}
+
+// createdNamespace is the namespace name as ensureNamespace creates it
+func createdNamespace(name string, creation *api.NamespaceCreation) *core.Namespace {
+	ns := &core.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Labels:      creation.Labels,
+			Annotations: map[string]string{NamespaceCreatedByKey: "config-syncer"},
+		},
+	}
+	if creation.Prune {
+		ns.Annotations[NamespacePruneKey] = "true"
+	}
+	return ns
+}
+
+// pruneNamespace deletes a namespace of the cluster of ctx that was created with pruning
+// enabled, once it holds no more copies of any source and nothing else. Errors are only logged.
+func (s *ConfigSyncer) pruneNamespace(src object, ctxName, namespace string) {
+	ctx, found := s.contexts[ctxName]
+	if !found {
+		return
+	}
+	ns, err := ctx.Client.CoreV1().Namespaces().Get(context.TODO(), namespace, metav1.GetOptions{})
+	if err != nil {
+		if !kerr.IsNotFound(err) {
+			klog.Errorf("failed to prune %s: %v", targetString(namespace, ctxName), err)
+		}
+		return
+	}
+	if ns.Annotations[NamespacePruneKey] != "true" || ns.Annotations[NamespaceCreatedByKey] == "" || ns.DeletionTimestamp != nil {
+		return
+	}
+
+	held, err := heldObject(ctx, namespace)
+	if err != nil {
+		klog.Errorf("failed to prune %s: %v", targetString(namespace, ctxName), err)
+		return
+	} else if held != "" {
+		klog.V(4).Infof("not pruning %s, it holds %s", targetString(namespace, ctxName), held)
+		return
+	}
+
+	err = ctx.Client.CoreV1().Namespaces().Delete(context.TODO(), namespace, metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{UID: &ns.UID},
+	})
+	if err != nil && !kerr.IsNotFound(err) {
+		klog.Errorf("failed to prune %s: %v", targetString(namespace, ctxName), err)
+		return
+	}
+	klog.Infof("pruned namespace %s of context %s", namespace, ctxName)
+	if recordable(src) {
+		s.recorder.Eventf(src, core.EventTypeNormal, eventer.EventReasonNamespacePruned, "Deleted %s, it holds no more copies", targetString(namespace, ctxName))
+	}
+}
+
+// heldObject returns an object held by a namespace other than those Kubernetes creates in every namespace,
+// empty if there is none. Copies of sources of any cluster count as well, so that a namespace is only pruned
+// once it is empty and deleting it deletes nothing but what it was created with.
+func heldObject(ctx clusterContext, namespace string) (string, error) {
+	_, lists, err := ctx.Client.Discovery().ServerGroupsAndResources()
+	if err != nil {
+		return "", err
+	}
+	listed := map[schema.GroupResource]bool{}
+	for _, list := range lists {
+		gv, err := schema.ParseGroupVersion(list.GroupVersion)
+		if err != nil {
+			return "", err
+		}
+		for _, r := range list.APIResources {
+			gr := gv.WithResource(r.Name).GroupResource()
+			if !r.Namespaced || strings.Contains(r.Name, "/") || !sets.NewString(r.Verbs...).Has("list") || listed[gr] || ignoredResources.Has(gr.String()) {
+				continue
+			}
+			listed[gr] = true
+
+			items, err := ctx.DynamicClient.Resource(gv.WithResource(r.Name)).Namespace(namespace).List(context.TODO(), metav1.ListOptions{Limit: 5})
+			if err != nil {
+				return "", err
+			}
+			for _, item := range items.Items {
+				if !createdByKubernetes(gr, &item) {
+					return gr.String() + " " + item.GetName(), nil
+				}
+			}
+			if items.GetContinue() != "" {
+				return gr.String(), nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// ignoredResources are never considered when checking whether a namespace is empty
+var ignoredResources = sets.NewString("events", "events.events.k8s.io")
+
+// createdByKubernetes checks whether obj is created by Kubernetes in every namespace
+func createdByKubernetes(gr schema.GroupResource, obj *unstructured.Unstructured) bool {
+	switch gr.String() {
+	case "configmaps":
+		return obj.GetName() == "kube-root-ca.crt"
+	case "serviceaccounts":
+		return obj.GetName() == "default"
+	case "secrets":
+		typ, _, _ := unstructured.NestedString(obj.Object, "type")
+		return typ == string(core.SecretTypeServiceAccountToken) && obj.GetAnnotations()[core.ServiceAccountNameKey] == "default"
+	}
+	return false
+}
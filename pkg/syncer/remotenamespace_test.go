@@ -0,0 +1,109 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"testing"
+
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestPruneNamespace(t *testing.T) {
+	object := func(kind, name string, labels map[string]string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion("v1")
+		obj.SetKind(kind)
+		obj.SetNamespace("team")
+		obj.SetName(name)
+		obj.SetLabels(labels)
+		return obj
+	}
+	defaults := []runtime.Object{
+		object("ConfigMap", "kube-root-ca.crt", nil),
+		object("ServiceAccount", "default", nil),
+		object("Event", "team.1", nil),
+	}
+	prunable := map[string]string{NamespaceCreatedByKey: "config-syncer", NamespacePruneKey: "true"}
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		objects     []runtime.Object
+		wantDeleted bool
+	}{
+		{name: "empty", annotations: prunable, wantDeleted: true},
+		{name: "pruning disabled", annotations: map[string]string{NamespaceCreatedByKey: "config-syncer"}},
+		{
+			name:        "copy of another source",
+			annotations: prunable,
+			objects:     []runtime.Object{object("Secret", "creds", map[string]string{OriginNameLabelKey: "creds"})},
+		},
+		{
+			name:        "configmap of a tenant",
+			annotations: prunable,
+			objects:     []runtime.Object{object("ConfigMap", "settings", nil)},
+		},
+		{
+			name:        "pod of a tenant",
+			annotations: prunable,
+			objects:     []runtime.Object{object("Pod", "web", nil)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kc := fake.NewSimpleClientset(&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team", Annotations: tt.annotations}})
+			kc.Resources = []*metav1.APIResourceList{{
+				GroupVersion: "v1",
+				APIResources: []metav1.APIResource{
+					{Name: "configmaps", Namespaced: true, Kind: "ConfigMap", Verbs: []string{"list"}},
+					{Name: "secrets", Namespaced: true, Kind: "Secret", Verbs: []string{"list"}},
+					{Name: "serviceaccounts", Namespaced: true, Kind: "ServiceAccount", Verbs: []string{"list"}},
+					{Name: "events", Namespaced: true, Kind: "Event", Verbs: []string{"list"}},
+					{Name: "pods", Namespaced: true, Kind: "Pod", Verbs: []string{"list"}},
+					{Name: "pods/log", Namespaced: true, Kind: "Pod", Verbs: []string{"get"}},
+					{Name: "namespaces", Kind: "Namespace", Verbs: []string{"list"}},
+				},
+			}}
+			dc := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+				{Version: "v1", Resource: "configmaps"}:      "ConfigMapList",
+				{Version: "v1", Resource: "secrets"}:         "SecretList",
+				{Version: "v1", Resource: "serviceaccounts"}: "ServiceAccountList",
+				{Version: "v1", Resource: "events"}:          "EventList",
+				{Version: "v1", Resource: "pods"}:            "PodList",
+			}, append(append([]runtime.Object{}, defaults...), tt.objects...)...)
+
+			s := New(fake.NewSimpleClientset(), nil, nil, record.NewFakeRecorder(10), Options{})
+			s.contexts = map[string]clusterContext{"edge": {Client: kc, DynamicClient: dc}}
+			src := &core.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "omni", Namespace: "demo"}}
+			s.pruneNamespace(src, "edge", "team")
+
+			_, err := kc.CoreV1().Namespaces().Get(context.TODO(), "team", metav1.GetOptions{})
+			if deleted := kerr.IsNotFound(err); deleted != tt.wantDeleted {
+				t.Errorf("namespace deleted = %v, want %v", deleted, tt.wantDeleted)
+			}
+		})
+	}
+}
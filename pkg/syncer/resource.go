@@ -0,0 +1,331 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"strings"
+
+	"kubeops.dev/config-syncer/pkg/eventer"
+
+	"github.com/pkg/errors"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	kutil "kmodules.xyz/client-go"
+	"kmodules.xyz/client-go/meta"
+	"kmodules.xyz/client-go/tools/queue"
+)
+
+// ResourceRule configures syncing of a namespaced resource other than ConfigMaps and Secrets
+type ResourceRule struct {
+	GVR schema.GroupVersionResource
+	// dot separated paths of the copied fields, if empty every field but metadata and status is copied
+	Fields []string
+}
+
+// ParseResourceRule parses rules of the form resource.version[.group][=field,field...],
+// eg. networkpolicies.v1.networking.k8s.io=spec or limitranges.v1
+func ParseResourceRule(s string) (ResourceRule, error) {
+	var rule ResourceRule
+
+	res, fields, _ := strings.Cut(s, "=")
+	parts := strings.SplitN(strings.TrimSpace(res), ".", 3)
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return rule, errors.Errorf("invalid resource %q, must be of the form resource.version[.group]", res)
+	}
+	rule.GVR = schema.GroupVersionResource{Resource: parts[0], Version: parts[1]}
+	if len(parts) == 3 {
+		rule.GVR.Group = parts[2]
+	}
+	if rule.GVR.Group == "" && (rule.GVR.Resource == "configmaps" || rule.GVR.Resource == "secrets") {
+		return rule, errors.Errorf("%s are always synced", rule.GVR.Resource)
+	}
+	rule.Fields = splitPatterns(fields)
+	for _, f := range rule.Fields {
+		if f == "metadata" || strings.HasPrefix(f, "metadata.") {
+			return rule, errors.Errorf("invalid field %q for resource %s, metadata is never copied", f, rule.GVR)
+		}
+	}
+	return rule, nil
+}
+
+func (rule ResourceRule) String() string {
+	s := rule.GVR.Resource + "." + rule.GVR.Version
+	if rule.GVR.Group != "" {
+		s += "." + rule.GVR.Group
+	}
+	if len(rule.Fields) > 0 {
+		s += "=" + strings.Join(rule.Fields, ",")
+	}
+	return s
+}
+
+// fieldPaths returns the paths of the fields copied from obj
+func (rule ResourceRule) fieldPaths(obj *unstructured.Unstructured) [][]string {
+	var paths [][]string
+	if len(rule.Fields) > 0 {
+		for _, f := range rule.Fields {
+			paths = append(paths, strings.Split(f, "."))
+		}
+		return paths
+	}
+	for k := range obj.Object {
+		switch k {
+		case "apiVersion", "kind", "metadata", "status":
+		default:
+			paths = append(paths, []string{k})
+		}
+	}
+	return paths
+}
+
+// copyFields copies the fields selected by rule from src to dst. Fields missing in src are removed from dst.
+func (rule ResourceRule) copyFields(src, dst *unstructured.Unstructured) error {
+	paths := rule.fieldPaths(src)
+	if len(rule.Fields) == 0 {
+		// also drop top level fields that were removed from the source
+		paths = append(paths, rule.fieldPaths(dst)...)
+	}
+	for _, p := range paths {
+		v, found, err := unstructured.NestedFieldCopy(src.Object, p...)
+		if err != nil {
+			return err
+		}
+		if !found {
+			unstructured.RemoveNestedField(dst.Object, p...)
+			continue
+		}
+		if err := unstructured.SetNestedField(dst.Object, v, p...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fieldsEqual checks whether a and b agree on the fields selected by rule
+func (rule ResourceRule) fieldsEqual(a, b *unstructured.Unstructured) bool {
+	paths := rule.fieldPaths(a)
+	if len(rule.Fields) == 0 {
+		paths = append(paths, rule.fieldPaths(b)...)
+	}
+	for _, p := range paths {
+		va, _, _ := unstructured.NestedFieldNoCopy(a.Object, p...)
+		vb, _, _ := unstructured.NestedFieldNoCopy(b.Object, p...)
+		if !equality.Semantic.DeepEqual(va, vb) {
+			return false
+		}
+	}
+	return true
+}
+
+type resourceSyncer struct {
+	ResourceRule
+	lister  cache.GenericLister
+	indexer cache.Indexer
+	queue   *queue.Worker
+}
+
+func (s *ConfigSyncer) reconcileResource(rs *resourceSyncer, key string) error {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+	obj, err := rs.lister.ByNamespace(namespace).Get(name)
+	if kerr.IsNotFound(err) {
+		klog.Infof("%s %s does not exist anymore", rs.GVR.Resource, key)
+		src := &unstructured.Unstructured{}
+		src.SetName(name)
+		src.SetNamespace(namespace)
+		src.SetDeletionTimestamp(deletedAt())
+		deleteManagedCopies(rs.GVR.GroupResource().String(), namespace, name)
+		s.forgetAttempt(rs.GVR.GroupResource().String(), src)
+		return s.SyncDeletedResource(rs.ResourceRule, src)
+	} else if err != nil {
+		return err
+	}
+	src, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return errors.Errorf("unexpected object of type %T for %s", obj, rs.GVR)
+	}
+	err = s.syncAndRecord(rs.GVR.GroupResource().String(), src, resourceCopier{s, rs.ResourceRule}.options(src), func(src object) error {
+		return s.SyncResource(rs.ResourceRule, src.(*unstructured.Unstructured))
+	})
+	return utilerrors.NewAggregate([]error{err, s.updateResourceSyncStatus(rs.ResourceRule, src, err)})
+}
+
+func (s *ConfigSyncer) updateResourceSyncStatus(rule ResourceRule, src *unstructured.Unstructured, syncErr error) error {
+	namespaces := func() ([]string, error) {
+		return s.copyNamespaces(resourceCopier{s, rule}, src)
+	}
+	return s.updateSyncStatus(rule.GVR.GroupResource().String(), src, resourceCopier{s, rule}.options(src), namespaces, syncErr, func(patch []byte) error {
+		_, err := s.dynamicClient.Resource(rule.GVR).Namespace(src.GetNamespace()).Patch(context.TODO(), src.GetName(), types.MergePatchType, patch, metav1.PatchOptions{})
+		return err
+	})
+}
+
+func (s *ConfigSyncer) SyncResource(rule ResourceRule, src *unstructured.Unstructured) error {
+	return s.syncSource(resourceCopier{s, rule}, src)
+}
+
+// source deleted, delete that were previously added
+func (s *ConfigSyncer) SyncDeletedResource(rule ResourceRule, src *unstructured.Unstructured) error {
+	return s.syncDeletedSource(resourceCopier{s, rule}, src)
+}
+
+type resourceCopier struct {
+	s    *ConfigSyncer
+	rule ResourceRule
+}
+
+func (c resourceCopier) resource() string {
+	return c.rule.GVR.GroupResource().String()
+}
+
+// options ignores ConfigSyncs, they only refer to ConfigMaps and Secrets
+func (c resourceCopier) options(src metav1.Object) SyncOptions {
+	return c.s.syncOptionsFor("", src)
+}
+
+func (c resourceCopier) source(namespace, name string) (object, error) {
+	if rs, found := c.s.resources[c.rule.GVR]; found && rs.lister != nil {
+		obj, err := rs.lister.ByNamespace(namespace).Get(name)
+		if err != nil {
+			return nil, err
+		}
+		src, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			return nil, errors.Errorf("unexpected object of type %T for %s", obj, c.rule.GVR)
+		}
+		return src, nil
+	}
+	return c.s.dynamicClient.Resource(c.rule.GVR).Namespace(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+}
+
+func (c resourceCopier) copies(src object, ctx, namespace string) ([]object, error) {
+	items, err := c.s.resourceCopies(c.s.dynamicClientFor(ctx), c.rule, src.(*unstructured.Unstructured), ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]object, len(items))
+	for i := range items {
+		out[i] = &items[i]
+	}
+	return out, nil
+}
+
+func (c resourceCopier) list(cluster clusterContext, sel labels.Selector) ([]object, error) {
+	items, err := cluster.DynamicClient.Resource(c.rule.GVR).Namespace(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: sel.String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]object, len(items.Items))
+	for i := range items.Items {
+		out[i] = &items.Items[i]
+	}
+	return out, nil
+}
+
+func (c resourceCopier) upsert(src object, namespace, ctx string) error {
+	return c.s.upsertResource(c.s.dynamicClientFor(ctx), c.rule, src.(*unstructured.Unstructured), namespace, ctx)
+}
+
+func (c resourceCopier) delete(cluster clusterContext, obj object) error {
+	return cluster.DynamicClient.Resource(c.rule.GVR).Namespace(obj.GetNamespace()).Delete(context.TODO(), obj.GetName(), metav1.DeleteOptions{})
+}
+
+func (s *ConfigSyncer) upsertResource(dc dynamic.Interface, rule ResourceRule, src *unstructured.Unstructured, namespace, ctx string) error {
+	opts := resourceCopier{s, rule}.options(src)
+	name := opts.CopyName(src.GetName(), ctx)
+	ri := dc.Resource(rule.GVR).Namespace(namespace)
+
+	cur, err := ri.Get(context.TODO(), name, metav1.GetOptions{})
+	if kerr.IsNotFound(err) {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion(src.GetAPIVersion())
+		obj.SetKind(src.GetKind())
+		obj.SetName(name)
+		obj.SetNamespace(namespace)
+		if err := s.setResourceCopy(rule, src, obj); err != nil {
+			return err
+		}
+		obj, err = ri.Create(context.TODO(), obj, metav1.CreateOptions{})
+		if err != nil {
+			return err
+		}
+		s.recordCopyWritten(src, obj, kutil.VerbCreated, ctx)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if !s.resolveConflict(src, cur, opts, rule.fieldsEqual(src, cur), namespace, ctx) {
+		return errConflictSkipped
+	}
+
+	// check origin cluster, if not match overwrite and create an event
+	if v, ok := cur.GetLabels()[OriginClusterLabelKey]; ok && v != s.clusterName {
+		s.recorder.Eventf(
+			src,
+			core.EventTypeWarning,
+			eventer.EventReasonOriginConflict,
+			"Origin cluster changed from %s in context %s", v, ctx,
+		)
+	}
+
+	obj := cur.DeepCopy()
+	if err := s.setResourceCopy(rule, src, obj); err != nil {
+		return err
+	}
+	if equality.Semantic.DeepEqual(cur, obj) {
+		return nil
+	}
+	// patch like the other kinds, so writes of others in between do not fail with a conflict
+	patch, err := meta.CreateJSONMergePatch(cur.Object, obj.Object)
+	if err != nil {
+		return err
+	}
+	obj, err = ri.Patch(context.TODO(), name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return err
+	}
+	s.recordCopyWritten(src, obj, kutil.VerbPatched, ctx)
+	return nil
+}
+
+// setResourceCopy writes the copied fields, labels and annotations of src into obj
+func (s *ConfigSyncer) setResourceCopy(rule ResourceRule, src, obj *unstructured.Unstructured) error {
+	if err := rule.copyFields(src, obj); err != nil {
+		return err
+	}
+	s.setCopyMeta(obj, src, originRef(src))
+	return nil
+}
@@ -0,0 +1,196 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestParseResourceRule(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    ResourceRule
+		wantErr bool
+	}{
+		{in: "limitranges.v1", want: ResourceRule{GVR: schema.GroupVersionResource{Resource: "limitranges", Version: "v1"}}},
+		{
+			in: "networkpolicies.v1.networking.k8s.io=spec",
+			want: ResourceRule{
+				GVR:    schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1", Resource: "networkpolicies"},
+				Fields: []string{"spec"},
+			},
+		},
+		{
+			in: "roles.v1.rbac.authorization.k8s.io=rules, aggregationRule.clusterRoleSelectors",
+			want: ResourceRule{
+				GVR:    schema.GroupVersionResource{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "roles"},
+				Fields: []string{"rules", "aggregationRule.clusterRoleSelectors"},
+			},
+		},
+		{in: "limitranges", wantErr: true},
+		{in: ".v1", wantErr: true},
+		{in: "configmaps.v1", wantErr: true},
+		{in: "secrets.v1=data", wantErr: true},
+		{in: "networkpolicies.v1.networking.k8s.io=metadata.labels", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseResourceRule(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseResourceRule() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseResourceRule() = %+v, want %+v", got, tt.want)
+			}
+			if again, err := ParseResourceRule(got.String()); err != nil || !reflect.DeepEqual(again, got) {
+				t.Errorf("ParseResourceRule(%q) = %+v, %v, want %+v", got.String(), again, err, got)
+			}
+		})
+	}
+}
+
+func TestSyncResource(t *testing.T) {
+	rule, err := ParseResourceRule("networkpolicies.v1.networking.k8s.io=spec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "networking.k8s.io/v1",
+		"kind":       "NetworkPolicy",
+		"metadata": map[string]interface{}{
+			"name":        "deny-all",
+			"namespace":   "demo",
+			"uid":         "src",
+			"annotations": map[string]interface{}{ConfigSyncKey: "team=a"},
+		},
+		"spec": map[string]interface{}{
+			"podSelector": map[string]interface{}{},
+		},
+	}}
+	kc := fake.NewSimpleClientset(
+		&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "demo"}},
+		&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "a", Labels: map[string]string{"team": "a"}}},
+		&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "b", Labels: map[string]string{"team": "b"}}},
+	)
+	dc := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		rule.GVR: "NetworkPolicyList",
+	}, src.DeepCopy())
+	s := New(kc, dc, nil, record.NewFakeRecorder(10), Options{})
+	s.clusterName = "hub"
+
+	copyIn := func(namespace string) *unstructured.Unstructured {
+		obj, err := dc.Resource(rule.GVR).Namespace(namespace).Get(context.TODO(), "deny-all", metav1.GetOptions{})
+		if err != nil {
+			return nil
+		}
+		return obj
+	}
+
+	if err := s.SyncResource(rule, src); err != nil {
+		t.Fatal(err)
+	}
+	obj := copyIn("a")
+	if obj == nil {
+		t.Fatal("copy in namespace a not created")
+	}
+	if !s.isCopyOf(obj, "demo", "deny-all") {
+		t.Errorf("copy has labels %v, want origin labels of demo/deny-all", obj.GetLabels())
+	}
+	if !rule.fieldsEqual(src, obj) {
+		t.Errorf("copy has spec %v, want %v", obj.Object["spec"], src.Object["spec"])
+	}
+	if copyIn("b") != nil {
+		t.Error("copy in namespace b created, namespace is not selected")
+	}
+
+	src.SetAnnotations(map[string]string{ConfigSyncKey: "team=b"})
+	if err := s.SyncResource(rule, src); err != nil {
+		t.Fatal(err)
+	}
+	if copyIn("a") != nil {
+		t.Error("copy in namespace a not deleted, namespace is no longer selected")
+	}
+	if copyIn("b") == nil {
+		t.Error("copy in namespace b not created")
+	}
+	if copyIn("demo") == nil {
+		t.Error("source deleted")
+	}
+}
+
+// copies are patched like the other kinds, writes in between by others do not fail the sync with a conflict
+func TestUpsertResourceConcurrentWrite(t *testing.T) {
+	rule, err := ParseResourceRule("networkpolicies.v1.networking.k8s.io=spec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "networking.k8s.io/v1",
+		"kind":       "NetworkPolicy",
+		"metadata":   map[string]interface{}{"name": "deny-all", "namespace": "demo", "uid": "src"},
+		"spec":       map[string]interface{}{"podSelector": map[string]interface{}{}, "policyTypes": []interface{}{"Ingress"}},
+	}}
+	kc := fake.NewSimpleClientset()
+	s := New(kc, nil, nil, record.NewFakeRecorder(10), Options{})
+	s.clusterName = "hub"
+
+	old := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "networking.k8s.io/v1",
+		"kind":       "NetworkPolicy",
+		"metadata":   map[string]interface{}{"name": "deny-all", "namespace": "a", "resourceVersion": "1"},
+		"spec":       map[string]interface{}{"podSelector": map[string]interface{}{}},
+	}}
+	if err := s.setResourceCopy(rule, src, old); err != nil {
+		t.Fatal(err)
+	}
+	old.Object["spec"] = map[string]interface{}{"podSelector": map[string]interface{}{}} // outdated
+	dc := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		rule.GVR: "NetworkPolicyList",
+	}, old)
+	// the copy was written by someone else since it was read
+	dc.PrependReactor("update", "networkpolicies", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		return true, nil, kerr.NewConflict(rule.GVR.GroupResource(), "deny-all", errors.New("the object has been modified"))
+	})
+
+	if err := s.upsertResource(dc, rule, src, "a", ""); err != nil {
+		t.Fatal(err)
+	}
+	obj, err := dc.Resource(rule.GVR).Namespace("a").Get(context.TODO(), "deny-all", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rule.fieldsEqual(src, obj) {
+		t.Errorf("copy has spec %v, want %v", obj.Object["spec"], src.Object["spec"])
+	}
+}
@@ -19,12 +19,20 @@ package syncer
 import (
 	"reflect"
 
+	api "kubeops.dev/config-syncer/apis/kubed/v1alpha1"
+
 	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	core_listers "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
-	"k8s.io/klog/v2"
+	"kmodules.xyz/client-go/tools/queue"
 )
 
-func (s *ConfigSyncer) ConfigMapHandler() cache.ResourceEventHandler {
+// ConfigMapHandler queues changed ConfigMaps. The indexer must index ConfigMaps using SourceIndexers.
+func (s *ConfigSyncer) ConfigMapHandler(indexer cache.Indexer) cache.ResourceEventHandler {
+	s.cmIndexer = indexer
+	s.cmLister = core_listers.NewConfigMapLister(indexer)
 	return &configmapSyncer{s}
 }
 
@@ -35,20 +43,12 @@ type configmapSyncer struct {
 var _ cache.ResourceEventHandler = &configmapSyncer{}
 
 func (s *configmapSyncer) OnAdd(obj interface{}) {
-	s.lock.RLock()
-	defer s.lock.RUnlock()
-
-	if res, ok := obj.(*core.ConfigMap); ok {
-		if err := s.SyncConfigMap(res); err != nil {
-			klog.Errorln(err)
-		}
+	if _, ok := obj.(*core.ConfigMap); ok {
+		queue.Enqueue(s.cmQueue.GetQueue(), obj)
 	}
 }
 
 func (s *configmapSyncer) OnUpdate(oldObj, newObj interface{}) {
-	s.lock.RLock()
-	defer s.lock.RUnlock()
-
 	oldRes, ok := oldObj.(*core.ConfigMap)
 	if !ok {
 		return
@@ -58,28 +58,23 @@ func (s *configmapSyncer) OnUpdate(oldObj, newObj interface{}) {
 		return
 	}
 	if !reflect.DeepEqual(oldRes.Labels, newRes.Labels) ||
-		!reflect.DeepEqual(oldRes.Annotations, newRes.Annotations) ||
+		annotationsChanged(oldRes.Annotations, newRes.Annotations) ||
 		!reflect.DeepEqual(oldRes.Data, newRes.Data) ||
 		!reflect.DeepEqual(oldRes.BinaryData, newRes.BinaryData) {
 
-		if err := s.SyncConfigMap(newRes); err != nil {
-			klog.Errorln(err)
-		}
+		queue.Enqueue(s.cmQueue.GetQueue(), newObj)
 	}
 }
 
 func (s *configmapSyncer) OnDelete(obj interface{}) {
-	s.lock.RLock()
-	defer s.lock.RUnlock()
-
-	if res, ok := obj.(*core.ConfigMap); ok {
-		if err := s.SyncDeletedConfigMap(res); err != nil {
-			klog.Errorln(err)
-		}
-	}
+	// also handles cache.DeletedFinalStateUnknown, the reconciler only needs the key
+	queue.Enqueue(s.cmQueue.GetQueue(), obj)
 }
 
-func (s *ConfigSyncer) SecretHandler() cache.ResourceEventHandler {
+// SecretHandler queues changed Secrets. The indexer must index Secrets using SourceIndexers.
+func (s *ConfigSyncer) SecretHandler(indexer cache.Indexer) cache.ResourceEventHandler {
+	s.secretIndexer = indexer
+	s.secretLister = core_listers.NewSecretLister(indexer)
 	return &secretSyncer{s}
 }
 
@@ -90,20 +85,12 @@ type secretSyncer struct {
 var _ cache.ResourceEventHandler = &secretSyncer{}
 
 func (s *secretSyncer) OnAdd(obj interface{}) {
-	s.lock.RLock()
-	defer s.lock.RUnlock()
-
-	if res, ok := obj.(*core.Secret); ok {
-		if err := s.SyncSecret(res); err != nil {
-			klog.Errorln(err)
-		}
+	if _, ok := obj.(*core.Secret); ok {
+		queue.Enqueue(s.secretQueue.GetQueue(), obj)
 	}
 }
 
 func (s *secretSyncer) OnUpdate(oldObj, newObj interface{}) {
-	s.lock.RLock()
-	defer s.lock.RUnlock()
-
 	oldRes, ok := oldObj.(*core.Secret)
 	if !ok {
 		return
@@ -113,27 +100,100 @@ func (s *secretSyncer) OnUpdate(oldObj, newObj interface{}) {
 		return
 	}
 	if !reflect.DeepEqual(oldRes.Labels, newRes.Labels) ||
-		!reflect.DeepEqual(oldRes.Annotations, newRes.Annotations) ||
+		annotationsChanged(oldRes.Annotations, newRes.Annotations) ||
 		!reflect.DeepEqual(oldRes.Data, newRes.Data) {
 
-		if err := s.SyncSecret(newRes); err != nil {
-			klog.Errorln(err)
-		}
+		queue.Enqueue(s.secretQueue.GetQueue(), newObj)
 	}
 }
 
 func (s *secretSyncer) OnDelete(obj interface{}) {
-	s.lock.RLock()
-	defer s.lock.RUnlock()
+	// also handles cache.DeletedFinalStateUnknown, the reconciler only needs the key
+	queue.Enqueue(s.secretQueue.GetQueue(), obj)
+}
+
+// ConfigSyncHandler queues the sources of changed ConfigSyncs. The indexer must
+// index ConfigSyncs using ConfigSyncSourceIndexFunc.
+func (s *ConfigSyncer) ConfigSyncHandler(indexer cache.Indexer) cache.ResourceEventHandler {
+	s.csIndexer = indexer
+	return &configSyncSyncer{s}
+}
+
+type configSyncSyncer struct {
+	*ConfigSyncer
+}
+
+var _ cache.ResourceEventHandler = &configSyncSyncer{}
+
+func (s *configSyncSyncer) OnAdd(obj interface{}) {
+	s.enqueueSourceOf(obj)
+}
 
-	if res, ok := obj.(*core.Secret); ok {
-		if err := s.SyncDeletedSecret(res); err != nil {
-			klog.Infoln(err)
-		}
+func (s *configSyncSyncer) OnUpdate(oldObj, newObj interface{}) {
+	oldRes, ok := oldObj.(*api.ConfigSync)
+	if !ok {
+		return
 	}
+	newRes, ok := newObj.(*api.ConfigSync)
+	if !ok {
+		return
+	}
+	// status updates do not change the generation
+	if oldRes.Generation != newRes.Generation {
+		s.enqueueSourceOf(oldRes) // source may have changed
+		s.enqueueSourceOf(newRes)
+	}
+}
+
+func (s *configSyncSyncer) OnDelete(obj interface{}) {
+	s.enqueueSourceOf(obj)
 }
 
-func (s *ConfigSyncer) NamespaceHandler() cache.ResourceEventHandler {
+// ResourceHandler queues changed sources of a resource configured via Options.Resources.
+// The indexer must index objects of the resource using SourceIndexers.
+func (s *ConfigSyncer) ResourceHandler(gvr schema.GroupVersionResource, indexer cache.Indexer) cache.ResourceEventHandler {
+	rs := s.resources[gvr]
+	rs.indexer = indexer
+	rs.lister = cache.NewGenericLister(indexer, gvr.GroupResource())
+	return &resourceHandler{rs}
+}
+
+type resourceHandler struct {
+	*resourceSyncer
+}
+
+var _ cache.ResourceEventHandler = &resourceHandler{}
+
+func (h *resourceHandler) OnAdd(obj interface{}) {
+	if _, ok := obj.(*unstructured.Unstructured); ok {
+		queue.Enqueue(h.queue.GetQueue(), obj)
+	}
+}
+
+func (h *resourceHandler) OnUpdate(oldObj, newObj interface{}) {
+	oldRes, ok := oldObj.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+	newRes, ok := newObj.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+	if !reflect.DeepEqual(oldRes.GetLabels(), newRes.GetLabels()) ||
+		annotationsChanged(oldRes.GetAnnotations(), newRes.GetAnnotations()) ||
+		!h.fieldsEqual(oldRes, newRes) {
+
+		queue.Enqueue(h.queue.GetQueue(), newObj)
+	}
+}
+
+func (h *resourceHandler) OnDelete(obj interface{}) {
+	// also handles cache.DeletedFinalStateUnknown, the reconciler only needs the key
+	queue.Enqueue(h.queue.GetQueue(), obj)
+}
+
+func (s *ConfigSyncer) NamespaceHandler(lister core_listers.NamespaceLister) cache.ResourceEventHandler {
+	s.nsLister = lister
 	return &nsSyncer{s}
 }
 
@@ -141,29 +201,22 @@ type nsSyncer struct {
 	*ConfigSyncer
 }
 
-var _ cache.ResourceEventHandler = &secretSyncer{}
+var _ cache.ResourceEventHandler = &nsSyncer{}
 
 func (s *nsSyncer) OnAdd(obj interface{}) {
-	s.lock.RLock()
-	defer s.lock.RUnlock()
-
-	if res, ok := obj.(*core.Namespace); ok {
-		if err := s.SyncIntoNamespace(res.Name); err != nil {
-			klog.Errorln(err)
-		}
+	if _, ok := obj.(*core.Namespace); ok {
+		queue.Enqueue(s.nsQueue.GetQueue(), obj)
 	}
 }
 
 func (s *nsSyncer) OnUpdate(oldObj, newObj interface{}) {
-	s.lock.RLock()
-	defer s.lock.RUnlock()
-
 	old := oldObj.(*core.Namespace)
 	nu := newObj.(*core.Namespace)
-	if !reflect.DeepEqual(old.Labels, nu.Labels) {
-		if err := s.SyncIntoNamespace(nu.Name); err != nil {
-			klog.Errorln(err)
-		}
+	if !reflect.DeepEqual(old.Labels, nu.Labels) ||
+		old.Annotations[NamespaceSyncOptOutKey] != nu.Annotations[NamespaceSyncOptOutKey] ||
+		old.Annotations[NamespaceSyncAllowKey] != nu.Annotations[NamespaceSyncAllowKey] ||
+		old.Annotations[NamespaceSyncDenyKey] != nu.Annotations[NamespaceSyncDenyKey] {
+		queue.Enqueue(s.nsQueue.GetQueue(), nu)
 	}
 }
 
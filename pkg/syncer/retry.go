@@ -0,0 +1,121 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// syncAttempt remembers the targets the last sync of a version of a source failed for, so that
+// retrying it only writes those
+type syncAttempt struct {
+	// resourceVersion of the synced version of the source, as recorded in its copies
+	resourceVersion string
+	// hash of the sync options the source was synced with
+	options string
+	// keys of the failed targets, see TargetError.Target
+	failed sets.String
+	// keys of the targets holding an up to date copy. Targets added since are not in it.
+	succeeded sets.String
+	// namespaces of the source cluster holding a copy after the sync, nil if the sync failed as a whole
+	namespaces sets.String
+	// whether the sync succeeded for every target
+	ok bool
+}
+
+// lastAttempt returns the last sync of the current version of src with opts if it failed for some targets only, nil otherwise.
+// If the attempt is not known, e.g. after a restart, it is read from the sync status of src. The status only lists the
+// namespaces of the source cluster holding copies, so every context is written again. Sync options are not part of
+// the source, e.g. those of ConfigSyncs, so the status is only used if it was recorded with opts.
+func (s *ConfigSyncer) lastAttempt(resource string, src metav1.Object, opts SyncOptions) *syncAttempt {
+	rv := sourceResourceVersion(src)
+	if v, ok := s.attempts.Load(statusKey(resource, src)); ok {
+		if a := v.(*syncAttempt); a.resourceVersion == rv && a.options == optionsHash(opts) && a.failed.Len() > 0 {
+			return a
+		}
+		return nil
+	}
+	if s.agent != nil {
+		return nil // the sync status on sources of the hub is written by the operator of the hub
+	}
+	status, _ := GetSyncStatus(src.GetAnnotations())
+	if status == nil || status.ObservedResourceVersion != rv || status.OptionsHash != optionsHash(opts) ||
+		status.Error != "" || len(status.Errors) == 0 {
+		return nil
+	}
+	failed := sets.StringKeySet(status.Errors)
+	return &syncAttempt{
+		resourceVersion: rv,
+		options:         status.OptionsHash,
+		failed:          failed,
+		succeeded:       sets.NewString(status.Namespaces...).Difference(failed),
+	}
+}
+
+// finishAttempt remembers the targets syncing src with opts failed for, the ones p holds an up to date copy
+// in and the namespaces holding copies. None are remembered if the sync failed as a whole, so the next sync
+// writes every target.
+func (s *ConfigSyncer) finishAttempt(resource string, src metav1.Object, opts SyncOptions, syncErr error, p *syncProgress) {
+	a := &syncAttempt{
+		resourceVersion: sourceResourceVersion(src),
+		options:         optionsHash(opts),
+		ok:              syncErr == nil,
+	}
+	if general, perTarget := splitTargetErrors(syncErr); general == "" {
+		a.failed = sets.StringKeySet(perTarget)
+		a.succeeded = p.written.Difference(a.failed)
+		a.namespaces = p.namespaces
+	}
+	s.attempts.Store(statusKey(resource, src), a)
+}
+
+// optionsHash identifies sync options, targets written with other options are not up to date
+func optionsHash(opts SyncOptions) string {
+	data, err := json.Marshal(opts)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:16])
+}
+
+// lastSyncFailed checks whether the last sync of any version of src failed. If it is not known, e.g. after a
+// restart, the sync status of src is checked.
+func (s *ConfigSyncer) lastSyncFailed(resource string, src metav1.Object) bool {
+	if v, ok := s.attempts.Load(statusKey(resource, src)); ok {
+		return !v.(*syncAttempt).ok
+	}
+	if s.agent != nil {
+		return false
+	}
+	status, _ := GetSyncStatus(src.GetAnnotations())
+	return status != nil && (status.Error != "" || len(status.Errors) > 0)
+}
+
+// forgetAttempt forgets the last sync of a deleted source
+func (s *ConfigSyncer) forgetAttempt(resource string, src metav1.Object) {
+	s.attempts.Delete(statusKey(resource, src))
+}
+
+// written checks whether namespace of ctx holds a copy written by the attempt, it is false for a nil attempt
+func (a *syncAttempt) written(namespace, ctx string) bool {
+	return a != nil && a.succeeded.Has(targetKey(namespace, ctx))
+}
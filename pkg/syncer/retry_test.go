@@ -0,0 +1,318 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	api "kubeops.dev/config-syncer/apis/kubed/v1alpha1"
+
+	"github.com/pkg/errors"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestSplitTargetErrors(t *testing.T) {
+	quota := errors.New("exceeded quota")
+	tests := []struct {
+		name          string
+		err           error
+		wantGeneral   string
+		wantPerTarget map[string]string
+	}{
+		{name: "nil"},
+		{name: "general", err: errors.New("boom"), wantGeneral: "boom"},
+		{
+			name:          "namespace",
+			err:           &TargetError{Namespace: "a", Err: quota},
+			wantPerTarget: map[string]string{"a": "exceeded quota"},
+		},
+		{
+			name: "nested aggregates",
+			err: utilerrors.NewAggregate([]error{
+				errors.New("boom"),
+				utilerrors.NewAggregate([]error{
+					&TargetError{Namespace: "a", Err: quota},
+					&TargetError{Namespace: "b", Context: "east", Err: quota},
+				}),
+				&TargetError{Context: "west", Err: errors.New("unreachable")},
+				errors.New("bang"),
+			}),
+			wantGeneral: "boom; bang",
+			wantPerTarget: map[string]string{
+				"a":      "exceeded quota",
+				"east/b": "exceeded quota",
+				"west":   "unreachable",
+			},
+		},
+		{
+			name:          "wrapped",
+			err:           errors.Wrap(&TargetError{Namespace: "a", Err: quota}, "sync"),
+			wantPerTarget: map[string]string{"a": "exceeded quota"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			general, perTarget := splitTargetErrors(tt.err)
+			if general != tt.wantGeneral {
+				t.Errorf("general = %q, want %q", general, tt.wantGeneral)
+			}
+			if !reflect.DeepEqual(perTarget, tt.wantPerTarget) {
+				t.Errorf("perTarget = %v, want %v", perTarget, tt.wantPerTarget)
+			}
+		})
+	}
+}
+
+func TestRetryWritesFailedTargets(t *testing.T) {
+	src := &core.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "omni",
+			Namespace:       "demo",
+			ResourceVersion: "5",
+			Annotations:     map[string]string{ConfigSyncKey: ""},
+		},
+		Data: map[string]string{"k": "v"},
+	}
+	kc := fake.NewSimpleClientset(
+		&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "demo"}},
+		&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "a"}},
+		&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "b"}},
+		src,
+	)
+	failB := true
+	kc.PrependReactor("create", "configmaps", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		if failB && action.GetNamespace() == "b" {
+			return true, nil, errors.New("exceeded quota")
+		}
+		return false, nil, nil
+	})
+	// touched returns the namespaces a copy was read or written in since the last call
+	touched := func() map[string]bool {
+		out := map[string]bool{}
+		for _, action := range kc.Actions() {
+			if action.GetResource().Resource == "configmaps" && action.GetNamespace() != "" && action.GetVerb() != "list" {
+				out[action.GetNamespace()] = true
+			}
+		}
+		kc.ClearActions()
+		return out
+	}
+	sync := func(s *ConfigSyncer, src *core.ConfigMap) error {
+		return s.syncAndRecord(resourceConfigMaps, src, s.syncOptionsFor(api.SourceKindConfigMap, src), func(src object) error {
+			return s.SyncConfigMap(src.(*core.ConfigMap))
+		})
+	}
+
+	s := New(kc, nil, nil, record.NewFakeRecorder(100), Options{})
+	err := sync(s, src)
+	if _, perTarget := splitTargetErrors(err); len(perTarget) != 1 || perTarget["b"] == "" {
+		t.Fatalf("got error %v, want namespace b to fail", err)
+	}
+	if got := touched(); !got["a"] || !got["b"] {
+		t.Errorf("first sync touched %v, want a and b", got)
+	}
+
+	// retried as long as b fails, without a resync counter
+	for i := 0; i < 2; i++ {
+		if err := sync(s, src); err == nil {
+			t.Fatal("retry succeeded, want namespace b to fail")
+		}
+		if got := touched(); got["a"] || !got["b"] {
+			t.Errorf("retry %d touched %v, want b only", i, got)
+		}
+	}
+
+	// a restarted syncer reads the failed targets from the sync status
+	if err := s.updateConfigMapSyncStatus(src, err); err != nil {
+		t.Fatal(err)
+	}
+	synced, err := kc.CoreV1().ConfigMaps("demo").Get(context.TODO(), "omni", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	synced.ResourceVersion = "6" // written by the status patch
+	touched()
+	failB = false
+	restarted := New(kc, nil, nil, record.NewFakeRecorder(100), Options{})
+	if err := sync(restarted, synced); err != nil {
+		t.Fatal(err)
+	}
+	if got := touched(); got["a"] || !got["b"] {
+		t.Errorf("retry after restart touched %v, want b only", got)
+	}
+	if _, err := kc.CoreV1().ConfigMaps("b").Get(context.TODO(), "omni", metav1.GetOptions{}); err != nil {
+		t.Errorf("copy in namespace b not written: %v", err)
+	}
+
+	// once every target was written, the next sync writes all of them
+	touched()
+	if err := sync(restarted, synced); err != nil {
+		t.Fatal(err)
+	}
+	if got := touched(); !got["a"] || !got["b"] {
+		t.Errorf("sync after success touched %v, want a and b", got)
+	}
+}
+
+// targets added after a partial failure were never written, retries must write them as well
+func TestRetryWritesAddedTargets(t *testing.T) {
+	newSyncer := func(labels map[string]string) (*ConfigSyncer, *fake.Clientset, *bool) {
+		src := &core.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "omni", Namespace: "demo", ResourceVersion: "5"},
+			Data:       map[string]string{"k": "v"},
+		}
+		kc := fake.NewSimpleClientset(
+			&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "demo"}},
+			&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "a", Labels: map[string]string{"team": "x"}}},
+			&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "b", Labels: labels}},
+			&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "c", Labels: map[string]string{"team": "x"}}},
+			src,
+		)
+		failA := true
+		kc.PrependReactor("create", "configmaps", func(action clienttesting.Action) (bool, runtime.Object, error) {
+			if failA && action.GetNamespace() == "a" {
+				return true, nil, errors.New("exceeded quota")
+			}
+			return false, nil, nil
+		})
+		s := New(kc, nil, nil, record.NewFakeRecorder(100), Options{})
+		s.csIndexer = cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{ConfigSyncSourceIndex: ConfigSyncSourceIndexFunc})
+		return s, kc, &failA
+	}
+	sync := func(t *testing.T, s *ConfigSyncer, kc *fake.Clientset) error {
+		src, err := kc.CoreV1().ConfigMaps("demo").Get(context.TODO(), "omni", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		src.ResourceVersion = "5"
+		return s.syncAndRecord(resourceConfigMaps, src, s.syncOptionsFor(api.SourceKindConfigMap, src), func(src object) error {
+			return s.SyncConfigMap(src.(*core.ConfigMap))
+		})
+	}
+	check := func(t *testing.T, kc *fake.Clientset) {
+		for _, ns := range []string{"a", "b", "c"} {
+			if _, err := kc.CoreV1().ConfigMaps(ns).Get(context.TODO(), "omni", metav1.GetOptions{}); err != nil {
+				t.Errorf("copy in namespace %s not written: %v", ns, err)
+			}
+		}
+	}
+
+	t.Run("namespace added to the ConfigSync", func(t *testing.T) {
+		s, kc, failA := newSyncer(nil)
+		cs := newConfigSync("omni", api.SourceKindConfigMap, "omni")
+		cs.Spec.Namespaces = []string{"a", "c"}
+		if err := s.csIndexer.Add(cs); err != nil {
+			t.Fatal(err)
+		}
+		if err := sync(t, s, kc); err == nil {
+			t.Fatal("sync succeeded, want namespace a to fail")
+		}
+
+		*failA = false
+		cs = cs.DeepCopy()
+		cs.Spec.Namespaces = []string{"a", "b", "c"}
+		if err := s.csIndexer.Update(cs); err != nil {
+			t.Fatal(err)
+		}
+		if err := sync(t, s, kc); err != nil {
+			t.Fatal(err)
+		}
+		check(t, kc)
+	})
+
+	t.Run("namespace selected by its labels", func(t *testing.T) {
+		s, kc, failA := newSyncer(nil)
+		cs := newConfigSync("omni", api.SourceKindConfigMap, "omni")
+		cs.Spec.NamespaceSelector = &metav1.LabelSelector{MatchLabels: map[string]string{"team": "x"}}
+		if err := s.csIndexer.Add(cs); err != nil {
+			t.Fatal(err)
+		}
+		if err := sync(t, s, kc); err == nil {
+			t.Fatal("sync succeeded, want namespace a to fail")
+		}
+
+		*failA = false
+		ns, err := kc.CoreV1().Namespaces().Get(context.TODO(), "b", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ns.Labels = map[string]string{"team": "x"}
+		if _, err := kc.CoreV1().Namespaces().Update(context.TODO(), ns, metav1.UpdateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		kc.ClearActions()
+		if err := sync(t, s, kc); err != nil {
+			t.Fatal(err)
+		}
+		for _, action := range kc.Actions() {
+			if action.GetResource().Resource == "configmaps" && action.GetNamespace() == "c" && action.GetVerb() != "list" {
+				t.Errorf("retry touched the copy in namespace c written before: %v", action)
+			}
+		}
+		check(t, kc)
+	})
+
+	t.Run("options changed before a restart", func(t *testing.T) {
+		s, kc, failA := newSyncer(nil)
+		cs := newConfigSync("omni", api.SourceKindConfigMap, "omni")
+		cs.Spec.Namespaces = []string{"a", "c"}
+		if err := s.csIndexer.Add(cs); err != nil {
+			t.Fatal(err)
+		}
+		src, err := kc.CoreV1().ConfigMaps("demo").Get(context.TODO(), "omni", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = sync(t, s, kc)
+		if err == nil {
+			t.Fatal("sync succeeded, want namespace a to fail")
+		}
+		if err := s.updateConfigMapSyncStatus(src, err); err != nil {
+			t.Fatal(err)
+		}
+
+		*failA = false
+		restarted := New(kc, nil, nil, record.NewFakeRecorder(100), Options{})
+		restarted.csIndexer = cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{ConfigSyncSourceIndex: ConfigSyncSourceIndexFunc})
+		cs = cs.DeepCopy()
+		cs.Spec.ExcludeKeys = []string{"k"}
+		if err := restarted.csIndexer.Add(cs); err != nil {
+			t.Fatal(err)
+		}
+		if err := sync(t, restarted, kc); err != nil {
+			t.Fatal(err)
+		}
+		for _, ns := range []string{"a", "c"} {
+			cp, err := kc.CoreV1().ConfigMaps(ns).Get(context.TODO(), "omni", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, found := cp.Data["k"]; found {
+				t.Errorf("copy in namespace %s not written with the changed options", ns)
+			}
+		}
+	})
+}
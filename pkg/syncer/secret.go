@@ -17,133 +17,156 @@ limitations under the License.
 package syncer
 
 import (
-	context "context"
+	"context"
+	"fmt"
 
+	api "kubeops.dev/config-syncer/apis/kubed/v1alpha1"
 	"kubeops.dev/config-syncer/pkg/eventer"
 
-	"github.com/pkg/errors"
 	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
-	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/klog/v2"
+	kutil "kmodules.xyz/client-go"
 	core_util "kmodules.xyz/client-go/core/v1"
 )
 
-func (s *ConfigSyncer) SyncSecret(src *core.Secret) error {
-	opts := GetSyncOptions(src.Annotations)
+func (s *ConfigSyncer) reconcileSecret(key string) error {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
 
-	if opts.NamespaceSelector != nil { // delete that were in old-ns but not in new-ns and upsert to new-ns
-		newNs, err := NamespacesForSelector(s.kubeClient, *opts.NamespaceSelector)
-		if err != nil {
-			return err
-		}
-		klog.Infof("secret %s/%s will be synced into namespaces %v if needed", src.Namespace, src.Name, newNs.List())
-		if err := s.syncSecretIntoNamespaces(s.kubeClient, src, newNs, true, ""); err != nil {
-			return err
-		}
-	} else { // no sync, delete that were previously added
-		if err := s.syncSecretIntoNamespaces(s.kubeClient, src, sets.NewString(), true, ""); err != nil {
-			return err
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+	src, err := s.secretLister.Secrets(namespace).Get(name)
+	if s.agent != nil && (err == nil || kerr.IsNotFound(err)) {
+		return s.pullSecret(namespace, name, src)
+	}
+	if kerr.IsNotFound(err) {
+		klog.Infof("secret %s does not exist anymore", key)
+		deleteManagedCopies(resourceSecrets, namespace, name)
+		deleted := &core.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         namespace,
+				DeletionTimestamp: deletedAt(),
+			},
 		}
+		s.forgetAttempt(resourceSecrets, deleted)
+		err = s.SyncDeletedSecret(deleted)
+		return utilerrors.NewAggregate([]error{err, s.updateConfigSyncStatus(api.SourceKindSecret, namespace, name, nil, err)})
+	} else if err != nil {
+		return err
+	}
+	err = s.syncAndRecord(resourceSecrets, src, s.syncOptionsFor(api.SourceKindSecret, src), func(src object) error {
+		return s.SyncSecret(src.(*core.Secret))
+	})
+	return utilerrors.NewAggregate([]error{
+		err,
+		s.updateSecretSyncStatus(src, err),
+		s.updateConfigSyncStatus(api.SourceKindSecret, namespace, name, src, err),
+	})
+}
+
+func (s *ConfigSyncer) updateSecretSyncStatus(src *core.Secret, syncErr error) error {
+	namespaces := func() ([]string, error) {
+		return s.copyNamespaces(secretCopier{s}, src)
 	}
+	return s.updateSyncStatus(resourceSecrets, src, s.syncOptionsFor(api.SourceKindSecret, src), namespaces, syncErr, func(patch []byte) error {
+		_, err := s.kubeClient.CoreV1().Secrets(src.Namespace).Patch(context.TODO(), src.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+		return err
+	})
+}
 
-	return s.syncSecretIntoContexts(src, opts.Contexts)
+func (s *ConfigSyncer) SyncSecret(src *core.Secret) error {
+	return s.syncSource(secretCopier{s}, src)
 }
 
 // source deleted, delete that were previously added
 func (s *ConfigSyncer) SyncDeletedSecret(src *core.Secret) error {
-	if err := s.syncSecretIntoNamespaces(s.kubeClient, src, sets.NewString(), true, ""); err != nil {
-		return err
-	}
-	return s.syncSecretIntoContexts(src, sets.NewString())
+	return s.syncDeletedSource(secretCopier{s}, src)
 }
 
-func (s *ConfigSyncer) syncSecretIntoContexts(src *core.Secret, contexts sets.String) error {
-	// validate contexts specified via annotation
-	taken := map[string]struct{}{}
-	for _, ctx := range contexts.List() {
-		context, found := s.contexts[ctx]
-		if !found {
-			return errors.Errorf("context %s not found in kubeconfig file", ctx)
-		}
-		if _, found = taken[context.Address]; found {
-			return errors.Errorf("multiple contexts poniting same cluster")
-		}
-		taken[context.Address] = struct{}{}
-	}
+type secretCopier struct {
+	s *ConfigSyncer
+}
 
-	// sync to contexts specified via annotation, do not ignore errors here
-	for _, ctx := range contexts.List() {
-		context := s.contexts[ctx]
-		if context.Namespace == "" { // use source namespace if not specified via context
-			context.Namespace = src.Namespace
-		}
-		err := s.syncSecretIntoNamespaces(context.Client, src, sets.NewString(context.Namespace), false, ctx)
-		if err != nil {
-			return err
-		}
-	}
+func (c secretCopier) resource() string {
+	return resourceSecrets
+}
 
-	// delete from other contexts, ignore errors here
-	for ctxName, ctx := range s.contexts {
-		if _, found := taken[ctx.Address]; !found {
-			err := s.syncSecretIntoNamespaces(ctx.Client, src, sets.NewString(), false, ctxName)
-			if err != nil {
-				klog.Infoln(err)
-			}
-			taken[ctx.Address] = struct{}{} // to avoid deleting form same cluster twice
-		}
-	}
+func (c secretCopier) options(src metav1.Object) SyncOptions {
+	return c.s.syncOptionsFor(api.SourceKindSecret, src)
+}
 
-	return nil
+func (c secretCopier) source(namespace, name string) (object, error) {
+	if c.s.secretLister != nil {
+		return c.s.secretLister.Secrets(namespace).Get(name)
+	}
+	return c.s.kubeClient.CoreV1().Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
 }
 
-// upsert into newNs set, delete from (oldNs-newNs) set
-// use skipSrcNs = true for sync in source cluster
-func (s *ConfigSyncer) syncSecretIntoNamespaces(kc kubernetes.Interface, src *core.Secret, newNs sets.String, skipSrcNs bool, ctx string) error {
-	oldNs, err := namespaceSetForSecretSelector(kc, s.syncerLabelSelector(src.Name, src.Namespace, s.clusterName))
+func (c secretCopier) copies(src object, ctx, namespace string) ([]object, error) {
+	items, err := c.s.secretCopies(c.s.kubeClientFor(ctx), src.(*core.Secret), ctx, namespace)
 	if err != nil {
-		return err
-	}
-	oldNs = oldNs.Difference(newNs)
-	if skipSrcNs {
-		oldNs.Delete(src.Namespace)
-		newNs.Delete(src.Namespace)
-	}
-	for _, ns := range oldNs.List() {
-		if err := kc.CoreV1().Secrets(ns).Delete(context.TODO(), src.Name, metav1.DeleteOptions{}); err != nil {
-			return err
-		}
+		return nil, err
 	}
-	for _, ns := range newNs.List() {
-		if err = s.upsertSecret(kc, src, ns, ctx); err != nil {
-			return err
-		}
+	out := make([]object, len(items))
+	for i := range items {
+		out[i] = &items[i]
 	}
-	return nil
+	return out, nil
 }
 
-func (s *ConfigSyncer) syncSecretIntoNewNamespace(src *core.Secret, namespace *core.Namespace) error {
-	opts := GetSyncOptions(src.Annotations)
-	if opts.NamespaceSelector == nil {
-		return nil
+func (c secretCopier) list(cluster clusterContext, sel labels.Selector) ([]object, error) {
+	items, err := cluster.Client.CoreV1().Secrets(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: sel.String(),
+	})
+	if err != nil {
+		return nil, err
 	}
-	if selector, err := labels.Parse(*opts.NamespaceSelector); err != nil {
-		return err
-	} else if selector.Matches(labels.Set(namespace.Labels)) {
-		return s.upsertSecret(s.kubeClient, src, namespace.Name, "")
+	out := make([]object, len(items.Items))
+	for i := range items.Items {
+		out[i] = &items.Items[i]
 	}
-	return nil
+	return out, nil
+}
+
+func (c secretCopier) upsert(src object, namespace, ctx string) error {
+	return c.s.upsertSecret(c.s.kubeClientFor(ctx), src.(*core.Secret), namespace, ctx)
+}
+
+func (c secretCopier) delete(cluster clusterContext, obj object) error {
+	return cluster.Client.CoreV1().Secrets(obj.GetNamespace()).Delete(context.TODO(), obj.GetName(), metav1.DeleteOptions{})
 }
 
 func (s *ConfigSyncer) upsertSecret(kc kubernetes.Interface, src *core.Secret, namespace, ctx string) error {
+	opts := s.syncOptionsFor(api.SourceKindSecret, src)
+	desired := secretCopy(src, opts)
 	meta := metav1.ObjectMeta{
-		Name:      src.Name,
+		Name:      opts.CopyName(src.Name, ctx),
 		Namespace: namespace,
 	}
-	_, _, err := core_util.CreateOrPatchSecret(context.TODO(), kc, meta, func(obj *core.Secret) *core.Secret {
+	skipped, retyped := false, false
+	mutate := func(obj *core.Secret) *core.Secret {
+		if obj.UID != "" { // exists
+			if skipped = !s.resolveConflict(src, obj, opts, secretMatches(obj, desired), namespace, ctx); skipped {
+				return obj
+			}
+		}
+		// the type of a Secret can not be changed, the copy is created again
+		if obj.UID != "" && obj.Type != desired.Type {
+			retyped = true
+			return obj
+		}
+
 		// check origin cluster, if not match overwrite and create an event
 		if v, ok := obj.Labels[OriginClusterLabelKey]; ok && v != s.clusterName {
 			s.recorder.Eventf(
@@ -154,37 +177,89 @@ func (s *ConfigSyncer) upsertSecret(kc kubernetes.Interface, src *core.Secret, n
 			)
 		}
 
-		obj.Type = src.Type
-		obj.Data = src.Data
-		obj.Labels = labels.Merge(src.Labels, s.syncerLabels(src.Name, src.Namespace, s.clusterName))
+		obj.Type = desired.Type
+		obj.Data = desired.Data
 		obj.Kind = src.Kind
+		s.setCopyMeta(obj, src, originRef(src))
 
-		ref := core.ObjectReference{
-			APIVersion:      src.APIVersion,
-			Kind:            src.Kind,
-			Name:            src.Name,
-			Namespace:       src.Namespace,
-			UID:             src.UID,
-			ResourceVersion: src.ResourceVersion,
+		return obj
+	}
+	out, verb, err := core_util.CreateOrPatchSecret(context.TODO(), kc, meta, mutate, metav1.PatchOptions{})
+	if err == nil && retyped {
+		retyped = false
+		if out, verb, err = s.recreateSecret(kc, out, meta, mutate); err == nil && retyped {
+			err = fmt.Errorf("secret %s/%s still has type %s after it was deleted", out.Namespace, out.Name, out.Type)
 		}
-		obj.Annotations = s.syncerAnnotations(obj.Annotations, src.Annotations, ref)
+	}
+	if err != nil {
+		return err
+	} else if skipped {
+		return errConflictSkipped
+	}
+	s.recordCopyWritten(src, out, verb, ctx)
+	return nil
+}
 
-		return obj
-	}, metav1.PatchOptions{})
+// recreateSecret deletes the Secret cur and creates it again with mutate
+func (s *ConfigSyncer) recreateSecret(kc kubernetes.Interface, cur *core.Secret, meta metav1.ObjectMeta, mutate func(*core.Secret) *core.Secret) (*core.Secret, kutil.VerbType, error) {
+	err := kc.CoreV1().Secrets(cur.Namespace).Delete(context.TODO(), cur.Name, metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{UID: &cur.UID},
+	})
+	if err != nil && !kerr.IsNotFound(err) {
+		return nil, kutil.VerbUnchanged, err
+	}
+	return core_util.CreateOrPatchSecret(context.TODO(), kc, meta, mutate, metav1.PatchOptions{})
+}
+
+// secretCopy returns a Secret holding the type and data of a copy of src
+func secretCopy(src *core.Secret, opts SyncOptions) *core.Secret {
+	data := opts.selectByteData(src.Data)
+	return &core.Secret{
+		Type: copyType(src.Type, data),
+		Data: data,
+	}
+}
 
-	return err
+// secretMatches tells whether cur already holds the type and data of desired
+func secretMatches(cur, desired *core.Secret) bool {
+	return cur.Type == desired.Type && equality.Semantic.DeepEqual(cur.Data, desired.Data)
 }
 
-func namespaceSetForSecretSelector(kc kubernetes.Interface, selector string) (sets.String, error) {
-	secret, err := kc.CoreV1().Secrets(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{
+// requiredKeys are the data keys Secrets of a type must have. Secrets of type kubernetes.io/basic-auth
+// need any of their keys.
+var requiredKeys = map[core.SecretType][]string{
+	core.SecretTypeTLS:              {core.TLSCertKey, core.TLSPrivateKeyKey},
+	core.SecretTypeDockercfg:        {core.DockerConfigKey},
+	core.SecretTypeDockerConfigJson: {core.DockerConfigJsonKey},
+	core.SecretTypeSSHAuth:          {core.SSHAuthPrivateKey},
+	core.SecretTypeBasicAuth:        {core.BasicAuthUsernameKey, core.BasicAuthPasswordKey},
+}
+
+// copyType returns the type of a copy of a Secret of type typ holding data. Copies lacking keys their
+// type requires, as the keys were filtered, would be rejected by the API server, so they are Opaque.
+func copyType(typ core.SecretType, data map[string][]byte) core.SecretType {
+	keys, found := requiredKeys[typ]
+	if !found {
+		return typ
+	}
+	missing := 0
+	for _, k := range keys {
+		if _, ok := data[k]; !ok {
+			missing++
+		}
+	}
+	if missing == 0 || (typ == core.SecretTypeBasicAuth && missing < len(keys)) {
+		return typ
+	}
+	return core.SecretTypeOpaque
+}
+
+func secretForSelector(kc kubernetes.Interface, selector string) ([]core.Secret, error) {
+	copies, err := kc.CoreV1().Secrets(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{
 		LabelSelector: selector,
 	})
 	if err != nil {
 		return nil, err
 	}
-	ns := sets.NewString()
-	for _, obj := range secret.Items {
-		ns.Insert(obj.Namespace)
-	}
-	return ns, nil
+	return copies.Items, nil
 }
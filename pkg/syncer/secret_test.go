@@ -0,0 +1,182 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"kubeops.dev/config-syncer/pkg/eventer"
+
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestSyncTypedSecret(t *testing.T) {
+	tests := []struct {
+		name     string
+		keys     string
+		wantType core.SecretType
+		wantKeys []string
+	}{
+		{name: "every key", wantType: core.SecretTypeTLS, wantKeys: []string{"ca.crt", "tls.crt", "tls.key"}},
+		{name: "required keys", keys: "tls.*", wantType: core.SecretTypeTLS, wantKeys: []string{"tls.crt", "tls.key"}},
+		{name: "required keys filtered", keys: "ca.crt", wantType: core.SecretTypeOpaque, wantKeys: []string{"ca.crt"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := &core.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "tls-certs",
+					Namespace:   "demo",
+					Annotations: map[string]string{ConfigSyncKey: ""},
+				},
+				Type: core.SecretTypeTLS,
+				Data: map[string][]byte{"ca.crt": []byte("ca"), "tls.crt": []byte("crt"), "tls.key": []byte("key")},
+			}
+			if tt.keys != "" {
+				src.Annotations[ConfigSyncIncludeKeys] = tt.keys
+			}
+			kc := fake.NewSimpleClientset(
+				&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "demo"}},
+				&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "a"}},
+				src,
+			)
+			s := New(kc, nil, nil, record.NewFakeRecorder(10), Options{})
+			if err := s.SyncSecret(src); err != nil {
+				t.Fatal(err)
+			}
+			out, err := kc.CoreV1().Secrets("a").Get(context.TODO(), "tls-certs", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.Type != tt.wantType {
+				t.Errorf("type = %s, want %s", out.Type, tt.wantType)
+			}
+			var keys []string
+			for _, k := range []string{"ca.crt", "tls.crt", "tls.key"} {
+				if _, ok := out.Data[k]; ok {
+					keys = append(keys, k)
+				}
+			}
+			if !reflect.DeepEqual(keys, tt.wantKeys) {
+				t.Errorf("keys = %v, want %v", keys, tt.wantKeys)
+			}
+		})
+	}
+}
+
+func TestSyncRetypedSecret(t *testing.T) {
+	src := &core.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "tls-certs",
+			Namespace:   "demo",
+			Annotations: map[string]string{ConfigSyncKey: ""},
+		},
+		Type: core.SecretTypeTLS,
+		Data: map[string][]byte{"ca.crt": []byte("ca"), "tls.crt": []byte("crt"), "tls.key": []byte("key")},
+	}
+	kc := fake.NewSimpleClientset(
+		&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "demo"}},
+		&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "a"}},
+		src,
+	)
+	// the fake client does not set UIDs, the API server does
+	kc.PrependReactor("create", "secrets", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		obj := action.(clienttesting.CreateAction).GetObject().(*core.Secret)
+		obj.UID = types.UID(obj.Namespace + "/" + obj.Name)
+		return false, nil, nil
+	})
+	// the API server refuses to change the type of a Secret
+	kc.PrependReactor("patch", "secrets", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		if strings.Contains(string(action.(clienttesting.PatchAction).GetPatch()), `"type"`) {
+			return true, nil, kerr.NewInvalid(core.SchemeGroupVersion.WithKind("Secret").GroupKind(), action.(clienttesting.PatchAction).GetName(), nil)
+		}
+		return false, nil, nil
+	})
+	s := New(kc, nil, nil, record.NewFakeRecorder(10), Options{})
+	if err := s.SyncSecret(src); err != nil {
+		t.Fatal(err)
+	}
+	old, err := kc.CoreV1().Secrets("a").Get(context.TODO(), "tls-certs", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if old.Type != core.SecretTypeTLS {
+		t.Fatalf("type = %s, want %s", old.Type, core.SecretTypeTLS)
+	}
+
+	src = src.DeepCopy()
+	src.ResourceVersion = "2"
+	src.Annotations[ConfigSyncIncludeKeys] = "ca.crt"
+	if err := s.SyncSecret(src); err != nil {
+		t.Fatal(err)
+	}
+	out, err := kc.CoreV1().Secrets("a").Get(context.TODO(), "tls-certs", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Type != core.SecretTypeOpaque {
+		t.Errorf("type = %s, want %s", out.Type, core.SecretTypeOpaque)
+	}
+	if !reflect.DeepEqual(out.Data, map[string][]byte{"ca.crt": []byte("ca")}) {
+		t.Errorf("data = %v, want only ca.crt", out.Data)
+	}
+}
+
+func TestSyncRefusesInvalidKeyPatterns(t *testing.T) {
+	src := &core.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "creds",
+			Namespace: "demo",
+			Annotations: map[string]string{
+				ConfigSyncKey:         "",
+				ConfigSyncExcludeKeys: "password, token[",
+			},
+		},
+		Data: map[string][]byte{"user": []byte("u"), "password": []byte("p"), "token": []byte("t")},
+	}
+	kc := fake.NewSimpleClientset(
+		&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "demo"}},
+		&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "a"}},
+		src,
+	)
+	recorder := record.NewFakeRecorder(10)
+	s := New(kc, nil, nil, recorder, Options{})
+	if err := s.SyncSecret(src); err == nil {
+		t.Fatal("sync succeeded, want the invalid pattern refused")
+	}
+	if _, err := kc.CoreV1().Secrets("a").Get(context.TODO(), "creds", metav1.GetOptions{}); !kerr.IsNotFound(err) {
+		t.Errorf("copy written despite the invalid pattern: %v", err)
+	}
+	close(recorder.Events)
+	found := false
+	for e := range recorder.Events {
+		found = found || strings.Fields(e)[1] == eventer.EventReasonInvalidKeyPattern
+	}
+	if !found {
+		t.Errorf("no %s event recorded", eventer.EventReasonInvalidKeyPattern)
+	}
+}
@@ -0,0 +1,262 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"github.com/pkg/errors"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// SyncStatus is recorded as JSON in the SyncStatusKey annotation of a synced source
+type SyncStatus struct {
+	// resourceVersion of the source when it was last synced
+	ObservedResourceVersion string `json:"observedResourceVersion,omitempty"`
+	// hash of the content of the source at the observed resourceVersion
+	SourceHash string `json:"sourceHash,omitempty"`
+	// hash of the sync options the source was synced with
+	OptionsHash string `json:"optionsHash,omitempty"`
+	// time of the last sync without errors that changed the status
+	LastSyncTime *metav1.Time `json:"lastSyncTime,omitempty"`
+	// namespaces of the source cluster holding copies
+	Namespaces []string `json:"namespaces,omitempty"`
+	// contexts holding copies as of the last sync without errors
+	Contexts []string `json:"contexts,omitempty"`
+	// error of the last sync not bound to a single target
+	Error string `json:"error,omitempty"`
+	// errors of the last sync per target, keyed by namespace or context/namespace
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// GetSyncStatus reads the sync status recorded on a source. It returns nil if there is none.
+func GetSyncStatus(annotations map[string]string) (*SyncStatus, error) {
+	v, ok := annotations[SyncStatusKey]
+	if !ok {
+		return nil, nil
+	}
+	var status SyncStatus
+	if err := json.Unmarshal([]byte(v), &status); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %s annotation", SyncStatusKey)
+	}
+	return &status, nil
+}
+
+// TargetError is the error of syncing a source into a single target namespace.
+// Namespace is empty if the context itself is unusable, Context is empty for the source cluster.
+type TargetError struct {
+	Namespace string
+	Context   string
+	Err       error
+}
+
+func (e *TargetError) Error() string {
+	if e.Namespace == "" {
+		return "context " + e.Context + ": " + e.Err.Error()
+	}
+	return targetString(e.Namespace, e.Context) + ": " + e.Err.Error()
+}
+
+func (e *TargetError) Unwrap() error {
+	return e.Err
+}
+
+// Target returns the key of the target in SyncStatus.Errors
+func (e *TargetError) Target() string {
+	return targetKey(e.Namespace, e.Context)
+}
+
+func targetKey(namespace, ctx string) string {
+	switch {
+	case ctx == "":
+		return namespace
+	case namespace == "":
+		return ctx
+	}
+	return ctx + "/" + namespace
+}
+
+// splitTargetErrors separates errors of single targets from other errors
+func splitTargetErrors(err error) (string, map[string]string) {
+	var errs []error
+	if err == nil {
+		return "", nil
+	} else if agg, ok := err.(utilerrors.Aggregate); ok {
+		errs = utilerrors.Flatten(agg).Errors()
+	} else {
+		errs = []error{err}
+	}
+
+	var general []string
+	var perTarget map[string]string
+	for _, e := range errs {
+		var te *TargetError
+		if errors.As(e, &te) {
+			if perTarget == nil {
+				perTarget = map[string]string{}
+			}
+			perTarget[te.Target()] = te.Err.Error()
+		} else {
+			general = append(general, e.Error())
+		}
+	}
+	return strings.Join(general, "; "), perTarget
+}
+
+// sourceResourceVersion returns the resourceVersion of src recorded in its copies and status. Writing the status
+// changes the resourceVersion of the source, so if the content of src did not change since the status was written,
+// the observed one is returned. Otherwise copies would be rewritten and the status recorded again on every sync.
+func sourceResourceVersion(src metav1.Object) string {
+	if status, _ := GetSyncStatus(src.GetAnnotations()); status != nil && status.ObservedResourceVersion != "" &&
+		status.SourceHash != "" && status.SourceHash == sourceHash(src) {
+		return status.ObservedResourceVersion
+	}
+	return src.GetResourceVersion()
+}
+
+// sourceHash hashes the content of src, its labels, annotations but the sync status and every field
+// but metadata and status
+func sourceHash(src metav1.Object) string {
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(src)
+	if err != nil {
+		return ""
+	}
+	content := map[string]interface{}{}
+	for k, v := range obj {
+		switch k {
+		case "apiVersion", "kind", "metadata", "status":
+		default:
+			content[k] = v
+		}
+	}
+	annotations := make(map[string]string, len(src.GetAnnotations()))
+	for k, v := range src.GetAnnotations() {
+		if k != SyncStatusKey {
+			annotations[k] = v
+		}
+	}
+	content["labels"] = src.GetLabels()
+	content["annotations"] = annotations
+
+	data, err := json.Marshal(content)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:16])
+}
+
+func statusKey(resource string, src metav1.Object) string {
+	return resource + "/" + src.GetNamespace() + "/" + src.GetName()
+}
+
+// updateSyncStatus records the outcome of syncing src in its status annotation and the managed copies metric.
+// namespaces lists the namespaces of the source cluster holding copies, patch applies a merge patch to the source.
+func (s *ConfigSyncer) updateSyncStatus(resource string, src metav1.Object, opts SyncOptions, namespaces func() ([]string, error), syncErr error, patch func([]byte) error) error {
+	cur, found := src.GetAnnotations()[SyncStatusKey]
+
+	var value *string
+	if opts.syncsNamespaces() || opts.Contexts.Len() > 0 {
+		prev, _ := GetSyncStatus(src.GetAnnotations())
+		if prev == nil {
+			prev = &SyncStatus{}
+		}
+		ns, err := namespaces()
+		if err != nil {
+			return err
+		}
+		status := SyncStatus{
+			ObservedResourceVersion: sourceResourceVersion(src),
+			SourceHash:              sourceHash(src),
+			OptionsHash:             optionsHash(opts),
+			LastSyncTime:            prev.LastSyncTime,
+			Namespaces:              ns,
+			Contexts:                prev.Contexts,
+		}
+		if syncErr == nil {
+			status.Contexts = opts.Contexts.List()
+		} else {
+			status.Error, status.Errors = splitTargetErrors(syncErr)
+		}
+		setManagedCopies(resource, src.GetNamespace(), src.GetName(), len(status.Namespaces)+len(status.Contexts))
+
+		data, err := json.Marshal(status)
+		if err != nil {
+			return err
+		}
+		if found && string(data) == cur {
+			return nil // only bump the sync time if anything else changed
+		}
+		if syncErr == nil {
+			now := metav1.Now()
+			status.LastSyncTime = &now
+			if data, err = json.Marshal(status); err != nil {
+				return err
+			}
+		}
+		v := string(data)
+		value = &v
+	} else {
+		deleteManagedCopies(resource, src.GetNamespace(), src.GetName())
+		if !found {
+			return nil // not synced, nothing to clean up
+		}
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]*string{
+				SyncStatusKey: value, // nil removes the annotation
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if err := patch(data); err != nil && !kerr.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// annotationsChanged compares the annotations of two versions of a source, ignoring the sync status
+func annotationsChanged(old, nu map[string]string) bool {
+	if len(old) == 0 && len(nu) == 0 {
+		return false
+	}
+	oldCopy := make(map[string]string, len(old))
+	for k, v := range old {
+		if k != SyncStatusKey {
+			oldCopy[k] = v
+		}
+	}
+	for k, v := range nu {
+		if k == SyncStatusKey {
+			continue
+		}
+		if ov, ok := oldCopy[k]; !ok || ov != v {
+			return true
+		}
+		delete(oldCopy, k)
+	}
+	return len(oldCopy) > 0
+}
@@ -0,0 +1,214 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	api "kubeops.dev/config-syncer/apis/kubed/v1alpha1"
+
+	"github.com/pkg/errors"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestSourceResourceVersion(t *testing.T) {
+	src := &core.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "omni",
+			Namespace:       "demo",
+			ResourceVersion: "5",
+			Annotations:     map[string]string{ConfigSyncKey: ""},
+		},
+		Data: map[string]string{"k": "v"},
+	}
+	kc := fake.NewSimpleClientset(src)
+	s := New(kc, nil, nil, record.NewFakeRecorder(10), Options{})
+
+	if err := s.updateConfigMapSyncStatus(src, nil); err != nil {
+		t.Fatal(err)
+	}
+	synced, err := kc.CoreV1().ConfigMaps("demo").Get(context.TODO(), "omni", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, found := synced.Annotations[SyncStatusKey]; !found {
+		t.Fatal("sync status not recorded")
+	}
+	synced.ResourceVersion = "6" // written by the status patch
+
+	if rv := sourceResourceVersion(synced); rv != "5" {
+		t.Errorf("after writing the status got resourceVersion %s, want observed 5", rv)
+	}
+
+	// the status is not rewritten, its content only depends on the persisted status
+	kc.ClearActions()
+	if err := s.updateConfigMapSyncStatus(synced, nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, action := range kc.Actions() {
+		if action.GetVerb() == "patch" {
+			t.Error("status rewritten, want it unchanged")
+		}
+	}
+
+	changed := synced.DeepCopy()
+	changed.ResourceVersion = "7"
+	changed.Data["k"] = "other"
+	if rv := sourceResourceVersion(changed); rv != "7" {
+		t.Errorf("after changing the data got resourceVersion %s, want 7", rv)
+	}
+	changed = synced.DeepCopy()
+	changed.ResourceVersion = "7"
+	changed.Annotations[ConfigSyncKey] = "team=a"
+	if rv := sourceResourceVersion(changed); rv != "7" {
+		t.Errorf("after changing the annotations got resourceVersion %s, want 7", rv)
+	}
+}
+
+func TestCopyNamespaces(t *testing.T) {
+	src := &core.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "omni",
+			Namespace:       "demo",
+			ResourceVersion: "5",
+			Annotations:     map[string]string{ConfigSyncKey: ""},
+		},
+		Data: map[string]string{"k": "v"},
+	}
+	kc := fake.NewSimpleClientset(
+		&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "demo"}},
+		&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "a"}},
+		&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "b"}},
+		&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "c"}},
+		src,
+	)
+	failB := false
+	kc.PrependReactor("*", "configmaps", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		if failB && action.GetNamespace() == "b" && (action.GetVerb() == "create" || action.GetVerb() == "patch") {
+			return true, nil, errors.New("exceeded quota")
+		}
+		return false, nil, nil
+	})
+	s := New(kc, nil, nil, record.NewFakeRecorder(100), Options{})
+	sync := func(src *core.ConfigMap) error {
+		return s.syncAndRecord(resourceConfigMaps, src, s.syncOptionsFor(api.SourceKindConfigMap, src), func(src object) error {
+			return s.SyncConfigMap(src.(*core.ConfigMap))
+		})
+	}
+	if err := sync(src); err != nil {
+		t.Fatal(err)
+	}
+
+	// b keeps the copy of the first sync
+	failB = true
+	changed := src.DeepCopy()
+	changed.ResourceVersion = "6"
+	changed.Data["k"] = "other"
+	if err := sync(changed); err == nil {
+		t.Fatal("sync succeeded, want namespace b to fail")
+	}
+	kc.ClearActions()
+	got, err := s.copyNamespaces(configMapCopier{s}, changed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("copyNamespaces() = %v, want %v", got, want)
+	}
+	if len(kc.Actions()) > 0 {
+		t.Errorf("copyNamespaces() called the API server: %v", kc.Actions())
+	}
+}
+
+func TestSyncStatusSkippedConflict(t *testing.T) {
+	src := &core.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "omni",
+			Namespace:       "demo",
+			ResourceVersion: "5",
+			Annotations:     map[string]string{ConfigSyncKey: ""},
+		},
+		Data: map[string]string{"k": "v"},
+	}
+	kc := fake.NewSimpleClientset(
+		&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "demo"}},
+		&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "a"}},
+		&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "b"}},
+		&core.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "omni", Namespace: "b", UID: "theirs"},
+			Data:       map[string]string{"k": "theirs"},
+		},
+		src,
+	)
+	s := New(kc, nil, nil, record.NewFakeRecorder(100), Options{ConflictPolicy: ConflictPolicySkip})
+	err := s.syncAndRecord(resourceConfigMaps, src, s.syncOptionsFor(api.SourceKindConfigMap, src), func(src object) error {
+		return s.SyncConfigMap(src.(*core.ConfigMap))
+	})
+	if err == nil {
+		t.Fatal("sync succeeded, want the conflict in namespace b reported")
+	}
+	if err := s.updateConfigMapSyncStatus(src, err); err != nil {
+		t.Fatal(err)
+	}
+	synced, err := kc.CoreV1().ConfigMaps("demo").Get(context.TODO(), "omni", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err := GetSyncStatus(synced.Annotations)
+	if err != nil || status == nil {
+		t.Fatalf("got sync status %v, %v", status, err)
+	}
+	if want := []string{"a"}; !reflect.DeepEqual(status.Namespaces, want) {
+		t.Errorf("namespaces = %v, want %v", status.Namespaces, want)
+	}
+	if len(status.Errors) != 1 || status.Errors["b"] == "" {
+		t.Errorf("errors = %v, want one for namespace b", status.Errors)
+	}
+}
+
+func TestAnnotationsChanged(t *testing.T) {
+	tests := []struct {
+		name string
+		old  map[string]string
+		nu   map[string]string
+		want bool
+	}{
+		{name: "both empty", want: false},
+		{name: "nil and empty", old: nil, nu: map[string]string{}, want: false},
+		{name: "equal", old: map[string]string{"a": "1"}, nu: map[string]string{"a": "1"}, want: false},
+		{name: "value changed", old: map[string]string{"a": "1"}, nu: map[string]string{"a": "2"}, want: true},
+		{name: "added", old: nil, nu: map[string]string{"a": "1"}, want: true},
+		{name: "removed", old: map[string]string{"a": "1"}, nu: nil, want: true},
+		{name: "status added", old: nil, nu: map[string]string{SyncStatusKey: "{}"}, want: false},
+		{name: "status changed", old: map[string]string{"a": "1", SyncStatusKey: "{}"}, nu: map[string]string{"a": "1", SyncStatusKey: `{"error":"x"}`}, want: false},
+		{name: "status removed with other change", old: map[string]string{SyncStatusKey: "{}"}, nu: map[string]string{"a": "1"}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := annotationsChanged(tt.old, tt.nu); got != tt.want {
+				t.Errorf("annotationsChanged() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -17,19 +17,29 @@ limitations under the License.
 package syncer
 
 import (
-	"context"
-	"net/url"
 	"sync"
+	"time"
+
+	api "kubeops.dev/config-syncer/apis/kubed/v1alpha1"
+	kubed_cs "kubeops.dev/config-syncer/client/clientset/versioned"
+	kubed_listers "kubeops.dev/config-syncer/client/listers/kubed/v1alpha1"
 
 	jsoniter "github.com/json-iterator/go"
 	"github.com/pkg/errors"
 	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/tools/clientcmd"
+	core_listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
-	clientcmd_util "kmodules.xyz/client-go/tools/clientcmd"
+	"kmodules.xyz/client-go/tools/queue"
 )
 
 var json = jsoniter.ConfigCompatibleWithStandardLibrary
@@ -39,107 +49,288 @@ const (
 	ConfigOriginKey    = "kubed.appscode.com/origin"
 	ConfigSyncContexts = "kubed.appscode.com/sync-contexts"
 
+	// comma separated glob patterns of data keys copied into targets
+	ConfigSyncIncludeKeys = "kubed.appscode.com/sync-keys"
+	ConfigSyncExcludeKeys = "kubed.appscode.com/sync-exclude-keys"
+
+	// name of the copies, comma separated context=name pairs override the name per context
+	ConfigSyncName         = "kubed.appscode.com/sync-name"
+	ConfigSyncContextNames = "kubed.appscode.com/sync-context-names"
+	ConfigSyncNamePrefix   = "kubed.appscode.com/sync-name-prefix"
+	ConfigSyncNameSuffix   = "kubed.appscode.com/sync-name-suffix"
+
+	// namespace selector evaluated in the clusters of all contexts, and semicolon separated
+	// context=selector pairs overriding it per context
+	ConfigSyncContextSelector  = "kubed.appscode.com/sync-context-selector"
+	ConfigSyncContextSelectors = "kubed.appscode.com/sync-context-selectors"
+
+	// selects the clusters of agents pulling the source by their cluster labels, "true" selects every agent
+	ConfigSyncClusterSelector = "kubed.appscode.com/sync-cluster-selector"
+
+	// render ConfigMap values as Go templates for each target namespace
+	ConfigSyncTemplate = "kubed.appscode.com/sync-template"
+
+	// how to handle objects in the target namespace that are not copies of the source
+	ConfigSyncConflictPolicy = "kubed.appscode.com/sync-conflict-policy"
+
+	// create missing target namespaces in other clusters, with comma separated key=value labels
+	ConfigSyncCreateNamespace = "kubed.appscode.com/sync-create-namespace"
+	ConfigSyncNamespaceLabels = "kubed.appscode.com/sync-namespace-labels"
+	ConfigSyncPruneNamespace  = "kubed.appscode.com/sync-prune-namespace"
+
+	// JSON encoded SyncStatus written by config-syncer on synced sources
+	SyncStatusKey = "kubed.appscode.com/sync-status"
+
+	// annotations on target namespaces
+	NamespaceSyncOptOutKey = "kubed.appscode.com/sync-opt-out"
+	NamespaceSyncAllowKey  = "kubed.appscode.com/sync-allow"
+	NamespaceSyncDenyKey   = "kubed.appscode.com/sync-deny"
+
+	// annotations on namespaces created by config-syncer
+	NamespaceCreatedByKey = "kubed.appscode.com/created-by"
+	NamespacePruneKey     = "kubed.appscode.com/prune"
+
 	OriginNameLabelKey      = "kubed.appscode.com/origin.name"
 	OriginNamespaceLabelKey = "kubed.appscode.com/origin.namespace"
 	OriginClusterLabelKey   = "kubed.appscode.com/origin.cluster"
+
+	// ID of the source cluster, recorded in an annotation of copies
+	OriginClusterIDKey = "kubed.appscode.com/origin.cluster-id"
 )
 
 type ConfigSyncer struct {
-	kubeClient kubernetes.Interface
-	recorder   record.EventRecorder
+	kubeClient    kubernetes.Interface
+	dynamicClient dynamic.Interface
+	kubedClient   kubed_cs.Interface
+	recorder      record.EventRecorder
+
+	cmLister      core_listers.ConfigMapLister
+	cmIndexer     cache.Indexer
+	secretLister  core_listers.SecretLister
+	secretIndexer cache.Indexer
+	nsLister      core_listers.NamespaceLister
+	csIndexer     cache.Indexer
+
+	cmQueue     *queue.Worker
+	secretQueue *queue.Worker
+	nsQueue     *queue.Worker
+
+	// other kinds of resources synced via the dynamic client
+	resources map[schema.GroupVersionResource]*resourceSyncer
+
+	conflictPolicy ConflictPolicy
+	// how often sources selecting namespaces of other clusters are synced again
+	resyncPeriod time.Duration
+	// namespace watched for sources, all namespaces if empty
+	sourceNamespace string
+	// bounds the copies written in parallel
+	fanOut *fanOut
+
+	// last *syncAttempt of every synced source
+	attempts sync.Map
+	// *syncProgress of the running syncs, keyed by the synced copy of the source
+	running sync.Map
 
 	clusterName string
-	contexts    map[string]clusterContext
-	lock        sync.RWMutex
+	// UID of the kube-system namespace of the source cluster
+	clusterID string
+	// IDs of the clusters of contexts, keyed by their kubernetes.Interface
+	clusterIDs     sync.Map
+	kubeconfigFile string
+	// sha256 of the kubeconfig file the contexts were loaded from
+	kubeconfigHash string
+	fileContexts   map[string]clusterContext
+	// clusters registered via RemoteClusters in the operator namespace, keyed by name
+	remoteClusters map[string]remoteCluster
+	rcLister       kubed_listers.RemoteClusterLister
+	rcSecretLister core_listers.SecretLister
+	rcQueue        *queue.Worker
+	// contexts of the kubeconfig file and RemoteClusters, or the cluster of the agent
+	contexts map[string]clusterContext
+	// set if running as an agent that pulls sources from a hub cluster
+	agent *agentConfig
+	lock  sync.RWMutex
+}
+
+type Options struct {
+	MaxNumRequeues int
+	NumThreads     int
+
+	// used for sources without the conflict policy annotation
+	ConflictPolicy ConflictPolicy
+
+	// resources synced in addition to ConfigMaps and Secrets
+	Resources []ResourceRule
+
+	// how often sources selecting namespaces inside the clusters of contexts are synced again,
+	// to pick up namespaces changed there. If zero, they are synced when they change only.
+	ContextNamespaceResyncPeriod time.Duration
+
+	// how many copies are written in parallel, in total and into each cluster.
+	// If zero, DefaultMaxParallelWrites and DefaultMaxParallelWritesPerCluster are used.
+	MaxParallelWrites           int
+	MaxParallelWritesPerCluster int
+
+	// namespace the informers of sources are restricted to, all namespaces if empty.
+	// Copies are only looked up in the informer caches if all namespaces are watched.
+	SourceNamespace string
+}
+
+func New(kc kubernetes.Interface, dc dynamic.Interface, kubedClient kubed_cs.Interface, recorder record.EventRecorder, opts Options) *ConfigSyncer {
+	RegisterMetrics()
+
+	s := &ConfigSyncer{
+		kubeClient:      kc,
+		dynamicClient:   dc,
+		kubedClient:     kubedClient,
+		recorder:        recorder,
+		conflictPolicy:  opts.ConflictPolicy,
+		resyncPeriod:    opts.ContextNamespaceResyncPeriod,
+		sourceNamespace: opts.SourceNamespace,
+		fanOut:          newFanOut(opts.MaxParallelWrites, opts.MaxParallelWritesPerCluster),
+		resources:       map[schema.GroupVersionResource]*resourceSyncer{},
+	}
+	if s.conflictPolicy == "" {
+		s.conflictPolicy = ConflictPolicyOverwrite
+	}
+	s.cmQueue = queue.New("ConfigMap", opts.MaxNumRequeues, opts.NumThreads, s.reconcileConfigMap)
+	s.secretQueue = queue.New("Secret", opts.MaxNumRequeues, opts.NumThreads, s.reconcileSecret)
+	s.nsQueue = queue.New("Namespace", opts.MaxNumRequeues, opts.NumThreads, s.reconcileNamespace)
+	s.rcQueue = queue.New("RemoteCluster", opts.MaxNumRequeues, 1, s.reconcileRemoteCluster)
+	for _, rule := range opts.Resources {
+		rs := &resourceSyncer{ResourceRule: rule}
+		rs.queue = queue.New(rule.GVR.Resource, opts.MaxNumRequeues, opts.NumThreads, func(key string) error {
+			return s.reconcileResource(rs, key)
+		})
+		s.resources[rule.GVR] = rs
+	}
+	return s
 }
 
-func New(kc kubernetes.Interface, recorder record.EventRecorder) *ConfigSyncer {
-	return &ConfigSyncer{
-		kubeClient: kc,
-		recorder:   recorder,
+// KubeClient returns the client of the source cluster
+func (s *ConfigSyncer) KubeClient() kubernetes.Interface {
+	return s.kubeClient
+}
+
+// DynamicClient returns the dynamic client of the source cluster
+func (s *ConfigSyncer) DynamicClient() dynamic.Interface {
+	return s.dynamicClient
+}
+
+// Run starts the workers that process the queued sources and namespaces until stopCh is closed.
+func (s *ConfigSyncer) Run(stopCh <-chan struct{}) {
+	s.cmQueue.Run(stopCh)
+	s.secretQueue.Run(stopCh)
+	s.nsQueue.Run(stopCh)
+	if s.rcLister != nil {
+		s.rcQueue.Run(stopCh)
+	}
+	for _, rs := range s.resources {
+		rs.queue.Run(stopCh)
+	}
+	go wait.Until(s.probeContexts, time.Minute, stopCh)
+	if s.kubeconfigFile != "" {
+		go s.watchKubeconfig(stopCh)
+	}
+	if s.resyncPeriod > 0 {
+		go wait.Until(s.enqueueContextSelectorSources, s.resyncPeriod, stopCh)
 	}
 }
 
+// Configure identifies the source cluster, sets its name and loads the contexts of kubeconfigFile.
+// clusterName may be empty, like in copies written by older releases. Run reloads the contexts whenever
+// kubeconfigFile changes.
 func (s *ConfigSyncer) Configure(clusterName string, kubeconfigFile string) error {
+	clusterID, err := ClusterID(s.kubeClient)
+	if err != nil {
+		return err
+	}
+	contexts, hash, err := loadContexts(kubeconfigFile)
+	if err != nil {
+		return err
+	}
+
 	s.lock.Lock()
 	defer s.lock.Unlock()
 
 	s.clusterName = clusterName
-	s.contexts = map[string]clusterContext{}
+	s.clusterID = clusterID
+	s.kubeconfigFile = kubeconfigFile
+	s.kubeconfigHash = contextsHash(contexts, hash)
+	s.fileContexts = contexts
+	s.mergeContexts()
+	return nil
+}
 
-	// Parse external kubeconfig file, assume that it doesn't include source cluster
-	if kubeconfigFile != "" {
-		kConfig, err := clientcmd.LoadFromFile(kubeconfigFile)
-		if err != nil {
-			return errors.Errorf("failed to parse context list. Reason: %v", err)
-		}
+type clusterContext struct {
+	Client        kubernetes.Interface
+	DynamicClient dynamic.Interface
+	Namespace     string
+	Address       string
+	// creates missing target namespaces, if not configured by the source
+	CreateNamespace *api.NamespaceCreation
 
-		for contextName := range kConfig.Contexts {
-			ctx := clusterContext{}
+	// identifies and probes the cluster, it gives up after contextProbeTimeout. Nil if Client is used.
+	probe kubernetes.Interface
+	// why the clients of the context could not be built, the context can not be used
+	err error
+}
 
-			cfg, err := clientcmd_util.BuildConfigFromContext(kubeconfigFile, contextName)
-			if err != nil {
-				continue
-			}
-			if ctx.Client, err = kubernetes.NewForConfig(cfg); err != nil {
-				continue
-			}
-			if ctx.Namespace, err = clientcmd_util.NamespaceFromContext(kubeconfigFile, contextName); err != nil {
-				continue
-			}
+func (s *ConfigSyncer) reconcileNamespace(key string) error {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
 
-			u, err := url.Parse(cfg.Host)
-			if err != nil {
-				continue
-			}
-			host := u.Hostname()
-			port := u.Port()
-			if port == "" {
-				if u.Scheme == "https" {
-					port = "443"
-				} else if u.Scheme == "http" {
-					port = "80"
-				}
-			}
-			ctx.Address = host + ":" + port
-			s.contexts[contextName] = ctx
-		}
+	ns, err := s.nsLister.Get(key)
+	if kerr.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
 	}
-	return nil
-}
-
-type clusterContext struct {
-	Client    kubernetes.Interface
-	Namespace string
-	Address   string
+	return s.SyncIntoNamespace(ns.Name)
 }
 
+// SyncIntoNamespace reconciles the copies in a namespace of the source cluster. It writes the copies of
+// sources selecting the namespace and deletes the copies of sources that no longer select it.
 func (s *ConfigSyncer) SyncIntoNamespace(namespace string) error {
-	ns, err := s.kubeClient.CoreV1().Namespaces().Get(context.TODO(), namespace, metav1.GetOptions{})
+	ns, err := s.getNamespace(namespace)
 	if err != nil {
 		return err
 	}
 
-	configMaps, err := s.kubeClient.CoreV1().ConfigMaps(core.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+	// only sources selecting namespaces are looked at, a failing source does not stop the others
+	var errs []error
+	configMaps, err := s.namespaceSources(s.cmIndexer, api.SourceKindConfigMap)
 	if err != nil {
 		return err
 	}
-	for _, configMap := range configMaps.Items {
-		if err = s.syncConfigMapIntoNewNamespace(&configMap, ns); err != nil {
-			return err
+	for _, obj := range configMaps {
+		if configMap, ok := obj.(*core.ConfigMap); ok {
+			errs = append(errs, s.syncIntoNewNamespace(configMapCopier{s}, configMap, ns))
 		}
 	}
 
-	secrets, err := s.kubeClient.CoreV1().Secrets(core.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+	secrets, err := s.namespaceSources(s.secretIndexer, api.SourceKindSecret)
 	if err != nil {
 		return err
 	}
-	for _, secret := range secrets.Items {
-		if err = s.syncSecretIntoNewNamespace(&secret, ns); err != nil {
+	for _, obj := range secrets {
+		if secret, ok := obj.(*core.Secret); ok {
+			errs = append(errs, s.syncIntoNewNamespace(secretCopier{s}, secret, ns))
+		}
+	}
+
+	for _, rs := range s.resources {
+		sources, err := s.namespaceSources(rs.indexer, "")
+		if err != nil {
 			return err
 		}
+		for _, obj := range sources {
+			if src, ok := obj.(*unstructured.Unstructured); ok {
+				errs = append(errs, s.syncIntoNewNamespace(resourceCopier{s, rs.ResourceRule}, src, ns))
+			}
+		}
 	}
-	return nil
+	return utilerrors.NewAggregate(errs)
 }
 
 func (s *ConfigSyncer) syncerLabels(name, namespace, cluster string) labels.Set {
@@ -154,6 +345,19 @@ func (s *ConfigSyncer) syncerLabelSelector(name, namespace, cluster string) stri
 	return labels.SelectorFromSet(s.syncerLabels(name, namespace, cluster)).String()
 }
 
+// GetOrigin reads the reference to the source recorded on a copy. It returns nil if there is none.
+func GetOrigin(annotations map[string]string) (*core.ObjectReference, error) {
+	v, ok := annotations[ConfigOriginKey]
+	if !ok {
+		return nil, nil
+	}
+	var ref core.ObjectReference
+	if err := json.Unmarshal([]byte(v), &ref); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %s annotation", ConfigOriginKey)
+	}
+	return &ref, nil
+}
+
 func (s *ConfigSyncer) syncerAnnotations(oldAnnotations, srcAnnotations map[string]string, srcRef core.ObjectReference) map[string]string {
 	newAnnotations := map[string]string{}
 
@@ -166,7 +370,7 @@ func (s *ConfigSyncer) syncerAnnotations(oldAnnotations, srcAnnotations map[stri
 	}
 
 	for k, v := range srcAnnotations {
-		if k != ConfigSyncKey && k != ConfigSyncContexts {
+		if k != ConfigSyncKey && k != ConfigSyncContexts && k != SyncStatusKey && k != OriginClusterIDKey {
 			newAnnotations[k] = v
 		}
 	}
@@ -174,6 +378,28 @@ func (s *ConfigSyncer) syncerAnnotations(oldAnnotations, srcAnnotations map[stri
 	// set origin reference
 	ref, _ := json.Marshal(srcRef)
 	newAnnotations[ConfigOriginKey] = string(ref)
+	if s.clusterID != "" {
+		newAnnotations[OriginClusterIDKey] = s.clusterID
+	}
 
 	return newAnnotations
 }
+
+// originRef is the reference to src its copies record
+func originRef(src object) core.ObjectReference {
+	apiVersion, kind := src.GetObjectKind().GroupVersionKind().ToAPIVersionAndKind()
+	return core.ObjectReference{
+		APIVersion:      apiVersion,
+		Kind:            kind,
+		Name:            src.GetName(),
+		Namespace:       src.GetNamespace(),
+		UID:             src.GetUID(),
+		ResourceVersion: sourceResourceVersion(src),
+	}
+}
+
+// setCopyMeta sets the labels and annotations of obj, a copy of src recording the origin ref
+func (s *ConfigSyncer) setCopyMeta(obj, src metav1.Object, ref core.ObjectReference) {
+	obj.SetLabels(labels.Merge(src.GetLabels(), s.syncerLabels(src.GetName(), src.GetNamespace(), s.clusterName)))
+	obj.SetAnnotations(s.syncerAnnotations(obj.GetAnnotations(), src.GetAnnotations(), ref))
+}
@@ -0,0 +1,99 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"kubeops.dev/config-syncer/pkg/eventer"
+
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+// copies written by older releases carry an empty origin cluster, they must still be found after an upgrade
+func TestUpgradeKeepsLegacyCopies(t *testing.T) {
+	src := &core.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "omni",
+			Namespace:       "demo",
+			UID:             "src-uid",
+			ResourceVersion: "7",
+			Annotations:     map[string]string{ConfigSyncKey: "team=a"},
+		},
+		Data: map[string]string{"k": "new"},
+	}
+	legacy := func(namespace string) *core.ConfigMap {
+		return &core.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "omni",
+				Namespace: namespace,
+				UID:       types.UID("copy-uid-" + namespace),
+				Labels: map[string]string{
+					OriginNameLabelKey:      "omni",
+					OriginNamespaceLabelKey: "demo",
+					OriginClusterLabelKey:   "",
+				},
+				Annotations: map[string]string{ConfigOriginKey: `{"kind":"ConfigMap","namespace":"demo","name":"omni","uid":"src-uid","resourceVersion":"3"}`},
+			},
+			Data: map[string]string{"k": "old"},
+		}
+	}
+	kc := fake.NewSimpleClientset(
+		&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: metav1.NamespaceSystem, UID: "hub-uid"}},
+		&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "demo"}},
+		&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "a", Labels: map[string]string{"team": "a"}}},
+		&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "b"}},
+		src,
+		legacy("a"),
+		legacy("b"),
+	)
+	recorder := record.NewFakeRecorder(100)
+	s := New(kc, nil, nil, recorder, Options{})
+	if err := s.Configure("", ""); err != nil {
+		t.Fatal(err)
+	}
+	if s.clusterName != "" {
+		t.Fatalf("cluster name = %q, want it empty by default", s.clusterName)
+	}
+
+	if err := s.SyncConfigMap(src); err != nil {
+		t.Fatal(err)
+	}
+	updated, err := kc.CoreV1().ConfigMaps("a").Get(context.TODO(), "omni", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Data["k"] != "new" {
+		t.Errorf("legacy copy in namespace a has data %v, want it updated", updated.Data)
+	}
+	if _, err := kc.CoreV1().ConfigMaps("b").Get(context.TODO(), "omni", metav1.GetOptions{}); !kerr.IsNotFound(err) {
+		t.Errorf("legacy copy in unselected namespace b not deleted: %v", err)
+	}
+	close(recorder.Events)
+	for e := range recorder.Events {
+		if reason := strings.Fields(e)[1]; reason == eventer.EventReasonOriginConflict || reason == eventer.EventReasonCopyConflict || reason == eventer.EventReasonCopyAdopted {
+			t.Errorf("recorded %q for a legacy copy", e)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"bytes"
+	"text/template"
+
+	"github.com/pkg/errors"
+	core "k8s.io/api/core/v1"
+)
+
+// TemplateData is the context the values of a templated source are rendered against.
+type TemplateData struct {
+	Namespace   TemplateNamespace
+	ClusterName string
+	Context     string // empty for the source cluster
+}
+
+type TemplateNamespace struct {
+	Name        string
+	Labels      map[string]string
+	Annotations map[string]string
+}
+
+func newTemplateData(ns *core.Namespace, clusterName, ctx string) TemplateData {
+	return TemplateData{
+		Namespace: TemplateNamespace{
+			Name:        ns.Name,
+			Labels:      ns.Labels,
+			Annotations: ns.Annotations,
+		},
+		ClusterName: clusterName,
+		Context:     ctx,
+	}
+}
+
+// renderData renders every value of data as a Go text/template. Missing map keys are treated as errors.
+func renderData(data map[string]string, td TemplateData) (map[string]string, error) {
+	if data == nil {
+		return nil, nil
+	}
+	out := make(map[string]string, len(data))
+	for k, v := range data {
+		tpl, err := template.New(k).Option("missingkey=error").Parse(v)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse key %s", k)
+		}
+		var buf bytes.Buffer
+		if err := tpl.Execute(&buf, td); err != nil {
+			return nil, errors.Wrapf(err, "failed to render key %s", k)
+		}
+		out[k] = buf.String()
+	}
+	return out, nil
+}
@@ -0,0 +1,116 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	core_listers "k8s.io/client-go/listers/core/v1"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestRenderData(t *testing.T) {
+	td := newTemplateData(&core.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "demo",
+			Labels: map[string]string{"team": "a"},
+		},
+	}, "hub", "east")
+
+	tests := []struct {
+		name    string
+		data    map[string]string
+		want    map[string]string
+		wantErr bool
+	}{
+		{name: "nil", data: nil, want: nil},
+		{name: "plain values", data: map[string]string{"k": "v"}, want: map[string]string{"k": "v"}},
+		{
+			name: "namespace, cluster and context",
+			data: map[string]string{"url": "https://{{ .Namespace.Name }}.{{ .Context }}.{{ .ClusterName }}"},
+			want: map[string]string{"url": "https://demo.east.hub"},
+		},
+		{name: "label", data: map[string]string{"team": `{{ index .Namespace.Labels "team" }}`}, want: map[string]string{"team": "a"}},
+		{name: "missing label", data: map[string]string{"team": "{{ .Namespace.Labels.owner }}"}, wantErr: true},
+		{name: "parse error", data: map[string]string{"k": "{{ .Namespace.Name "}, wantErr: true},
+		{name: "unknown field", data: map[string]string{"k": "{{ .Cluster }}"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := renderData(tt.data, td)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("renderData() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("renderData() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSyncTemplatedConfigMap(t *testing.T) {
+	src := &core.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "omni",
+			Namespace: "demo",
+			Annotations: map[string]string{
+				ConfigSyncKey:      "",
+				ConfigSyncTemplate: "true",
+			},
+		},
+		Data: map[string]string{"team": `{{ index .Namespace.Labels "team" }}`},
+	}
+	namespaces := []*core.Namespace{
+		{ObjectMeta: metav1.ObjectMeta{Name: "demo"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "a", Labels: map[string]string{"team": "x"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "b", Labels: map[string]string{"team": "y"}}},
+	}
+	kc := fake.NewSimpleClientset(src, namespaces[0], namespaces[1], namespaces[2])
+	nsIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, ns := range namespaces {
+		if err := nsIndexer.Add(ns); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := New(kc, nil, nil, record.NewFakeRecorder(10), Options{})
+	s.nsLister = core_listers.NewNamespaceLister(nsIndexer)
+
+	if err := s.SyncConfigMap(src); err != nil {
+		t.Fatal(err)
+	}
+	for _, action := range kc.Actions() {
+		if action.GetResource().Resource == "namespaces" && action.GetVerb() == "get" {
+			t.Errorf("namespace %s read from the API server, want it from the cache", action.(clienttesting.GetAction).GetName())
+		}
+	}
+	for ns, want := range map[string]string{"a": "x", "b": "y"} {
+		out, err := kc.CoreV1().ConfigMaps(ns).Get(context.TODO(), "omni", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out.Data["team"] != want {
+			t.Errorf("team in namespace %s = %q, want %q", ns, out.Data["team"], want)
+		}
+	}
+}
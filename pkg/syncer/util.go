@@ -18,36 +18,213 @@ package syncer
 
 import (
 	"context"
+	"path"
+	"strconv"
 	"strings"
 
+	api "kubeops.dev/config-syncer/apis/kubed/v1alpha1"
+
+	"github.com/pkg/errors"
 	"gomodules.xyz/pointer"
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
 	"kmodules.xyz/client-go/meta"
 )
 
 type SyncOptions struct {
-	NamespaceSelector *string // if nil, delete from cluster
+	NamespaceSelector *string  // if nil and Namespaces is empty, delete from cluster
+	Namespaces        []string // selected in addition to the namespaces matching NamespaceSelector
 	Contexts          sets.String
+	IncludeKeys       []string // if empty, all keys are included
+	ExcludeKeys       []string
+	Name              string            // if empty, source name is used
+	ContextNames      map[string]string // per context override of Name
+	NamePrefix        string
+	NameSuffix        string
+	Template          bool           // render ConfigMap values as Go templates
+	ConflictPolicy    ConflictPolicy // if empty, global default is used
+	// if nil, the setting of the context is used
+	CreateNamespace *api.NamespaceCreation
+	// selects namespaces of the clusters of Contexts, if nil the namespace of the context is used
+	ContextSelector  *string
+	ContextSelectors map[string]string // per context override of ContextSelector
+	// selects the clusters of agents by their labels, ignored by the operator
+	ClusterSelector *string
 }
 
 func GetSyncOptions(annotations map[string]string) SyncOptions {
 	opts := SyncOptions{}
 	if v, err := meta.GetStringValue(annotations, ConfigSyncKey); err == nil {
-		if v == "true" {
-			opts.NamespaceSelector = pointer.StringP(labels.Everything().String())
-		} else {
-			opts.NamespaceSelector = &v
-		}
+		opts.NamespaceSelector = selectorValue(v)
 	}
 	if contexts, _ := meta.GetStringValue(annotations, ConfigSyncContexts); contexts != "" {
 		opts.Contexts = sets.NewString(strings.Split(contexts, ",")...)
 	}
+	if keys, _ := meta.GetStringValue(annotations, ConfigSyncIncludeKeys); keys != "" {
+		opts.IncludeKeys = splitPatterns(keys)
+	}
+	if keys, _ := meta.GetStringValue(annotations, ConfigSyncExcludeKeys); keys != "" {
+		opts.ExcludeKeys = splitPatterns(keys)
+	}
+	opts.Name, _ = meta.GetStringValue(annotations, ConfigSyncName)
+	if names, _ := meta.GetStringValue(annotations, ConfigSyncContextNames); names != "" {
+		opts.ContextNames = map[string]string{}
+		for _, pair := range splitPatterns(names) {
+			if ctx, name, ok := strings.Cut(pair, "="); ok {
+				opts.ContextNames[strings.TrimSpace(ctx)] = strings.TrimSpace(name)
+			}
+		}
+	}
+	opts.NamePrefix, _ = meta.GetStringValue(annotations, ConfigSyncNamePrefix)
+	opts.NameSuffix, _ = meta.GetStringValue(annotations, ConfigSyncNameSuffix)
+	if v, err := meta.GetStringValue(annotations, ConfigSyncTemplate); err == nil {
+		opts.Template, _ = strconv.ParseBool(v)
+	}
+	if v, _ := meta.GetStringValue(annotations, ConfigSyncConflictPolicy); v != "" {
+		if p, err := ParseConflictPolicy(v); err == nil {
+			opts.ConflictPolicy = p
+		} else {
+			klog.Warningln(err)
+		}
+	}
+	if v, err := meta.GetStringValue(annotations, ConfigSyncContextSelector); err == nil {
+		opts.ContextSelector = selectorValue(v)
+	}
+	if pairs, _ := meta.GetStringValue(annotations, ConfigSyncContextSelectors); pairs != "" {
+		opts.ContextSelectors = map[string]string{}
+		for _, pair := range strings.Split(pairs, ";") {
+			if ctx, selector, ok := strings.Cut(pair, "="); ok {
+				opts.ContextSelectors[strings.TrimSpace(ctx)] = *selectorValue(strings.TrimSpace(selector))
+			}
+		}
+	}
+	if v, err := meta.GetStringValue(annotations, ConfigSyncClusterSelector); err == nil {
+		opts.ClusterSelector = selectorValue(v)
+	}
+	if v, _ := meta.GetStringValue(annotations, ConfigSyncCreateNamespace); v == "true" {
+		opts.CreateNamespace = &api.NamespaceCreation{}
+		if pairs, _ := meta.GetStringValue(annotations, ConfigSyncNamespaceLabels); pairs != "" {
+			opts.CreateNamespace.Labels = map[string]string{}
+			for _, pair := range splitPatterns(pairs) {
+				if k, v, ok := strings.Cut(pair, "="); ok {
+					opts.CreateNamespace.Labels[strings.TrimSpace(k)] = strings.TrimSpace(v)
+				}
+			}
+		}
+		if v, _ := meta.GetStringValue(annotations, ConfigSyncPruneNamespace); v != "" {
+			opts.CreateNamespace.Prune, _ = strconv.ParseBool(v)
+		}
+	}
 	return opts
 }
 
+// selectorValue returns the namespace selector of a sync annotation, "true" selects every namespace
+func selectorValue(v string) *string {
+	if v == "true" {
+		return pointer.StringP(labels.Everything().String())
+	}
+	return &v
+}
+
+// contextSelector returns the selector of the namespaces of the cluster of ctx,
+// nil if the source is synced into the namespace of the context
+func (opts SyncOptions) contextSelector(ctx string) *string {
+	if v, ok := opts.ContextSelectors[ctx]; ok {
+		return &v
+	}
+	return opts.ContextSelector
+}
+
+// CopyName returns the name of the copies of source srcName in context ctx.
+// ctx is empty for the source cluster.
+func (opts SyncOptions) CopyName(srcName, ctx string) string {
+	name := srcName
+	if opts.Name != "" {
+		name = opts.Name
+	}
+	if v, ok := opts.ContextNames[ctx]; ok && ctx != "" && v != "" {
+		name = v
+	}
+	return opts.NamePrefix + name + opts.NameSuffix
+}
+
+func splitPatterns(s string) []string {
+	var patterns []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
+// validateKeys checks the include and exclude patterns of data keys
+func (opts SyncOptions) validateKeys() error {
+	for _, patterns := range [][]string{opts.IncludeKeys, opts.ExcludeKeys} {
+		for _, p := range patterns {
+			if _, err := path.Match(p, ""); err != nil {
+				return errors.Wrapf(err, "invalid key pattern %q", p)
+			}
+		}
+	}
+	return nil
+}
+
+// SelectsKey checks whether a data key of the source is copied into targets.
+// Exclude patterns take precedence over include patterns. Invalid exclude patterns
+// match every key, so no key meant to be kept out is copied.
+func (opts SyncOptions) SelectsKey(key string) bool {
+	for _, p := range opts.ExcludeKeys {
+		if ok, err := path.Match(p, key); ok || err != nil {
+			return false
+		}
+	}
+	if len(opts.IncludeKeys) == 0 {
+		return true
+	}
+	for _, p := range opts.IncludeKeys {
+		if ok, _ := path.Match(p, key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (opts SyncOptions) filterKeys() bool {
+	return len(opts.IncludeKeys) > 0 || len(opts.ExcludeKeys) > 0
+}
+
+func (opts SyncOptions) selectStringData(data map[string]string) map[string]string {
+	if data == nil || !opts.filterKeys() {
+		return data
+	}
+	out := make(map[string]string, len(data))
+	for k, v := range data {
+		if opts.SelectsKey(k) {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+func (opts SyncOptions) selectByteData(data map[string][]byte) map[string][]byte {
+	if data == nil || !opts.filterKeys() {
+		return data
+	}
+	out := make(map[string][]byte, len(data))
+	for k, v := range data {
+		if opts.SelectsKey(k) {
+			out[k] = v
+		}
+	}
+	return out
+}
+
 func NamespacesForSelector(kc kubernetes.Interface, selector string) (sets.String, error) {
 	namespaces, err := kc.CoreV1().Namespaces().List(context.TODO(), metav1.ListOptions{
 		LabelSelector: selector,
@@ -61,3 +238,135 @@ func NamespacesForSelector(kc kubernetes.Interface, selector string) (sets.Strin
 	}
 	return ns, nil
 }
+
+// syncsNamespaces checks whether the source is synced into any namespace of the source cluster
+func (opts SyncOptions) syncsNamespaces() bool {
+	return opts.NamespaceSelector != nil || len(opts.Namespaces) > 0
+}
+
+// selectsNamespace checks whether ns matches the namespace selector or is listed explicitly
+func (opts SyncOptions) selectsNamespace(ns *core.Namespace) (bool, error) {
+	for _, name := range opts.Namespaces {
+		if name == ns.Name {
+			return true, nil
+		}
+	}
+	selector, err := opts.namespaceSelector()
+	if err != nil || selector == nil {
+		return false, err
+	}
+	return selector.Matches(labels.Set(ns.Labels)), nil
+}
+
+// namespaceSelector parses the namespace selector, it returns nil if there is none
+func (opts SyncOptions) namespaceSelector() (labels.Selector, error) {
+	if opts.NamespaceSelector == nil {
+		return nil, nil
+	}
+	return labels.Parse(*opts.NamespaceSelector)
+}
+
+// namespacesForSource returns the namespaces selected by opts that accept copies of srcNamespace/srcName
+func namespacesForSource(kc kubernetes.Interface, opts SyncOptions, srcNamespace, srcName string) (sets.String, error) {
+	list, err := kc.CoreV1().Namespaces().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	namespaces := make([]*core.Namespace, len(list.Items))
+	for i := range list.Items {
+		namespaces[i] = &list.Items[i]
+	}
+	return selectNamespaces(namespaces, opts, srcNamespace, srcName)
+}
+
+// selectNamespaces returns the names of the namespaces selected by opts that accept copies of srcNamespace/srcName
+func selectNamespaces(namespaces []*core.Namespace, opts SyncOptions, srcNamespace, srcName string) (sets.String, error) {
+	ns := sets.NewString()
+	for _, namespace := range namespaces {
+		selected, err := opts.selectsNamespace(namespace)
+		if err != nil {
+			return nil, err
+		}
+		if selected && NamespaceAccepts(namespace, srcNamespace, srcName) {
+			ns.Insert(namespace.Name)
+		}
+	}
+	return ns, nil
+}
+
+// contextNamespaces returns the namespaces of the cluster of context ctx that get copies of srcNamespace/srcName
+func contextNamespaces(opts SyncOptions, ctx string, cc clusterContext, srcNamespace, srcName string) (sets.String, error) {
+	if selector := opts.contextSelector(ctx); selector != nil {
+		return namespacesForSource(cc.Client, SyncOptions{NamespaceSelector: selector}, srcNamespace, srcName)
+	}
+	namespace := cc.Namespace
+	if namespace == "" { // use source namespace if not specified via context
+		namespace = srcNamespace
+	}
+	if accepts, err := namespaceAcceptsSource(cc.Client, namespace, srcNamespace, srcName); err != nil {
+		return nil, err
+	} else if !accepts {
+		return sets.NewString(), nil // target namespace opted out, delete previously added copy
+	}
+	return sets.NewString(namespace), nil
+}
+
+// NamespaceAccepts checks the opt-out, allow and deny annotations of a target namespace
+// to decide whether it accepts copies of the source srcNamespace/srcName.
+func NamespaceAccepts(ns *core.Namespace, srcNamespace, srcName string) bool {
+	if v, err := meta.GetStringValue(ns.Annotations, NamespaceSyncOptOutKey); err == nil {
+		if optOut, _ := strconv.ParseBool(v); optOut {
+			return false
+		}
+	}
+	if v, err := meta.GetStringValue(ns.Annotations, NamespaceSyncDenyKey); err == nil && sourceListed(v, srcNamespace, srcName) {
+		return false
+	}
+	if v, err := meta.GetStringValue(ns.Annotations, NamespaceSyncAllowKey); err == nil {
+		return sourceListed(v, srcNamespace, srcName)
+	}
+	return true
+}
+
+// sourceListed checks whether srcNamespace/srcName matches any entry of a comma separated
+// list of "namespace" or "namespace/name" patterns. Patterns use path.Match syntax.
+func sourceListed(list, srcNamespace, srcName string) bool {
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		nsPattern, namePattern := entry, "*"
+		if idx := strings.Index(entry, "/"); idx >= 0 {
+			nsPattern, namePattern = entry[:idx], entry[idx+1:]
+		}
+		if ok, _ := path.Match(nsPattern, srcNamespace); !ok {
+			continue
+		}
+		if ok, _ := path.Match(namePattern, srcName); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// namespaceAcceptsSource checks a target namespace by name. Missing namespaces are reported as
+// accepting, so that they are created if configured and the upsert into them fails loudly otherwise.
+// Other errors are returned, as the annotations of the namespace are unknown.
+func namespaceAcceptsSource(kc kubernetes.Interface, namespace, srcNamespace, srcName string) (bool, error) {
+	ns, err := kc.CoreV1().Namespaces().Get(context.TODO(), namespace, metav1.GetOptions{})
+	if kerr.IsNotFound(err) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+	return NamespaceAccepts(ns, srcNamespace, srcName), nil
+}
+
+// targetString describes a target namespace for logs and events, ctx is empty for the source cluster
+func targetString(namespace, ctx string) string {
+	if ctx == "" {
+		return "namespace " + namespace
+	}
+	return "namespace " + namespace + " of context " + ctx
+}
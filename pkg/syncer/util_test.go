@@ -0,0 +1,187 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"reflect"
+	"testing"
+
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func TestSelectsKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		include []string
+		exclude []string
+		key     string
+		want    bool
+		wantErr bool
+	}{
+		{name: "no filters", key: "app.conf", want: true},
+		{name: "included", include: []string{"*.conf"}, key: "app.conf", want: true},
+		{name: "not included", include: []string{"*.conf"}, key: "app.yaml", want: false},
+		{name: "excluded", exclude: []string{"*.key"}, key: "tls.key", want: false},
+		{name: "not excluded", exclude: []string{"*.key"}, key: "tls.crt", want: true},
+		{name: "exclude takes precedence", include: []string{"tls.*"}, exclude: []string{"*.key"}, key: "tls.key", want: false},
+		{name: "any include pattern", include: []string{"*.conf", "tls.*"}, key: "tls.crt", want: true},
+		{name: "invalid include pattern", include: []string{"["}, key: "[", want: false, wantErr: true},
+		{name: "invalid exclude pattern excludes every key", exclude: []string{"*.key", "tls.[a-"}, key: "tls.key", want: false, wantErr: true},
+		{name: "invalid exclude pattern on other keys", exclude: []string{"["}, key: "ca.crt", want: false, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := SyncOptions{IncludeKeys: tt.include, ExcludeKeys: tt.exclude}
+			if err := opts.validateKeys(); (err != nil) != tt.wantErr {
+				t.Errorf("validateKeys() = %v, want error %v", err, tt.wantErr)
+			}
+			if got := opts.SelectsKey(tt.key); got != tt.want {
+				t.Errorf("SelectsKey(%q) = %v, want %v", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCopyName(t *testing.T) {
+	tests := []struct {
+		name string
+		opts SyncOptions
+		ctx  string
+		want string
+	}{
+		{name: "source name", want: "omni"},
+		{name: "renamed", opts: SyncOptions{Name: "shared"}, want: "shared"},
+		{name: "prefix and suffix", opts: SyncOptions{NamePrefix: "p-", NameSuffix: "-s"}, want: "p-omni-s"},
+		{name: "prefix and suffix of new name", opts: SyncOptions{Name: "shared", NamePrefix: "p-", NameSuffix: "-s"}, want: "p-shared-s"},
+		{name: "context name", opts: SyncOptions{Name: "shared", ContextNames: map[string]string{"east": "east-omni"}}, ctx: "east", want: "east-omni"},
+		{name: "other context", opts: SyncOptions{Name: "shared", ContextNames: map[string]string{"east": "east-omni"}}, ctx: "west", want: "shared"},
+		{name: "empty context name", opts: SyncOptions{ContextNames: map[string]string{"east": ""}}, ctx: "east", want: "omni"},
+		{name: "context names ignored in source cluster", opts: SyncOptions{ContextNames: map[string]string{"": "local"}}, want: "omni"},
+		{name: "prefix of context name", opts: SyncOptions{NamePrefix: "p-", ContextNames: map[string]string{"east": "east-omni"}}, ctx: "east", want: "p-east-omni"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.opts.CopyName("omni", tt.ctx); got != tt.want {
+				t.Errorf("CopyName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNamespaceAccepts(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        bool
+	}{
+		{name: "no annotations", want: true},
+		{name: "opted out", annotations: map[string]string{NamespaceSyncOptOutKey: "true"}, want: false},
+		{name: "opt out disabled", annotations: map[string]string{NamespaceSyncOptOutKey: "false"}, want: true},
+		{name: "malformed opt out", annotations: map[string]string{NamespaceSyncOptOutKey: "yes please"}, want: true},
+		{name: "opt out overrides allow", annotations: map[string]string{NamespaceSyncOptOutKey: "true", NamespaceSyncAllowKey: "demo"}, want: false},
+		{name: "allowed namespace", annotations: map[string]string{NamespaceSyncAllowKey: "demo"}, want: true},
+		{name: "allowed source", annotations: map[string]string{NamespaceSyncAllowKey: "demo/omni"}, want: true},
+		{name: "other source allowed", annotations: map[string]string{NamespaceSyncAllowKey: "demo/other"}, want: false},
+		{name: "other namespace allowed", annotations: map[string]string{NamespaceSyncAllowKey: "other"}, want: false},
+		{name: "empty allow list", annotations: map[string]string{NamespaceSyncAllowKey: ""}, want: false},
+		{name: "denied namespace", annotations: map[string]string{NamespaceSyncDenyKey: "demo"}, want: false},
+		{name: "other source denied", annotations: map[string]string{NamespaceSyncDenyKey: "demo/other"}, want: true},
+		{name: "empty deny list", annotations: map[string]string{NamespaceSyncDenyKey: ""}, want: true},
+		{name: "deny takes precedence", annotations: map[string]string{NamespaceSyncAllowKey: "demo", NamespaceSyncDenyKey: "demo/omni"}, want: false},
+		{name: "allowed besides denied source", annotations: map[string]string{NamespaceSyncAllowKey: "demo", NamespaceSyncDenyKey: "demo/other"}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ns := &core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "target", Annotations: tt.annotations}}
+			if got := NamespaceAccepts(ns, "demo", "omni"); got != tt.want {
+				t.Errorf("NamespaceAccepts() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSourceListed(t *testing.T) {
+	tests := []struct {
+		name string
+		list string
+		want bool
+	}{
+		{name: "empty", list: "", want: false},
+		{name: "only separators", list: " , ,", want: false},
+		{name: "namespace", list: "demo", want: true},
+		{name: "namespace and name", list: "demo/omni", want: true},
+		{name: "other name", list: "demo/other", want: false},
+		{name: "namespace is no prefix", list: "dem", want: false},
+		{name: "namespace glob", list: "de*", want: true},
+		{name: "name glob", list: "demo/om?i", want: true},
+		{name: "globs in both", list: "*/*", want: true},
+		{name: "glob does not match", list: "prod-*", want: false},
+		{name: "any entry", list: "other, demo/omni", want: true},
+		{name: "spaces around entries", list: "  other ,  demo  ", want: true},
+		{name: "empty name pattern", list: "demo/", want: false},
+		{name: "malformed pattern", list: "de[mo", want: false},
+		{name: "malformed pattern besides match", list: "de[mo,demo/omni", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sourceListed(tt.list, "demo", "omni"); got != tt.want {
+				t.Errorf("sourceListed(%q) = %v, want %v", tt.list, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContextNamespaces(t *testing.T) {
+	optedOut := &core.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:        "demo",
+		Annotations: map[string]string{NamespaceSyncOptOutKey: "true"},
+	}}
+	tests := []struct {
+		name    string
+		objs    []runtime.Object
+		getErr  error
+		want    []string
+		wantErr bool
+	}{
+		{name: "accepting", objs: []runtime.Object{&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "demo"}}}, want: []string{"demo"}},
+		{name: "opted out", objs: []runtime.Object{optedOut}, want: []string{}},
+		{name: "missing", want: []string{"demo"}},
+		{name: "forbidden", objs: []runtime.Object{optedOut}, getErr: kerr.NewForbidden(core.Resource("namespaces"), "demo", nil), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kc := fake.NewSimpleClientset(tt.objs...)
+			if tt.getErr != nil {
+				kc.PrependReactor("get", "namespaces", func(clienttesting.Action) (bool, runtime.Object, error) {
+					return true, nil, tt.getErr
+				})
+			}
+			got, err := contextNamespaces(SyncOptions{}, "east", clusterContext{Client: kc}, "demo", "omni")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("contextNamespaces() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got.List(), tt.want) {
+				t.Errorf("contextNamespaces() = %v, want %v", got.List(), tt.want)
+			}
+		})
+	}
+}
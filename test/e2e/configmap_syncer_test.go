@@ -20,6 +20,8 @@ import (
 	"context"
 	"os"
 
+	api "kubeops.dev/config-syncer/apis/kubed/v1alpha1"
+	"kubeops.dev/config-syncer/pkg/eventer"
 	"kubeops.dev/config-syncer/pkg/operator"
 	"kubeops.dev/config-syncer/pkg/syncer"
 	"kubeops.dev/config-syncer/test/e2e/framework"
@@ -99,6 +101,123 @@ var _ = Describe("Config-Syncer", func() {
 			})
 		})
 
+		Context("Key Filter", func() {
+			It("should sync only selected keys", func() {
+				shouldSyncConfigMapToAllNamespaces()
+
+				By("Adding key filter annotation")
+				source, err := f.KubeClient.CoreV1().ConfigMaps(cfgMap.Namespace).Get(context.TODO(), cfgMap.Name, metav1.GetOptions{})
+				Expect(err).NotTo(HaveOccurred())
+
+				source, _, err = core_util.PatchConfigMap(context.TODO(), f.KubeClient, source, func(obj *core.ConfigMap) *core.ConfigMap {
+					metav1.SetMetaDataAnnotation(&obj.ObjectMeta, syncer.ConfigSyncIncludeKeys, "you")
+					return obj
+				}, metav1.PatchOptions{})
+				Expect(err).ShouldNot(HaveOccurred())
+
+				By("Creating new namespace")
+				err = f.CreateNamespace(nsWithLabel)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				By("Checking copy has only the selected keys")
+				Eventually(func() map[string]string {
+					cm, err := f.KubeClient.CoreV1().ConfigMaps(nsWithLabel.Name).Get(context.TODO(), source.Name, metav1.GetOptions{})
+					if err != nil {
+						return nil
+					}
+					return cm.Data
+				}).Should(Equal(map[string]string{"you": "only"}))
+			})
+		})
+
+		Context("Sync Status", func() {
+			It("should record synced namespaces on the source", func() {
+				By("Creating new namespace")
+				err := f.CreateNamespace(nsWithLabel)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				shouldSyncConfigMapToAllNamespaces()
+
+				By("Checking sync status of source")
+				Eventually(func() []string {
+					source, err := f.KubeClient.CoreV1().ConfigMaps(cfgMap.Namespace).Get(context.TODO(), cfgMap.Name, metav1.GetOptions{})
+					Expect(err).NotTo(HaveOccurred())
+					status, err := syncer.GetSyncStatus(source.Annotations)
+					Expect(err).NotTo(HaveOccurred())
+					if status == nil {
+						return nil
+					}
+					return status.Namespaces
+				}).Should(ContainElement(nsWithLabel.Name))
+			})
+		})
+
+		Context("Events", func() {
+			It("should record events on source and copy", func() {
+				By("Creating new namespace")
+				err := f.CreateNamespace(nsWithLabel)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				shouldSyncConfigMapToAllNamespaces()
+
+				By("Checking events of source")
+				f.EventuallyEventRecorded(cfgMap.Namespace, cfgMap.Name, eventer.EventReasonCopyCreated).Should(BeTrue())
+				f.EventuallyEventRecorded(cfgMap.Namespace, cfgMap.Name, eventer.EventReasonSyncSucceeded).Should(BeTrue())
+
+				By("Checking events of copy")
+				f.EventuallyEventRecorded(nsWithLabel.Name, cfgMap.Name, eventer.EventReasonCopyCreated).Should(BeTrue())
+			})
+		})
+
+		Context("Namespace Opt Out", func() {
+			It("should delete synced configMap from opted out namespace", func() {
+				By("Creating new namespace")
+				err := f.CreateNamespace(nsWithLabel)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				shouldSyncConfigMapToAllNamespaces()
+
+				By("Checking new namespace has the configMap")
+				f.EventuallyConfigMapSyncedToNamespace(cfgMap, nsWithLabel.Name).Should(BeTrue())
+
+				By("Adding opt-out annotation to namespace")
+				ns, err := f.KubeClient.CoreV1().Namespaces().Get(context.TODO(), nsWithLabel.Name, metav1.GetOptions{})
+				Expect(err).NotTo(HaveOccurred())
+				metav1.SetMetaDataAnnotation(&ns.ObjectMeta, syncer.NamespaceSyncOptOutKey, "true")
+				_, err = f.KubeClient.CoreV1().Namespaces().Update(context.TODO(), ns, metav1.UpdateOptions{})
+				Expect(err).NotTo(HaveOccurred())
+
+				By("Checking configMap has been deleted from opted out namespace")
+				f.EventuallyConfigMapSyncedToNamespace(cfgMap, nsWithLabel.Name).Should(BeFalse())
+			})
+		})
+
+		Context("Namespace Label Removed", func() {
+			It("should delete synced configMap from namespace no longer selected", func() {
+				By("Creating configMap with selector annotation")
+				metav1.SetMetaDataAnnotation(&cfgMap.ObjectMeta, syncer.ConfigSyncKey, "app="+f.App())
+				_, err := f.CreateConfigMap(cfgMap)
+				Expect(err).NotTo(HaveOccurred())
+
+				By("Creating new namespace with label")
+				err = f.CreateNamespace(nsWithLabel)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				By("Checking new namespace has the configMap")
+				f.EventuallyConfigMapSyncedToNamespace(cfgMap, nsWithLabel.Name).Should(BeTrue())
+
+				By("Removing label from namespace")
+				ns, err := f.KubeClient.CoreV1().Namespaces().Get(context.TODO(), nsWithLabel.Name, metav1.GetOptions{})
+				Expect(err).NotTo(HaveOccurred())
+				delete(ns.Labels, "app")
+				_, err = f.KubeClient.CoreV1().Namespaces().Update(context.TODO(), ns, metav1.UpdateOptions{})
+				Expect(err).NotTo(HaveOccurred())
+
+				By("Checking configMap has been deleted from namespace")
+				f.EventuallyConfigMapSyncedToNamespace(cfgMap, nsWithLabel.Name).Should(BeFalse())
+			})
+		})
+
 		Context("Remove Sync Annotation", func() {
 			It("should delete synced configMaps", func() {
 				shouldSyncConfigMapToAllNamespaces()
@@ -232,6 +351,37 @@ var _ = Describe("Config-Syncer", func() {
 			})
 		})
 
+		Context("ConfigSync", func() {
+			It("should sync configMap to namespaces selected by ConfigSync", func() {
+				By("Creating configMap")
+				source, err := f.CreateConfigMap(cfgMap)
+				Expect(err).NotTo(HaveOccurred())
+
+				By("Creating ConfigSync")
+				cs := f.NewConfigSync(api.SourceKindConfigMap, source.Name)
+				cs.Spec.NamespaceSelector = &metav1.LabelSelector{
+					MatchLabels: map[string]string{"app": f.App()},
+				}
+				cs, err = f.CreateConfigSync(cs)
+				Expect(err).NotTo(HaveOccurred())
+				f.EventuallyConfigSyncPhase(cs.ObjectMeta).Should(Equal(api.ConfigSyncPhaseCurrent))
+
+				By("Creating new namespace with label")
+				err = f.CreateNamespace(nsWithLabel)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				By("Checking configMap synced to new namespace")
+				f.EventuallyConfigMapSyncedToNamespace(source, nsWithLabel.Name).Should(BeTrue())
+
+				By("Deleting ConfigSync")
+				err = f.DeleteConfigSync(cs.ObjectMeta)
+				Expect(err).NotTo(HaveOccurred())
+
+				By("Checking synced configMap has been deleted")
+				f.EventuallyConfigMapSyncedToNamespace(source, nsWithLabel.Name).Should(BeFalse())
+			})
+		})
+
 		Context("Source Deleted", func() {
 			It("should delete synced configMaps", func() {
 				shouldSyncConfigMapToAllNamespaces()
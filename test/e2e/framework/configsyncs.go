@@ -0,0 +1,57 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package framework
+
+import (
+	"context"
+
+	api "kubeops.dev/config-syncer/apis/kubed/v1alpha1"
+
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func (fi *Invocation) NewConfigSync(kind api.SourceKind, source string) *api.ConfigSync {
+	return &api.ConfigSync{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fi.App(),
+			Namespace: fi.Namespace(),
+		},
+		Spec: api.ConfigSyncSpec{
+			Source: api.SourceReference{
+				Kind: kind,
+				Name: source,
+			},
+		},
+	}
+}
+
+func (fi *Invocation) CreateConfigSync(obj *api.ConfigSync) (*api.ConfigSync, error) {
+	return fi.KubedClient.KubedV1alpha1().ConfigSyncs(obj.Namespace).Create(context.TODO(), obj, metav1.CreateOptions{})
+}
+
+func (fi *Invocation) DeleteConfigSync(meta metav1.ObjectMeta) error {
+	return fi.KubedClient.KubedV1alpha1().ConfigSyncs(meta.Namespace).Delete(context.TODO(), meta.Name, metav1.DeleteOptions{})
+}
+
+func (fi *Invocation) EventuallyConfigSyncPhase(meta metav1.ObjectMeta) GomegaAsyncAssertion {
+	return Eventually(func() api.ConfigSyncPhase {
+		obj, err := fi.KubedClient.KubedV1alpha1().ConfigSyncs(meta.Namespace).Get(context.TODO(), meta.Name, metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		return obj.Status.Phase
+	})
+}
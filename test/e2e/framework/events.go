@@ -0,0 +1,37 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package framework
+
+import (
+	"context"
+
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+)
+
+func (fi *Invocation) EventuallyEventRecorded(namespace, name, reason string) GomegaAsyncAssertion {
+	return Eventually(func() bool {
+		events, err := fi.KubeClient.CoreV1().Events(namespace).List(context.TODO(), metav1.ListOptions{
+			FieldSelector: fields.Set{
+				"involvedObject.name": name,
+				"reason":              reason,
+			}.String(),
+		})
+		return err == nil && len(events.Items) > 0
+	})
+}
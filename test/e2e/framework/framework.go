@@ -20,6 +20,8 @@ import (
 	"path/filepath"
 	"sync"
 
+	kubed_cs "kubeops.dev/config-syncer/client/clientset/versioned"
+
 	. "github.com/onsi/gomega"
 	"gomodules.xyz/blobfs"
 	"gomodules.xyz/cert/certstore"
@@ -30,6 +32,7 @@ import (
 
 type Framework struct {
 	KubeClient     clientset.Interface
+	KubedClient    kubed_cs.Interface
 	namespace      string
 	Mutex          sync.Mutex
 	CertStore      *certstore.CertStore
@@ -49,6 +52,7 @@ func New(config *rest.Config) *Framework {
 
 		ClientConfig: config,
 		KubeClient:   clientset.NewForConfigOrDie(config),
+		KubedClient:  kubed_cs.NewForConfigOrDie(config),
 		CertStore:    store,
 	}
 }